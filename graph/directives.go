@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/apartapatia/wall_of_comments/graph/model"
+	"github.com/apartapatia/wall_of_comments/internal/auth"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/service"
+)
+
+// NewConfig wires the resolvers and the permission directives of the schema.
+func NewConfig(resolver *Resolver) Config {
+	return Config{
+		Resolvers: resolver,
+		Directives: DirectiveRoot{
+			HasRole: resolver.hasRole,
+			IsOwner: resolver.isOwner,
+		},
+	}
+}
+
+func (r *Resolver) hasRole(ctx context.Context, obj interface{}, next graphql.Resolver, role model.Role) (interface{}, error) {
+	if err := service.RequireRole(auth.UserFromContext(ctx), entityRole(role)); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+// isOwner looks up the author of the post or comment in the "id" argument of the field.
+func (r *Resolver) isOwner(ctx context.Context, obj interface{}, next graphql.Resolver, of model.OwnedResource) (interface{}, error) {
+	actor := auth.UserFromContext(ctx)
+	if err := service.RequireRole(actor, entity.RoleCommenter); err != nil {
+		return nil, err
+	}
+
+	id, ok := graphql.GetFieldContext(ctx).Args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("@isOwner needs an id argument on %s", graphql.GetFieldContext(ctx).Field.Name)
+	}
+
+	var authorID string
+	switch of {
+	case model.OwnedResourcePost:
+		post, err := r.PostService.GetPost(id)
+		if err != nil {
+			return nil, err
+		}
+		authorID = post.AuthorID
+	case model.OwnedResourceComment:
+		comment, err := r.CommentService.GetComment(id)
+		if err != nil {
+			return nil, err
+		}
+		authorID = comment.AuthorID
+	default:
+		return nil, fmt.Errorf("unsupported owned resource: %s", of)
+	}
+
+	if err := service.Authorize(actor, authorID); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+func entityRole(role model.Role) entity.Role {
+	return entity.Role(strings.ToLower(string(role)))
+}
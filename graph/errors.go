@@ -0,0 +1,49 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/apartapatia/wall_of_comments/internal/service"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// errorCodes are exposed to clients in the "code" error extension,
+// so they can react to a rule violation without parsing messages.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{service.ErrInvalidInput, "INVALID_INPUT"},
+	{service.ErrPostNotFound, "POST_NOT_FOUND"},
+	{service.ErrCommentNotFound, "COMMENT_NOT_FOUND"},
+	{service.ErrCommentDeleted, "COMMENT_DELETED"},
+	{service.ErrParentNotFound, "PARENT_NOT_FOUND"},
+	{service.ErrCommentsDisabled, "COMMENTS_DISABLED"},
+	{service.ErrParentOnOtherPost, "PARENT_ON_OTHER_POST"},
+	{service.ErrUserNotFound, "USER_NOT_FOUND"},
+	{service.ErrUserExists, "USER_EXISTS"},
+	{service.ErrInvalidCredentials, "INVALID_CREDENTIALS"},
+	{service.ErrUnauthenticated, "UNAUTHENTICATED"},
+	{service.ErrForbidden, "FORBIDDEN"},
+	{service.ErrAlreadyReported, "ALREADY_REPORTED"},
+	{service.ErrReportNotFound, "REPORT_NOT_FOUND"},
+	{service.ErrContentRejected, "CONTENT_REJECTED"},
+}
+
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			if gqlErr.Extensions == nil {
+				gqlErr.Extensions = map[string]interface{}{}
+			}
+			gqlErr.Extensions["code"] = known.code
+			break
+		}
+	}
+
+	return gqlErr
+}
@@ -0,0 +1,304 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/apartapatia/wall_of_comments/graph/model"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/events"
+	"github.com/apartapatia/wall_of_comments/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultPageSize = 20
+const maxPageSize = 100
+const defaultTreeDepth = 3
+const maxTreeDepth = 10
+
+var ErrInvalidPageSize = fmt.Errorf("%w: first must be between 0 and %d", service.ErrInvalidInput, maxPageSize)
+var ErrInvalidTreeDepth = fmt.Errorf("%w: depth must be between 1 and %d", service.ErrInvalidInput, maxTreeDepth)
+var ErrInvalidOffset = fmt.Errorf("%w: offset must not be negative", service.ErrInvalidInput)
+var ErrInvalidLimit = fmt.Errorf("%w: limit must not be negative", service.ErrInvalidInput)
+
+func pageArgs(first *int, after *string) (int, *database.Cursor, error) {
+	limit := defaultPageSize
+	if first != nil {
+		if *first < 0 || *first > maxPageSize {
+			return 0, nil, ErrInvalidPageSize
+		}
+		limit = *first
+	}
+
+	if after == nil {
+		return limit, nil, nil
+	}
+
+	cursor, err := database.DecodeCursor(*after)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return limit, cursor, nil
+}
+
+// offsetPageArgs is pageArgs for lists paged by offset rather than by cursor.
+func offsetPageArgs(first *int, offset *int) (int, int, error) {
+	limit, _, err := pageArgs(first, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if offset == nil {
+		return limit, 0, nil
+	}
+	if *offset < 0 {
+		return 0, 0, ErrInvalidOffset
+	}
+	return limit, *offset, nil
+}
+
+// searchPageArgs is pageArgs for search results, which have cursors of their own.
+func searchPageArgs(first *int, after *string) (int, *database.SearchCursor, error) {
+	limit, _, err := pageArgs(first, nil)
+	if err != nil || after == nil {
+		return limit, nil, err
+	}
+
+	cursor, err := database.DecodeSearchCursor(*after)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return limit, cursor, nil
+}
+
+func treeOptions(actor *entity.User, first *int, depth *int, sort *model.CommentSort) (database.TreeOptions, error) {
+	perLevel, _, err := pageArgs(first, nil)
+	if err != nil {
+		return database.TreeOptions{}, err
+	}
+
+	maxDepth := defaultTreeDepth
+	if depth != nil {
+		if *depth < 1 || *depth > maxTreeDepth {
+			return database.TreeOptions{}, ErrInvalidTreeDepth
+		}
+		maxDepth = *depth
+	}
+
+	return database.TreeOptions{First: perLevel, MaxDepth: maxDepth, Order: commentSort(sort), Viewer: service.ViewerOf(actor)}, nil
+}
+
+func postSort(sort *model.PostSort) database.PostSort {
+	if sort == nil {
+		return database.PostSortOldest
+	}
+	return database.PostSort(*sort)
+}
+
+func entityModerationMode(mode model.ModerationMode) entity.ModerationMode {
+	return entity.ModerationMode(strings.ToLower(string(mode)))
+}
+
+func commentSort(sort *model.CommentSort) database.CommentSort {
+	if sort == nil {
+		return database.CommentSortOldest
+	}
+	return database.CommentSort(*sort)
+}
+
+func buildSearchEdge(actor *entity.User, hit *database.SearchHit) *model.SearchEdge {
+	edge := &model.SearchEdge{Cursor: hit.Cursor().Encode(), Rank: hit.Rank, Snippet: hit.Snippet}
+	if hit.Post != nil {
+		edge.Node = buildPostModel(hit.Post)
+	} else {
+		edge.Node = buildCommentModel(actor, hit.Comment)
+	}
+	return edge
+}
+
+func buildPostModel(post *entity.Post) *model.Post {
+	return &model.Post{
+		ID:             post.ID,
+		Title:          post.Title,
+		Content:        post.Content,
+		ModerationMode: model.ModerationMode(strings.ToUpper(string(post.ModerationMode))),
+		AuthorID:       post.AuthorID,
+		CreatedAt:      post.CreatedAt,
+		UpdatedAt:      post.UpdatedAt,
+		Score:          post.Score(),
+		Upvotes:        post.Upvotes,
+		Downvotes:      post.Downvotes,
+	}
+}
+
+// buildCommentModel shows the comment as the actor may see it, see service.Conceal.
+func buildCommentModel(actor *entity.User, comment *entity.Comment) *model.Comment {
+	comment = service.Conceal(actor, comment)
+	return &model.Comment{
+		ID:        comment.ID,
+		PostID:    comment.PostID,
+		ParentID:  comment.ParentID,
+		AuthorID:  comment.AuthorID,
+		Content:   comment.Content,
+		Deleted:   comment.Deleted,
+		Hidden:    comment.Hidden,
+		Status:    model.CommentStatus(strings.ToUpper(string(comment.Status))),
+		Tags:      comment.Tags,
+		CreatedAt: comment.CreatedAt,
+		UpdatedAt: comment.UpdatedAt,
+		EditedAt:  comment.EditedAt,
+		Score:     comment.Score(),
+		Upvotes:   comment.Upvotes,
+		Downvotes: comment.Downvotes,
+	}
+}
+
+var voteValues = map[model.VoteValue]entity.Vote{
+	model.VoteValueUp:   entity.VoteUp,
+	model.VoteValueDown: entity.VoteDown,
+	model.VoteValueNone: entity.VoteNone,
+}
+
+func entityVote(value model.VoteValue) entity.Vote {
+	return voteValues[value]
+}
+
+func buildVoteValue(vote entity.Vote) model.VoteValue {
+	for value, known := range voteValues {
+		if known == vote {
+			return value
+		}
+	}
+	return model.VoteValueNone
+}
+
+func buildUserModel(user *entity.User) *model.User {
+	return &model.User{
+		ID:        user.ID,
+		Name:      user.Name,
+		Role:      model.Role(strings.ToUpper(string(user.Role))),
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func buildReportModel(report *entity.Report) *model.Report {
+	return &model.Report{
+		ID:        report.ID,
+		CommentID: report.CommentID,
+		Reason:    report.Reason,
+		Status:    model.ReportStatus(strings.ToUpper(string(report.Status))),
+		CreatedAt: report.CreatedAt,
+		UserID:    report.UserID,
+	}
+}
+
+func buildModerationItemModel(actor *entity.User, item *database.ModerationItem) *model.ModerationItem {
+	reports := make([]*model.Report, 0, len(item.Reports))
+	for _, report := range item.Reports {
+		reports = append(reports, buildReportModel(report))
+	}
+	return &model.ModerationItem{
+		Comment:     buildCommentModel(actor, item.Comment),
+		ReportCount: len(reports),
+		Reports:     reports,
+	}
+}
+
+func buildAuthPayload(session *service.Session) *model.AuthPayload {
+	return &model.AuthPayload{Token: session.Token, User: buildUserModel(session.User)}
+}
+
+// buildCommentTree nests a flat subtree returned by GetCommentTrees under its roots,
+// the comments whose parent is parentID. Comments on the last fetched level keep
+// nil replies, so the replies resolver knows it still has to load them.
+func buildCommentTree(actor *entity.User, comments []*entity.Comment, parentID *string, maxDepth int) []*model.Comment {
+	roots := []*model.Comment{}
+	nodes := make(map[string]*model.Comment, len(comments))
+	depths := make(map[string]int, len(comments))
+
+	for _, comment := range comments {
+		commentModel := buildCommentModel(actor, comment)
+
+		depth := 1
+		if !sameParent(comment.ParentID, parentID) {
+			parent, exists := nodes[*comment.ParentID]
+			if !exists {
+				continue
+			}
+			depth = depths[parent.ID] + 1
+			parent.Replies = append(parent.Replies, commentModel)
+		} else {
+			roots = append(roots, commentModel)
+		}
+
+		if depth < maxDepth {
+			commentModel.Replies = []*model.Comment{}
+		}
+		nodes[comment.ID] = commentModel
+		depths[comment.ID] = depth
+	}
+
+	return roots
+}
+
+func sameParent(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func buildReactionModels(counts []*entity.ReactionCount) []*model.Reaction {
+	reactions := make([]*model.Reaction, 0, len(counts))
+	for _, count := range counts {
+		reactions = append(reactions, &model.Reaction{Emoji: count.Emoji, Count: count.Count, ReactedByMe: count.ReactedByMe})
+	}
+	return reactions
+}
+
+func reactionTarget(postID string, commentID *string) entity.ReactionTarget {
+	target := entity.ReactionTarget{PostID: postID}
+	if commentID != nil {
+		target.CommentID = *commentID
+	}
+	return target
+}
+
+// buildReactionSetModel leaves the reactions to their resolver, which loads them
+// for whoever receives the set.
+func buildReactionSetModel(target entity.ReactionTarget) *model.ReactionSet {
+	set := &model.ReactionSet{PostID: target.PostID}
+	if target.CommentID != "" {
+		set.CommentID = &target.CommentID
+	}
+	return set
+}
+
+// publishCommentAdded sends a newly published comment to the subscribers of its post.
+func (r *Resolver) publishCommentAdded(comment *entity.Comment) {
+	payload, err := json.Marshal(comment)
+	if err != nil {
+		logrus.Errorf("failed to marshal comment %s for subscribers: %v", comment.ID, err)
+		return
+	}
+	if err := r.Events.Publish(events.CommentAddedTopic(comment.PostID), payload); err != nil {
+		logrus.Errorf("failed to publish comment %s: %v", comment.ID, err)
+	}
+}
+
+// publishReactionsChanged tells the subscribers of the post that the reactions on
+// the target changed. Subscribers load the new counts themselves, so reactedByMe
+// is right for each of them.
+func (r *Resolver) publishReactionsChanged(target entity.ReactionTarget) {
+	payload, err := json.Marshal(target)
+	if err != nil {
+		logrus.Errorf("failed to marshal reaction target for subscribers: %v", err)
+		return
+	}
+	if err := r.Events.Publish(events.ReactionsChangedTopic(target.PostID), payload); err != nil {
+		logrus.Errorf("failed to publish reactions of post %s: %v", target.PostID, err)
+	}
+}
@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/apartapatia/wall_of_comments/graph/model"
+	"github.com/apartapatia/wall_of_comments/internal/auth"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/dataloader"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/service"
+)
+
+// loaderWait is how long a loader collects keys before it queries the database.
+// Sibling fields are resolved concurrently, so a short window is enough.
+const loaderWait = 2 * time.Millisecond
+
+type loadersKey struct{}
+
+// commentTreeKey identifies a subtree; subtrees with equal options share a query.
+type commentTreeKey struct {
+	root database.TreeRoot
+	opts database.TreeOptions
+}
+
+// Loaders batch the lookups made while a single response is resolved.
+type Loaders struct {
+	commentTrees *dataloader.Loader[commentTreeKey, []*entity.Comment]
+	users        *dataloader.Loader[string, *entity.User]
+	votes        *dataloader.Loader[string, entity.Vote]
+	reactions    *dataloader.Loader[entity.ReactionTarget, []*entity.ReactionCount]
+}
+
+// NewLoaders creates the loaders for one response; votes and reactions are loaded for actor.
+func NewLoaders(comments *service.CommentService, users *service.UserService, reactions *service.ReactionService, actor *entity.User) *Loaders {
+	return &Loaders{
+		commentTrees: dataloader.New(loaderWait, func(keys []commentTreeKey) (map[commentTreeKey][]*entity.Comment, error) {
+			groups := make(map[database.TreeOptions][]database.TreeRoot)
+			for _, key := range keys {
+				groups[key.opts] = append(groups[key.opts], key.root)
+			}
+
+			result := make(map[commentTreeKey][]*entity.Comment, len(keys))
+			for opts, roots := range groups {
+				trees, err := comments.GetCommentTrees(roots, opts)
+				if err != nil {
+					return nil, err
+				}
+				for root, tree := range trees {
+					result[commentTreeKey{root: root, opts: opts}] = tree
+				}
+			}
+			return result, nil
+		}),
+		users: dataloader.New(loaderWait, func(ids []string) (map[string]*entity.User, error) {
+			found, err := users.GetUsers(ids)
+			if err != nil {
+				return nil, err
+			}
+
+			result := make(map[string]*entity.User, len(found))
+			for _, user := range found {
+				result[user.ID] = user
+			}
+			return result, nil
+		}),
+		votes: dataloader.New(loaderWait, func(commentIDs []string) (map[string]entity.Vote, error) {
+			return comments.GetVotes(actor, commentIDs)
+		}),
+		reactions: dataloader.New(loaderWait, func(targets []entity.ReactionTarget) (map[entity.ReactionTarget][]*entity.ReactionCount, error) {
+			return reactions.GetReactions(actor, targets)
+		}),
+	}
+}
+
+// LoaderMiddleware gives every response its own loaders, so nothing is cached
+// across requests or between the events of a subscription.
+func LoaderMiddleware(comments *service.CommentService, users *service.UserService, reactions *service.ReactionService) graphql.ResponseMiddleware {
+	return func(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+		loaders := NewLoaders(comments, users, reactions, auth.UserFromContext(ctx))
+		return next(context.WithValue(ctx, loadersKey{}, loaders))
+	}
+}
+
+// commentTree loads a subtree through the loaders of the response, or directly
+// when the schema is served without LoaderMiddleware.
+func (r *Resolver) commentTree(ctx context.Context, root database.TreeRoot, opts database.TreeOptions) ([]*entity.Comment, error) {
+	loaders, ok := ctx.Value(loadersKey{}).(*Loaders)
+	if !ok {
+		trees, err := r.CommentService.GetCommentTrees([]database.TreeRoot{root}, opts)
+		if err != nil {
+			return nil, err
+		}
+		return trees[root], nil
+	}
+
+	return loaders.commentTrees.Load(ctx, commentTreeKey{root: root, opts: opts})
+}
+
+// author loads the author of a post or comment, or returns nil for content
+// without one or whose account no longer exists.
+func (r *Resolver) author(ctx context.Context, authorID string) (*model.User, error) {
+	if authorID == "" {
+		return nil, nil
+	}
+
+	var user *entity.User
+	var err error
+	if loaders, ok := ctx.Value(loadersKey{}).(*Loaders); ok {
+		user, err = loaders.users.Load(ctx, authorID)
+	} else {
+		user, err = r.UserService.GetUser(authorID)
+		if errors.Is(err, service.ErrUserNotFound) {
+			return nil, nil
+		}
+	}
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	return buildUserModel(user), nil
+}
+
+// myVote loads the vote of the current user on a comment, or returns nil for anonymous requests.
+func (r *Resolver) myVote(ctx context.Context, commentID string) (*model.VoteValue, error) {
+	actor := auth.UserFromContext(ctx)
+	if actor == nil {
+		return nil, nil
+	}
+
+	var vote entity.Vote
+	if loaders, ok := ctx.Value(loadersKey{}).(*Loaders); ok {
+		var err error
+		if vote, err = loaders.votes.Load(ctx, commentID); err != nil {
+			return nil, err
+		}
+	} else {
+		votes, err := r.CommentService.GetVotes(actor, []string{commentID})
+		if err != nil {
+			return nil, err
+		}
+		vote = votes[commentID]
+	}
+
+	value := buildVoteValue(vote)
+	return &value, nil
+}
+
+// reactions loads the reactions on a post or comment for the current user.
+func (r *Resolver) reactions(ctx context.Context, target entity.ReactionTarget) ([]*model.Reaction, error) {
+	var counts []*entity.ReactionCount
+	if loaders, ok := ctx.Value(loadersKey{}).(*Loaders); ok {
+		var err error
+		if counts, err = loaders.reactions.Load(ctx, target); err != nil {
+			return nil, err
+		}
+	} else {
+		reactions, err := r.ReactionService.GetReactions(auth.UserFromContext(ctx), []entity.ReactionTarget{target})
+		if err != nil {
+			return nil, err
+		}
+		counts = reactions[target]
+	}
+
+	return buildReactionModels(counts), nil
+}
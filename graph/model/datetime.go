@@ -0,0 +1,34 @@
+package model
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+var ErrInvalidDateTime = errors.New("DateTime must be an RFC 3339 string")
+
+// MarshalDateTime writes the DateTime scalar in UTC, keeping every fractional
+// digit the time carries.
+func MarshalDateTime(t time.Time) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		_, _ = io.WriteString(w, strconv.Quote(t.UTC().Format(time.RFC3339Nano)))
+	})
+}
+
+// UnmarshalDateTime reads the DateTime scalar in any time zone.
+func UnmarshalDateTime(v interface{}) (time.Time, error) {
+	value, ok := v.(string)
+	if !ok {
+		return time.Time{}, ErrInvalidDateTime
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, ErrInvalidDateTime
+	}
+	return t, nil
+}
@@ -2,31 +2,585 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type SearchResult interface {
+	IsSearchResult()
+}
+
+// A session token for the Authorization header, as in "Authorization: Bearer <token>".
+type AuthPayload struct {
+	Token string `json:"token"`
+	User  *User  `json:"user"`
+}
+
 type Comment struct {
-	ID        string     `json:"id"`
-	PostID    string     `json:"postId"`
-	ParentID  *string    `json:"parentId,omitempty"`
-	Content   string     `json:"content"`
-	CreatedAt string     `json:"createdAt"`
-	UpdatedAt string     `json:"updatedAt"`
-	Replies   []*Comment `json:"replies,omitempty"`
+	ID       string  `json:"id"`
+	PostID   string  `json:"postId"`
+	ParentID *string `json:"parentId,omitempty"`
+	// Replaced by [hidden] for hidden comments, unless the request is made by a moderator.
+	Content string `json:"content"`
+	Deleted bool   `json:"deleted"`
+	// True once a moderator hid the comment. Hidden comments keep their place in the
+	// thread, but only moderators see their content and revisions.
+	Hidden bool          `json:"hidden"`
+	Status CommentStatus `json:"status"`
+	// What the content filter found in the comment, like banned_word, too_many_links,
+	// repeated_chars, all_caps, duplicate or spam. Always empty unless the request is
+	// made by a moderator.
+	Tags      []string   `json:"tags"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+	// Upvotes minus downvotes.
+	Score     int `json:"score"`
+	Upvotes   int `json:"upvotes"`
+	Downvotes int `json:"downvotes"`
+	// The vote of the user the request is authenticated as, or null for anonymous requests.
+	MyVote *VoteValue `json:"myVote,omitempty"`
+	// Null for comments written before accounts existed.
+	Author    *User              `json:"author,omitempty"`
+	Reactions []*Reaction        `json:"reactions"`
+	Revisions []*CommentRevision `json:"revisions"`
+	Replies   []*Comment         `json:"replies,omitempty"`
+	// ID of the author, empty for comments written before accounts existed.
+	AuthorID string `json:"-"`
+}
+
+func (Comment) IsSearchResult() {}
+
+type CommentConnection struct {
+	Edges    []*CommentEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type CommentEdge struct {
+	Node   *Comment `json:"node"`
+	Cursor string   `json:"cursor"`
+}
+
+type CommentRevision struct {
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// A reported comment waiting for a moderator.
+type ModerationItem struct {
+	Comment     *Comment `json:"comment"`
+	ReportCount int      `json:"reportCount"`
+	// The open reports on the comment, oldest first.
+	Reports []*Report `json:"reports"`
 }
 
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
 type Post struct {
-	ID             string     `json:"id"`
-	Title          string     `json:"title"`
-	Content        string     `json:"content"`
-	CommentsActive bool       `json:"commentsActive"`
-	CreatedAt      string     `json:"createdAt"`
-	UpdatedAt      string     `json:"updatedAt"`
-	Comments       []*Comment `json:"comments,omitempty"`
+	ID             string         `json:"id"`
+	Title          string         `json:"title"`
+	Content        string         `json:"content"`
+	ModerationMode ModerationMode `json:"moderationMode"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+	// Upvotes minus downvotes, summed over the votes ever cast on the post's comments.
+	Score     int `json:"score"`
+	Upvotes   int `json:"upvotes"`
+	Downvotes int `json:"downvotes"`
+	// Null for posts written before accounts existed.
+	Author    *User       `json:"author,omitempty"`
+	Reactions []*Reaction `json:"reactions"`
+	Comments  []*Comment  `json:"comments,omitempty"`
+	// ID of the author, empty for posts written before accounts existed.
+	AuthorID string `json:"-"`
+}
+
+func (Post) IsSearchResult() {}
+
+type PostConnection struct {
+	Edges    []*PostEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type PostEdge struct {
+	Node   *Post  `json:"node"`
+	Cursor string `json:"cursor"`
 }
 
 type Query struct {
 }
 
+// An emoji users put on a post or comment, in the order of Query.reactionEmojis.
+// Emojis nobody reacted with are left out.
+type Reaction struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+	// False for anonymous requests.
+	ReactedByMe bool `json:"reactedByMe"`
+}
+
+// The reactions on a post, or on one of its comments when commentId is set.
+type ReactionSet struct {
+	PostID    string      `json:"postId"`
+	CommentID *string     `json:"commentId,omitempty"`
+	Reactions []*Reaction `json:"reactions"`
+}
+
+type Report struct {
+	ID        string       `json:"id"`
+	CommentID string       `json:"commentId"`
+	Reason    string       `json:"reason"`
+	Status    ReportStatus `json:"status"`
+	// The user who reported the comment.
+	Reporter  *User     `json:"reporter,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ID of the user who reported the comment.
+	UserID string `json:"-"`
+}
+
+type SearchConnection struct {
+	Edges    []*SearchEdge `json:"edges"`
+	PageInfo *PageInfo     `json:"pageInfo"`
+}
+
+type SearchEdge struct {
+	// A Post or a Comment, as asked for by the type argument of Query.search.
+	Node   SearchResult `json:"node"`
+	Cursor string       `json:"cursor"`
+	// How well the node matches the query, higher first. Only comparable within one search.
+	Rank float64 `json:"rank"`
+	// Up to 20 words of the content around the first match. Matched words are wrapped
+	// in <b></b> and the rest is HTML-escaped.
+	Snippet string `json:"snippet"`
+}
+
 type Subscription struct {
 }
+
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// The order of comments among their siblings. TOP ranks by the number of direct
+// replies only and ignores votes; BEST is the order by votes. CONTROVERSIAL ranks
+// by votes and direct replies together, weighted by how evenly the votes split
+// between up and down; a comment without both scores zero. Ties in both TOP and
+// CONTROVERSIAL are broken as in OLDEST. HOT ranks by votes decaying with age and
+// BEST by the share of upvotes, trusting more votes more; ties are broken as in
+// NEWEST.
+type CommentSort string
+
+const (
+	CommentSortOldest        CommentSort = "OLDEST"
+	CommentSortNewest        CommentSort = "NEWEST"
+	CommentSortTop           CommentSort = "TOP"
+	CommentSortControversial CommentSort = "CONTROVERSIAL"
+	CommentSortHot           CommentSort = "HOT"
+	CommentSortBest          CommentSort = "BEST"
+)
+
+var AllCommentSort = []CommentSort{
+	CommentSortOldest,
+	CommentSortNewest,
+	CommentSortTop,
+	CommentSortControversial,
+	CommentSortHot,
+	CommentSortBest,
+}
+
+func (e CommentSort) IsValid() bool {
+	switch e {
+	case CommentSortOldest, CommentSortNewest, CommentSortTop, CommentSortControversial, CommentSortHot, CommentSortBest:
+		return true
+	}
+	return false
+}
+
+func (e CommentSort) String() string {
+	return string(e)
+}
+
+func (e *CommentSort) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CommentSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CommentSort", str)
+	}
+	return nil
+}
+
+func (e CommentSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// PENDING comments wait for a moderator on a premoderated post. Only their author
+// and moderators see them.
+type CommentStatus string
+
+const (
+	CommentStatusPublished CommentStatus = "PUBLISHED"
+	CommentStatusPending   CommentStatus = "PENDING"
+)
+
+var AllCommentStatus = []CommentStatus{
+	CommentStatusPublished,
+	CommentStatusPending,
+}
+
+func (e CommentStatus) IsValid() bool {
+	switch e {
+	case CommentStatusPublished, CommentStatusPending:
+		return true
+	}
+	return false
+}
+
+func (e CommentStatus) String() string {
+	return string(e)
+}
+
+func (e *CommentStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CommentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CommentStatus", str)
+	}
+	return nil
+}
+
+func (e CommentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// Who may comment on a post. OPEN posts take comments from every COMMENTER,
+// PREMODERATED posts keep new comments PENDING until a moderator approves them,
+// and CLOSED posts take no new comments.
+type ModerationMode string
+
+const (
+	ModerationModeOpen         ModerationMode = "OPEN"
+	ModerationModePremoderated ModerationMode = "PREMODERATED"
+	ModerationModeClosed       ModerationMode = "CLOSED"
+)
+
+var AllModerationMode = []ModerationMode{
+	ModerationModeOpen,
+	ModerationModePremoderated,
+	ModerationModeClosed,
+}
+
+func (e ModerationMode) IsValid() bool {
+	switch e {
+	case ModerationModeOpen, ModerationModePremoderated, ModerationModeClosed:
+		return true
+	}
+	return false
+}
+
+func (e ModerationMode) String() string {
+	return string(e)
+}
+
+func (e *ModerationMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ModerationMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ModerationMode", str)
+	}
+	return nil
+}
+
+func (e ModerationMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OwnedResource string
+
+const (
+	OwnedResourcePost    OwnedResource = "POST"
+	OwnedResourceComment OwnedResource = "COMMENT"
+)
+
+var AllOwnedResource = []OwnedResource{
+	OwnedResourcePost,
+	OwnedResourceComment,
+}
+
+func (e OwnedResource) IsValid() bool {
+	switch e {
+	case OwnedResourcePost, OwnedResourceComment:
+		return true
+	}
+	return false
+}
+
+func (e OwnedResource) String() string {
+	return string(e)
+}
+
+func (e *OwnedResource) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OwnedResource(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OwnedResource", str)
+	}
+	return nil
+}
+
+func (e OwnedResource) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// HOT and BEST rank posts as CommentSort does, by the votes on their comments.
+type PostSort string
+
+const (
+	PostSortOldest PostSort = "OLDEST"
+	PostSortNewest PostSort = "NEWEST"
+	PostSortHot    PostSort = "HOT"
+	PostSortBest   PostSort = "BEST"
+)
+
+var AllPostSort = []PostSort{
+	PostSortOldest,
+	PostSortNewest,
+	PostSortHot,
+	PostSortBest,
+}
+
+func (e PostSort) IsValid() bool {
+	switch e {
+	case PostSortOldest, PostSortNewest, PostSortHot, PostSortBest:
+		return true
+	}
+	return false
+}
+
+func (e PostSort) String() string {
+	return string(e)
+}
+
+func (e *PostSort) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PostSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PostSort", str)
+	}
+	return nil
+}
+
+func (e PostSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// OPEN until a moderator acts on it: RESOLVED when the comment was hidden and
+// DISMISSED when the report was rejected or the comment approved.
+type ReportStatus string
+
+const (
+	ReportStatusOpen      ReportStatus = "OPEN"
+	ReportStatusResolved  ReportStatus = "RESOLVED"
+	ReportStatusDismissed ReportStatus = "DISMISSED"
+)
+
+var AllReportStatus = []ReportStatus{
+	ReportStatusOpen,
+	ReportStatusResolved,
+	ReportStatusDismissed,
+}
+
+func (e ReportStatus) IsValid() bool {
+	switch e {
+	case ReportStatusOpen, ReportStatusResolved, ReportStatusDismissed:
+		return true
+	}
+	return false
+}
+
+func (e ReportStatus) String() string {
+	return string(e)
+}
+
+func (e *ReportStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReportStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReportStatus", str)
+	}
+	return nil
+}
+
+func (e ReportStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// Each role may do everything the roles above it may. READERS may only read,
+// COMMENTERS may also write and change what they wrote themselves, MODERATORS
+// may change any post or comment, and ADMINS may also change roles.
+type Role string
+
+const (
+	RoleReader    Role = "READER"
+	RoleCommenter Role = "COMMENTER"
+	RoleModerator Role = "MODERATOR"
+	RoleAdmin     Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleReader,
+	RoleCommenter,
+	RoleModerator,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleReader, RoleCommenter, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SearchType string
+
+const (
+	SearchTypePost    SearchType = "POST"
+	SearchTypeComment SearchType = "COMMENT"
+)
+
+var AllSearchType = []SearchType{
+	SearchTypePost,
+	SearchTypeComment,
+}
+
+func (e SearchType) IsValid() bool {
+	switch e {
+	case SearchTypePost, SearchTypeComment:
+		return true
+	}
+	return false
+}
+
+func (e SearchType) String() string {
+	return string(e)
+}
+
+func (e *SearchType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SearchType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SearchType", str)
+	}
+	return nil
+}
+
+func (e SearchType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// NONE takes a vote back.
+type VoteValue string
+
+const (
+	VoteValueUp   VoteValue = "UP"
+	VoteValueDown VoteValue = "DOWN"
+	VoteValueNone VoteValue = "NONE"
+)
+
+var AllVoteValue = []VoteValue{
+	VoteValueUp,
+	VoteValueDown,
+	VoteValueNone,
+}
+
+func (e VoteValue) IsValid() bool {
+	switch e {
+	case VoteValueUp, VoteValueDown, VoteValueNone:
+		return true
+	}
+	return false
+}
+
+func (e VoteValue) String() string {
+	return string(e)
+}
+
+func (e *VoteValue) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = VoteValue(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid VoteValue", str)
+	}
+	return nil
+}
+
+func (e VoteValue) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -1,7 +1,8 @@
 package graph
 
 import (
-	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/events"
+	"github.com/apartapatia/wall_of_comments/internal/service"
 )
 
 // This file will not be regenerated automatically.
@@ -9,5 +10,11 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	Repo database.Repo
+	PostService       *service.PostService
+	CommentService    *service.CommentService
+	UserService       *service.UserService
+	ReactionService   *service.ReactionService
+	SearchService     *service.SearchService
+	ModerationService *service.ModerationService
+	Events            events.Bus
 }
@@ -0,0 +1,924 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/apartapatia/wall_of_comments/graph/model"
+	"github.com/apartapatia/wall_of_comments/internal/auth"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/database/memory"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/events"
+	"github.com/apartapatia/wall_of_comments/internal/filter"
+	"github.com/apartapatia/wall_of_comments/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepo counts the comment tree, user and vote queries that reach the database.
+type countingRepo struct {
+	database.Repo
+	treeQueries atomic.Int32
+	userQueries atomic.Int32
+	voteQueries atomic.Int32
+}
+
+func (r *countingRepo) GetCommentVotes(userID string, commentIDs []string) (map[string]entity.Vote, error) {
+	r.voteQueries.Add(1)
+	return r.Repo.GetCommentVotes(userID, commentIDs)
+}
+
+func (r *countingRepo) GetCommentTrees(roots []database.TreeRoot, opts database.TreeOptions) (map[database.TreeRoot][]*entity.Comment, error) {
+	r.treeQueries.Add(1)
+	return r.Repo.GetCommentTrees(roots, opts)
+}
+
+func (r *countingRepo) GetUsers(ids []string) ([]*entity.User, error) {
+	r.userQueries.Add(1)
+	return r.Repo.GetUsers(ids)
+}
+
+// subscribedBus reports every topic subscribed to, so a test can wait for its
+// subscription to be in place before it triggers an event.
+type subscribedBus struct {
+	events.Bus
+	subscribed chan string
+}
+
+func (b *subscribedBus) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	ch, err := b.Bus.Subscribe(ctx, topic)
+	b.subscribed <- topic
+	return ch, err
+}
+
+// testServer serves the schema the way server.go does, behind the auth middleware.
+type testServer struct {
+	handler http.Handler
+	repo    *countingRepo
+	bus     *subscribedBus
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	repo := &countingRepo{Repo: memory.NewRepo()}
+	tokens := auth.NewTokens([]byte("secret"), time.Hour)
+	bus := &subscribedBus{Bus: events.NewMemoryBus(), subscribed: make(chan string, 16)}
+	filters := filter.NewPipeline(filter.NewBannedWords([]string{"casino"}, filter.Reject), filter.NewRepeatedChars(10, filter.Tag))
+	resolver := &Resolver{
+		PostService:       service.NewPostService(repo),
+		CommentService:    service.NewCommentService(repo, filters),
+		UserService:       service.NewUserService(repo, tokens),
+		ReactionService:   service.NewReactionService(repo, nil),
+		SearchService:     service.NewSearchService(repo),
+		ModerationService: service.NewModerationService(repo, nil),
+		Events:            bus,
+	}
+
+	srv := handler.NewDefaultServer(NewExecutableSchema(NewConfig(resolver)))
+	srv.SetErrorPresenter(ErrorPresenter)
+	srv.AroundResponses(LoaderMiddleware(resolver.CommentService, resolver.UserService, resolver.ReactionService))
+
+	return &testServer{handler: auth.Middleware(tokens, resolver.UserService)(srv), repo: repo, bus: bus}
+}
+
+// clientFor registers a user with the given name and returns a client authenticated as that user.
+func (s *testServer) clientFor(t *testing.T, name string) *client.Client {
+	t.Helper()
+	var resp struct {
+		Register struct{ Token string }
+	}
+	client.New(s.handler).MustPost(`mutation($name: String!) { register(name: $name, password: "password1") { token } }`,
+		&resp, client.Var("name", name))
+	return client.New(s.handler, client.AddHeader("Authorization", "Bearer "+resp.Register.Token))
+}
+
+func setupTestClient(t *testing.T) *client.Client {
+	t.Helper()
+	c, _ := setupCountingClient(t)
+	return c
+}
+
+func setupCountingClient(t *testing.T) (*client.Client, *countingRepo) {
+	t.Helper()
+	s := newTestServer(t)
+	return s.clientFor(t, "alice"), s.repo
+}
+
+func createPost(t *testing.T, c *client.Client, mode model.ModerationMode) string {
+	t.Helper()
+	var resp struct {
+		CreatePost struct{ ID string }
+	}
+	c.MustPost(`mutation($mode: ModerationMode) { createPost(title: "Post 1", content: "Content 1", moderationMode: $mode) { id } }`,
+		&resp, client.Var("mode", mode))
+	return resp.CreatePost.ID
+}
+
+func createComment(t *testing.T, c *client.Client, postID string, parentID *string, content string) string {
+	t.Helper()
+	var resp struct {
+		CreateComment struct{ ID string }
+	}
+	c.MustPost(`mutation($postId: ID!, $parentId: ID, $content: String!) { createComment(postId: $postId, parentId: $parentId, content: $content) { id } }`,
+		&resp, client.Var("postId", postID), client.Var("parentId", parentID), client.Var("content", content))
+	return resp.CreateComment.ID
+}
+
+// errorCode returns the "code" extension of the first error in the response.
+func errorCode(t *testing.T, resp *client.Response) string {
+	t.Helper()
+	var errs []struct {
+		Extensions map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal(resp.Errors, &errs))
+	require.NotEmpty(t, errs)
+
+	code, _ := errs[0].Extensions["code"].(string)
+	return code
+}
+
+func TestResolver_PostWithNestedComments(t *testing.T) {
+	c := setupTestClient(t)
+
+	postID := createPost(t, c, model.ModerationModeOpen)
+	parentID := createComment(t, c, postID, nil, "Content comment 1")
+	createComment(t, c, postID, &parentID, "Content comment 2")
+
+	var resp struct {
+		Post struct {
+			Title    string
+			Comments []struct {
+				Content string
+				Replies []struct{ Content string }
+			}
+		}
+	}
+	c.MustPost(`query($id: ID!) { post(id: $id) { title comments { content replies { content } } } }`, &resp, client.Var("id", postID))
+
+	assert.Equal(t, "Post 1", resp.Post.Title)
+	require.Len(t, resp.Post.Comments, 1)
+	assert.Equal(t, "Content comment 1", resp.Post.Comments[0].Content)
+	require.Len(t, resp.Post.Comments[0].Replies, 1)
+	assert.Equal(t, "Content comment 2", resp.Post.Comments[0].Replies[0].Content)
+}
+
+func TestResolver_ErrorCodes(t *testing.T) {
+	c := setupTestClient(t)
+
+	resp, err := c.RawPost(`query { post(id: "missing") { id } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "POST_NOT_FOUND", errorCode(t, resp))
+
+	postID := createPost(t, c, model.ModerationModeClosed)
+	resp, err = c.RawPost(`mutation($postId: ID!) { createComment(postId: $postId, content: "Content comment 1") { id } }`, client.Var("postId", postID))
+	require.NoError(t, err)
+	assert.Equal(t, "COMMENTS_DISABLED", errorCode(t, resp))
+
+	resp, err = c.RawPost(`mutation { createPost(title: "", content: "Content 1") { id } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID_INPUT", errorCode(t, resp))
+
+	resp, err = c.RawPost(`query { postsConnection(first: -1) { edges { cursor } } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID_INPUT", errorCode(t, resp))
+
+	resp, err = c.RawPost(`query($postId: ID!) { comments(postID: $postId, limit: 2, offset: -1) { id } }`, client.Var("postId", postID))
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID_INPUT", errorCode(t, resp))
+
+	resp, err = c.RawPost(`query($postId: ID!) { comments(postID: $postId, limit: -1, offset: 0) { id } }`, client.Var("postId", postID))
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID_INPUT", errorCode(t, resp))
+}
+
+func TestResolver_UpdateAndDeleteComment(t *testing.T) {
+	c := setupTestClient(t)
+
+	postID := createPost(t, c, model.ModerationModeOpen)
+	parentID := createComment(t, c, postID, nil, "Content comment 1")
+	createComment(t, c, postID, &parentID, "Content comment 2")
+
+	var updated struct {
+		UpdateComment struct {
+			Content   string
+			EditedAt  *string
+			Revisions []struct{ Content string }
+		}
+	}
+	c.MustPost(`mutation($id: ID!) { updateComment(id: $id, content: "Edited comment 1") { content editedAt revisions { content } } }`,
+		&updated, client.Var("id", parentID))
+	assert.Equal(t, "Edited comment 1", updated.UpdateComment.Content)
+	assert.NotNil(t, updated.UpdateComment.EditedAt)
+	require.Len(t, updated.UpdateComment.Revisions, 1)
+	assert.Equal(t, "Content comment 1", updated.UpdateComment.Revisions[0].Content)
+
+	var deleted struct{ DeleteComment bool }
+	c.MustPost(`mutation($id: ID!) { deleteComment(id: $id) }`, &deleted, client.Var("id", parentID))
+	assert.True(t, deleted.DeleteComment)
+
+	resp, err := c.RawPost(`mutation($id: ID!) { updateComment(id: $id, content: "Edited comment 2") { id } }`, client.Var("id", parentID))
+	require.NoError(t, err)
+	assert.Equal(t, "COMMENT_DELETED", errorCode(t, resp))
+}
+
+func TestResolver_CommentsConnection(t *testing.T) {
+	c := setupTestClient(t)
+
+	postID := createPost(t, c, model.ModerationModeOpen)
+	for _, content := range []string{"Content comment 1", "Content comment 2", "Content comment 3"} {
+		createComment(t, c, postID, nil, content)
+	}
+
+	type page struct {
+		CommentsConnection struct {
+			Edges    []struct{ Node struct{ Content string } }
+			PageInfo struct {
+				HasNextPage bool
+				EndCursor   *string
+			}
+		}
+	}
+	query := `query($postId: ID!, $after: String) {
+		commentsConnection(postId: $postId, first: 2, after: $after) { edges { node { content } } pageInfo { hasNextPage endCursor } }
+	}`
+
+	var first page
+	c.MustPost(query, &first, client.Var("postId", postID), client.Var("after", nil))
+	assert.Len(t, first.CommentsConnection.Edges, 2)
+	assert.True(t, first.CommentsConnection.PageInfo.HasNextPage)
+	require.NotNil(t, first.CommentsConnection.PageInfo.EndCursor)
+
+	var second page
+	c.MustPost(query, &second, client.Var("postId", postID), client.Var("after", *first.CommentsConnection.PageInfo.EndCursor))
+	assert.Len(t, second.CommentsConnection.Edges, 1)
+	assert.False(t, second.CommentsConnection.PageInfo.HasNextPage)
+}
+
+func TestResolver_CommentTreeDepth(t *testing.T) {
+	c := setupTestClient(t)
+
+	postID := createPost(t, c, model.ModerationModeOpen)
+	rootID := createComment(t, c, postID, nil, "Content comment 1")
+	createComment(t, c, postID, nil, "Content comment 2")
+	replyID := createComment(t, c, postID, &rootID, "Content comment 3")
+	createComment(t, c, postID, &replyID, "Content comment 4")
+
+	type reply struct {
+		Content string
+		Replies []struct{ Content string }
+	}
+	var resp struct {
+		Post struct {
+			Comments []struct {
+				Replies []reply
+			}
+		}
+	}
+
+	// The third level is not part of the first fetch, so replies loads it on demand.
+	c.MustPost(`query($id: ID!) { post(id: $id) { comments(first: 1, depth: 2) { replies { content replies { content } } } } }`,
+		&resp, client.Var("id", postID))
+	require.Len(t, resp.Post.Comments, 1)
+	require.Len(t, resp.Post.Comments[0].Replies, 1)
+	assert.Equal(t, "Content comment 3", resp.Post.Comments[0].Replies[0].Content)
+	require.Len(t, resp.Post.Comments[0].Replies[0].Replies, 1)
+	assert.Equal(t, "Content comment 4", resp.Post.Comments[0].Replies[0].Replies[0].Content)
+
+	raw, err := c.RawPost(`query($id: ID!) { post(id: $id) { comments(depth: 11) { id } } }`, client.Var("id", postID))
+	require.NoError(t, err)
+	assert.Contains(t, string(raw.Errors), ErrInvalidTreeDepth.Error())
+}
+
+func TestResolver_CommentSort(t *testing.T) {
+	c := setupTestClient(t)
+
+	postID := createPost(t, c, model.ModerationModeOpen)
+	createComment(t, c, postID, nil, "Content comment 1")
+	rootID := createComment(t, c, postID, nil, "Content comment 2")
+	createComment(t, c, postID, &rootID, "Content comment 3")
+
+	var resp struct {
+		Post struct {
+			Comments []struct{ Content string }
+		}
+	}
+	c.MustPost(`query($id: ID!) { post(id: $id) { comments(sort: TOP, depth: 1) { content } } }`, &resp, client.Var("id", postID))
+	require.Len(t, resp.Post.Comments, 2)
+	assert.Equal(t, "Content comment 2", resp.Post.Comments[0].Content)
+	assert.Equal(t, "Content comment 1", resp.Post.Comments[1].Content)
+}
+
+func TestResolver_CommentsAreBatched(t *testing.T) {
+	c, repo := setupCountingClient(t)
+
+	for i := 0; i < 3; i++ {
+		postID := createPost(t, c, model.ModerationModeOpen)
+		rootID := createComment(t, c, postID, nil, "Content comment 1")
+		createComment(t, c, postID, &rootID, "Content comment 2")
+		createComment(t, c, postID, nil, "Content comment 3")
+	}
+
+	var titles struct {
+		Posts []struct{ ID, Title string }
+	}
+	c.MustPost(`query { posts { id title } }`, &titles)
+	assert.Len(t, titles.Posts, 3)
+	assert.Equal(t, int32(0), repo.treeQueries.Load())
+
+	var resp struct {
+		Posts []struct {
+			Comments []struct {
+				Replies []struct {
+					Replies []struct{ Content string }
+				}
+			}
+		}
+	}
+	c.MustPost(`query { posts { comments(depth: 1) { replies(depth: 1) { replies { content } } } } }`, &resp)
+	require.Len(t, resp.Posts, 3)
+	for _, post := range resp.Posts {
+		require.Len(t, post.Comments, 2)
+		require.Len(t, post.Comments[0].Replies, 1)
+		assert.Empty(t, post.Comments[0].Replies[0].Replies)
+	}
+	assert.Equal(t, int32(3), repo.treeQueries.Load(), "one query per level of the selection")
+
+	var page struct {
+		Posts []struct {
+			Comments []struct{ Content string }
+		}
+	}
+	c.MustPost(`query { posts { comments(limit: 1, offset: 1, depth: 1) { content } } }`, &page)
+	require.Len(t, page.Posts, 3)
+	for _, post := range page.Posts {
+		require.Len(t, post.Comments, 1)
+		assert.Equal(t, "Content comment 3", post.Comments[0].Content)
+	}
+}
+
+func TestResolver_DateTime(t *testing.T) {
+	c := setupTestClient(t)
+
+	postID := createPost(t, c, model.ModerationModeOpen)
+	var resp struct {
+		Post struct{ CreatedAt, UpdatedAt string }
+	}
+	c.MustPost(`query($id: ID!) { post(id: $id) { createdAt updatedAt } }`, &resp, client.Var("id", postID))
+
+	createdAt, err := time.Parse(time.RFC3339Nano, resp.Post.CreatedAt)
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, createdAt.Location())
+	assert.Equal(t, resp.Post.CreatedAt, resp.Post.UpdatedAt)
+	assert.True(t, createdAt.Equal(createdAt.Truncate(database.TimePrecision)))
+}
+
+func TestResolver_Authorship(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.clientFor(t, "alice")
+	bob := s.clientFor(t, "bob")
+	anonymous := client.New(s.handler)
+
+	var me struct {
+		Me *struct{ Name, Role string }
+	}
+	alice.MustPost(`query { me { name role } }`, &me)
+	require.NotNil(t, me.Me)
+	assert.Equal(t, "alice", me.Me.Name)
+	assert.Equal(t, "COMMENTER", me.Me.Role)
+	var anonymousMe struct {
+		Me *struct{ Name string }
+	}
+	anonymous.MustPost(`query { me { name } }`, &anonymousMe)
+	assert.Nil(t, anonymousMe.Me)
+
+	resp, err := anonymous.RawPost(`mutation { createPost(title: "Post 1", content: "Content 1") { id } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "UNAUTHENTICATED", errorCode(t, resp))
+
+	postID := createPost(t, alice, model.ModerationModeOpen)
+	commentID := createComment(t, bob, postID, nil, "Content comment 1")
+
+	var post struct {
+		Post struct {
+			Author   struct{ Name string }
+			Comments []struct {
+				Author struct{ Name string }
+			}
+		}
+	}
+	anonymous.MustPost(`query($id: ID!) { post(id: $id) { author { name } comments { author { name } } } }`, &post, client.Var("id", postID))
+	assert.Equal(t, "alice", post.Post.Author.Name)
+	require.Len(t, post.Post.Comments, 1)
+	assert.Equal(t, "bob", post.Post.Comments[0].Author.Name)
+
+	resp, err = alice.RawPost(`mutation($id: ID!) { updateComment(id: $id, content: "Edited comment 1") { id } }`, client.Var("id", commentID))
+	require.NoError(t, err)
+	assert.Equal(t, "FORBIDDEN", errorCode(t, resp))
+	resp, err = bob.RawPost(`mutation($id: ID!) { deletePost(id: $id) }`, client.Var("id", postID))
+	require.NoError(t, err)
+	assert.Equal(t, "FORBIDDEN", errorCode(t, resp))
+
+	resp, err = anonymous.RawPost(`mutation { login(name: "alice", password: "wrong password") { token } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID_CREDENTIALS", errorCode(t, resp))
+	resp, err = anonymous.RawPost(`mutation { register(name: "alice", password: "password1") { token } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "USER_EXISTS", errorCode(t, resp))
+
+	_, err = client.New(s.handler, client.AddHeader("Authorization", "Bearer garbage")).RawPost(`query { me { name } }`)
+	assert.Error(t, err, "a bad token is rejected with 401")
+}
+
+func (s *testServer) setRole(t *testing.T, name string, role entity.Role) string {
+	t.Helper()
+	user, err := s.repo.GetUserByName(name)
+	require.NoError(t, err)
+	_, err = s.repo.SetUserRole(user.ID, role)
+	require.NoError(t, err)
+	return user.ID
+}
+
+func TestResolver_RoleDirectives(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.clientFor(t, "alice")
+	bob := s.clientFor(t, "bob")
+	moderator := s.clientFor(t, "carol")
+	admin := s.clientFor(t, "dave")
+	s.setRole(t, "carol", entity.RoleModerator)
+	s.setRole(t, "dave", entity.RoleAdmin)
+
+	postID := createPost(t, alice, model.ModerationModeOpen)
+	commentID := createComment(t, alice, postID, nil, "Content comment 1")
+
+	resp, err := bob.RawPost(`mutation($id: ID!) { deleteComment(id: $id) }`, client.Var("id", commentID))
+	require.NoError(t, err)
+	assert.Equal(t, "FORBIDDEN", errorCode(t, resp))
+	resp, err = bob.RawPost(`mutation { deleteComment(id: "missing") }`)
+	require.NoError(t, err)
+	assert.Equal(t, "COMMENT_NOT_FOUND", errorCode(t, resp))
+
+	var deleted struct{ DeleteComment bool }
+	moderator.MustPost(`mutation($id: ID!) { deleteComment(id: $id) }`, &deleted, client.Var("id", commentID))
+	assert.True(t, deleted.DeleteComment)
+
+	var locked struct {
+		SetPostModerationMode struct{ ModerationMode string }
+	}
+	moderator.MustPost(`mutation($id: ID!) { setPostModerationMode(id: $id, mode: CLOSED) { moderationMode } }`, &locked, client.Var("id", postID))
+	assert.Equal(t, "CLOSED", locked.SetPostModerationMode.ModerationMode)
+
+	resp, err = moderator.RawPost(`mutation { setUserRole(id: "missing", role: ADMIN) { id } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "FORBIDDEN", errorCode(t, resp))
+
+	bobID := s.setRole(t, "bob", entity.RoleCommenter)
+	var promoted struct {
+		SetUserRole struct{ Name, Role string }
+	}
+	admin.MustPost(`mutation($id: ID!) { setUserRole(id: $id, role: READER) { name role } }`, &promoted, client.Var("id", bobID))
+	assert.Equal(t, "bob", promoted.SetUserRole.Name)
+	assert.Equal(t, "READER", promoted.SetUserRole.Role)
+
+	// The role is read on every request, so the new one applies to the token bob already has.
+	resp, err = bob.RawPost(`mutation { createPost(title: "Post 2", content: "Content 2") { id } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "FORBIDDEN", errorCode(t, resp))
+
+	resp, err = admin.RawPost(`mutation { setUserRole(id: "missing", role: ADMIN) { id } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "USER_NOT_FOUND", errorCode(t, resp))
+}
+
+func TestResolver_Votes(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.clientFor(t, "alice")
+	bob := s.clientFor(t, "bob")
+	anonymous := client.New(s.handler)
+
+	postID := createPost(t, alice, model.ModerationModeOpen)
+	rootID := createComment(t, alice, postID, nil, "Content comment 1")
+	replyID := createComment(t, alice, postID, &rootID, "Content comment 2")
+
+	type votedComment struct {
+		Score, Upvotes, Downvotes int
+		MyVote                    *string
+	}
+	vote := func(c *client.Client, id string, value string) votedComment {
+		t.Helper()
+		var resp struct{ VoteComment votedComment }
+		c.MustPost(`mutation($id: ID!, $value: VoteValue!) { voteComment(id: $id, value: $value) { score upvotes downvotes myVote } }`,
+			&resp, client.Var("id", id), client.Var("value", value))
+		return resp.VoteComment
+	}
+
+	voted := vote(alice, rootID, "UP")
+	assert.Equal(t, 1, voted.Score)
+	require.NotNil(t, voted.MyVote)
+	assert.Equal(t, "UP", *voted.MyVote)
+	vote(bob, rootID, "DOWN")
+	voted = vote(bob, rootID, "DOWN")
+	assert.Equal(t, votedComment{Score: 0, Upvotes: 1, Downvotes: 1, MyVote: voted.MyVote}, voted)
+	vote(bob, replyID, "UP")
+
+	var resp struct {
+		Post struct {
+			Comments []struct {
+				MyVote  *string
+				Score   int
+				Replies []struct {
+					MyVote *string
+					Score  int
+				}
+			}
+		}
+	}
+	query := `query($id: ID!) { post(id: $id) { comments { myVote score replies { myVote score } } } }`
+	before := s.repo.voteQueries.Load()
+	bob.MustPost(query, &resp, client.Var("id", postID))
+	require.Len(t, resp.Post.Comments, 1)
+	assert.Equal(t, "DOWN", *resp.Post.Comments[0].MyVote)
+	require.Len(t, resp.Post.Comments[0].Replies, 1)
+	assert.Equal(t, "UP", *resp.Post.Comments[0].Replies[0].MyVote)
+	assert.Equal(t, 1, resp.Post.Comments[0].Replies[0].Score)
+	assert.Equal(t, int32(1), s.repo.voteQueries.Load()-before, "votes of every comment in the response are loaded at once")
+
+	anonymous.MustPost(query, &resp, client.Var("id", postID))
+	assert.Nil(t, resp.Post.Comments[0].MyVote)
+	assert.Equal(t, 0, resp.Post.Comments[0].Score)
+
+	voted = vote(bob, rootID, "NONE")
+	assert.Equal(t, 1, voted.Score)
+	assert.Equal(t, "NONE", *voted.MyVote)
+
+	denied, err := anonymous.RawPost(`mutation($id: ID!) { voteComment(id: $id, value: UP) { score } }`, client.Var("id", rootID))
+	require.NoError(t, err)
+	assert.Equal(t, "UNAUTHENTICATED", errorCode(t, denied))
+}
+
+func TestResolver_RankedSort(t *testing.T) {
+	c := setupTestClient(t)
+
+	votedPostID := createPost(t, c, model.ModerationModeOpen)
+	createPost(t, c, model.ModerationModeOpen)
+	votedID := createComment(t, c, votedPostID, nil, "Content comment 1")
+	createComment(t, c, votedPostID, nil, "Content comment 2")
+	var voted struct {
+		VoteComment struct{ ID string }
+	}
+	c.MustPost(`mutation($id: ID!) { voteComment(id: $id, value: UP) { id } }`, &voted, client.Var("id", votedID))
+
+	var resp struct {
+		Posts []struct {
+			ID       string
+			Score    int
+			Comments []struct{ ID string }
+		}
+	}
+	c.MustPost(`{ posts(sort: BEST) { id score comments(sort: BEST) { id } } }`, &resp)
+	require.Len(t, resp.Posts, 2)
+	assert.Equal(t, votedPostID, resp.Posts[0].ID)
+	assert.Equal(t, 1, resp.Posts[0].Score)
+	require.Len(t, resp.Posts[0].Comments, 2)
+	assert.Equal(t, votedID, resp.Posts[0].Comments[0].ID, "BEST puts the upvoted comment before the newer one")
+
+	// A single vote adds nothing to HOT, so the newer post comes first.
+	c.MustPost(`{ posts(sort: HOT) { id score comments(sort: HOT) { id } } }`, &resp)
+	require.Len(t, resp.Posts, 2)
+	assert.Equal(t, votedPostID, resp.Posts[1].ID)
+}
+
+func TestResolver_Reactions(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.clientFor(t, "alice")
+	bob := s.clientFor(t, "bob")
+
+	postID := createPost(t, alice, model.ModerationModeOpen)
+	commentID := createComment(t, alice, postID, nil, "Content comment 1")
+
+	type reaction struct {
+		Emoji       string
+		Count       int
+		ReactedByMe bool
+	}
+	type reactionSet struct {
+		PostID    string
+		CommentID *string
+		Reactions []reaction
+	}
+	const fields = `postId commentId reactions { emoji count reactedByMe }`
+
+	var emojis struct{ ReactionEmojis []string }
+	alice.MustPost(`{ reactionEmojis }`, &emojis)
+	assert.Equal(t, service.DefaultReactionEmojis, emojis.ReactionEmojis)
+
+	sub := bob.Websocket(`subscription($postId: ID!) { reactionsChanged(postId: $postId) { `+fields+` } }`, client.Var("postId", postID))
+	defer sub.Close()
+	select {
+	case <-s.bus.subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the subscription")
+	}
+
+	var added struct{ AddReaction reactionSet }
+	alice.MustPost(`mutation($postId: ID!, $commentId: ID) { addReaction(postId: $postId, commentId: $commentId, emoji: "👍") { `+fields+` } }`,
+		&added, client.Var("postId", postID), client.Var("commentId", commentID))
+	require.NotNil(t, added.AddReaction.CommentID)
+	assert.Equal(t, []reaction{{Emoji: "👍", Count: 1, ReactedByMe: true}}, added.AddReaction.Reactions)
+
+	var event struct{ ReactionsChanged reactionSet }
+	require.NoError(t, sub.Next(&event))
+	assert.Equal(t, postID, event.ReactionsChanged.PostID)
+	require.NotNil(t, event.ReactionsChanged.CommentID)
+	assert.Equal(t, commentID, *event.ReactionsChanged.CommentID)
+	assert.Equal(t, []reaction{{Emoji: "👍", Count: 1}}, event.ReactionsChanged.Reactions, "reactedByMe is for the subscriber")
+
+	alice.MustPost(`mutation($postId: ID!) { addReaction(postId: $postId, emoji: "❤️") { postId } }`, &struct{ AddReaction struct{ PostID string } }{}, client.Var("postId", postID))
+	event = struct{ ReactionsChanged reactionSet }{}
+	require.NoError(t, sub.Next(&event))
+	assert.Nil(t, event.ReactionsChanged.CommentID)
+	assert.Equal(t, []reaction{{Emoji: "❤️", Count: 1}}, event.ReactionsChanged.Reactions)
+
+	var resp struct {
+		Post struct {
+			Reactions []reaction
+			Comments  []struct{ Reactions []reaction }
+		}
+	}
+	alice.MustPost(`query($id: ID!) { post(id: $id) { reactions { emoji count reactedByMe } comments { reactions { emoji count reactedByMe } } } }`,
+		&resp, client.Var("id", postID))
+	assert.Equal(t, []reaction{{Emoji: "❤️", Count: 1, ReactedByMe: true}}, resp.Post.Reactions)
+	require.Len(t, resp.Post.Comments, 1)
+	assert.Equal(t, []reaction{{Emoji: "👍", Count: 1, ReactedByMe: true}}, resp.Post.Comments[0].Reactions)
+
+	var removed struct{ RemoveReaction reactionSet }
+	alice.MustPost(`mutation($postId: ID!) { removeReaction(postId: $postId, emoji: "❤️") { `+fields+` } }`, &removed, client.Var("postId", postID))
+	assert.Empty(t, removed.RemoveReaction.Reactions)
+
+	invalid, err := alice.RawPost(`mutation($postId: ID!) { addReaction(postId: $postId, emoji: "🦄") { postId } }`, client.Var("postId", postID))
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID_INPUT", errorCode(t, invalid))
+}
+
+func TestResolver_Search(t *testing.T) {
+	c := setupTestClient(t)
+
+	postID := createPost(t, c, model.ModerationModeOpen)
+	createComment(t, c, postID, nil, "Looking for <answers>")
+	createComment(t, c, postID, nil, "Answers to everything")
+
+	type searchConnection struct {
+		Edges []struct {
+			Node struct {
+				Typename string `json:"__typename"`
+				ID       string
+				Title    string
+				PostID   string
+			}
+			Cursor  string
+			Rank    float64
+			Snippet string
+		}
+		PageInfo struct {
+			HasNextPage bool
+			EndCursor   *string
+		}
+	}
+	const query = `query($query: String!, $type: SearchType!, $after: String) {
+		search(query: $query, type: $type, first: 1, after: $after) {
+			edges { node { __typename ... on Post { id title } ... on Comment { id postId } } cursor rank snippet }
+			pageInfo { hasNextPage endCursor }
+		}
+	}`
+
+	var resp struct{ Search searchConnection }
+	c.MustPost(query, &resp, client.Var("query", "POST"), client.Var("type", "POST"))
+	require.Len(t, resp.Search.Edges, 1)
+	assert.Equal(t, "Post", resp.Search.Edges[0].Node.Typename)
+	assert.Equal(t, "Post 1", resp.Search.Edges[0].Node.Title)
+	assert.False(t, resp.Search.PageInfo.HasNextPage)
+
+	var first struct{ Search searchConnection }
+	c.MustPost(query, &first, client.Var("query", "answers"), client.Var("type", "COMMENT"))
+	require.Len(t, first.Search.Edges, 1)
+	assert.Equal(t, "Comment", first.Search.Edges[0].Node.Typename)
+	assert.Equal(t, postID, first.Search.Edges[0].Node.PostID)
+	assert.True(t, first.Search.PageInfo.HasNextPage)
+
+	var second struct{ Search searchConnection }
+	c.MustPost(query, &second, client.Var("query", "answers"), client.Var("type", "COMMENT"), client.Var("after", first.Search.PageInfo.EndCursor))
+	require.Len(t, second.Search.Edges, 1)
+	assert.False(t, second.Search.PageInfo.HasNextPage)
+	assert.ElementsMatch(t,
+		[]string{"Looking for &lt;<b>answers</b>&gt;", "<b>Answers</b> to everything"},
+		[]string{first.Search.Edges[0].Snippet, second.Search.Edges[0].Snippet})
+
+	resp2, err := c.RawPost(`{ search(query: "?!", type: POST) { edges { cursor } } }`)
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID_INPUT", errorCode(t, resp2))
+}
+
+func TestResolver_Moderation(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.clientFor(t, "alice")
+	bob := s.clientFor(t, "bob")
+	moderator := s.clientFor(t, "carol")
+	s.setRole(t, "carol", entity.RoleModerator)
+
+	postID := createPost(t, alice, model.ModerationModeOpen)
+	commentID := createComment(t, alice, postID, nil, "Buy cheap watches")
+	createComment(t, alice, postID, &commentID, "Content comment 2")
+
+	const report = `mutation($id: ID!) { reportComment(id: $id, reason: "spam") { id commentId reason status reporter { name } } }`
+	var reported struct {
+		ReportComment struct {
+			ID, CommentID, Reason, Status string
+			Reporter                      struct{ Name string }
+		}
+	}
+	bob.MustPost(report, &reported, client.Var("id", commentID))
+	assert.Equal(t, commentID, reported.ReportComment.CommentID)
+	assert.Equal(t, "OPEN", reported.ReportComment.Status)
+	assert.Equal(t, "bob", reported.ReportComment.Reporter.Name)
+	resp, err := bob.RawPost(report, client.Var("id", commentID))
+	require.NoError(t, err)
+	assert.Equal(t, "ALREADY_REPORTED", errorCode(t, resp))
+	alice.MustPost(report, &reported, client.Var("id", commentID))
+
+	const queue = `query { moderationQueue { comment { id content } reportCount reports { reporter { name } } } }`
+	resp, err = bob.RawPost(queue)
+	require.NoError(t, err)
+	assert.Equal(t, "FORBIDDEN", errorCode(t, resp))
+	var queued struct {
+		ModerationQueue []struct {
+			Comment     struct{ ID, Content string }
+			ReportCount int
+			Reports     []struct{ Reporter struct{ Name string } }
+		}
+	}
+	moderator.MustPost(queue, &queued)
+	require.Len(t, queued.ModerationQueue, 1)
+	assert.Equal(t, commentID, queued.ModerationQueue[0].Comment.ID)
+	assert.Equal(t, 2, queued.ModerationQueue[0].ReportCount)
+	require.Len(t, queued.ModerationQueue[0].Reports, 2)
+	assert.Equal(t, "bob", queued.ModerationQueue[0].Reports[0].Reporter.Name, "reports are oldest first")
+
+	var hidden struct {
+		HideComment struct {
+			Hidden  bool
+			Content string
+		}
+	}
+	moderator.MustPost(`mutation($id: ID!) { hideComment(id: $id) { hidden content } }`, &hidden, client.Var("id", commentID))
+	assert.True(t, hidden.HideComment.Hidden)
+	assert.Equal(t, "Buy cheap watches", hidden.HideComment.Content)
+
+	const thread = `query($id: ID!) { post(id: $id) { comments { hidden content revisions { content } replies { content } } } }`
+	type threadResponse struct {
+		Post struct {
+			Comments []struct {
+				Hidden    bool
+				Content   string
+				Revisions []struct{ Content string }
+				Replies   []struct{ Content string }
+			}
+		}
+	}
+	var regular threadResponse
+	bob.MustPost(thread, &regular, client.Var("id", postID))
+	require.Len(t, regular.Post.Comments, 1, "hidden comments keep their place in the thread")
+	assert.True(t, regular.Post.Comments[0].Hidden)
+	assert.Equal(t, entity.HiddenCommentContent, regular.Post.Comments[0].Content)
+	assert.Len(t, regular.Post.Comments[0].Replies, 1, "replies to hidden comments stay visible")
+	var moderated threadResponse
+	moderator.MustPost(thread, &moderated, client.Var("id", postID))
+	require.Len(t, moderated.Post.Comments, 1)
+	assert.Equal(t, "Buy cheap watches", moderated.Post.Comments[0].Content)
+
+	moderator.MustPost(queue, &queued)
+	assert.Empty(t, queued.ModerationQueue, "hiding resolves the reports")
+
+	bob.MustPost(report, &reported, client.Var("id", commentID))
+	var dismissed struct{ DismissReport bool }
+	moderator.MustPost(`mutation($id: ID!) { dismissReport(id: $id) }`, &dismissed, client.Var("id", reported.ReportComment.ID))
+	assert.True(t, dismissed.DismissReport)
+	resp, err = moderator.RawPost(`mutation($id: ID!) { dismissReport(id: $id) }`, client.Var("id", reported.ReportComment.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "REPORT_NOT_FOUND", errorCode(t, resp))
+
+	var approved struct {
+		ApproveComment struct{ Hidden bool }
+	}
+	moderator.MustPost(`mutation($id: ID!) { approveComment(id: $id) { hidden } }`, &approved, client.Var("id", commentID))
+	assert.False(t, approved.ApproveComment.Hidden)
+	var visible threadResponse
+	bob.MustPost(thread, &visible, client.Var("id", postID))
+	require.Len(t, visible.Post.Comments, 1)
+	assert.Equal(t, "Buy cheap watches", visible.Post.Comments[0].Content)
+}
+
+func TestResolver_Premoderation(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.clientFor(t, "alice")
+	bob := s.clientFor(t, "bob")
+	moderator := s.clientFor(t, "carol")
+	s.setRole(t, "carol", entity.RoleModerator)
+
+	postID := createPost(t, alice, model.ModerationModePremoderated)
+
+	sub := bob.Websocket(`subscription($postId: ID!) { commentAdded(postId: $postId) { id status } }`, client.Var("postId", postID))
+	defer sub.Close()
+	select {
+	case <-s.bus.subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the subscription")
+	}
+
+	var created struct {
+		CreateComment struct{ ID, Status string }
+	}
+	alice.MustPost(`mutation($postId: ID!) { createComment(postId: $postId, content: "Content comment 1") { id status } }`,
+		&created, client.Var("postId", postID))
+	assert.Equal(t, "PENDING", created.CreateComment.Status)
+	commentID := created.CreateComment.ID
+
+	const thread = `query($id: ID!) { post(id: $id) { moderationMode comments { id status } } }`
+	type threadResponse struct {
+		Post struct {
+			ModerationMode string
+			Comments       []struct{ ID, Status string }
+		}
+	}
+	var others threadResponse
+	bob.MustPost(thread, &others, client.Var("id", postID))
+	assert.Equal(t, "PREMODERATED", others.Post.ModerationMode)
+	assert.Empty(t, others.Post.Comments, "pending comments are only shown to their author and moderators")
+	var own threadResponse
+	alice.MustPost(thread, &own, client.Var("id", postID))
+	require.Len(t, own.Post.Comments, 1)
+	assert.Equal(t, "PENDING", own.Post.Comments[0].Status)
+
+	const pending = `query { pendingComments { id } }`
+	resp, err := bob.RawPost(pending)
+	require.NoError(t, err)
+	assert.Equal(t, "FORBIDDEN", errorCode(t, resp))
+	var queued struct{ PendingComments []struct{ ID string } }
+	moderator.MustPost(pending, &queued)
+	require.Len(t, queued.PendingComments, 1)
+	assert.Equal(t, commentID, queued.PendingComments[0].ID)
+
+	var approved struct {
+		ApproveComment struct{ Status string }
+	}
+	moderator.MustPost(`mutation($id: ID!) { approveComment(id: $id) { status } }`, &approved, client.Var("id", commentID))
+	assert.Equal(t, "PUBLISHED", approved.ApproveComment.Status)
+
+	var event struct {
+		CommentAdded struct{ ID, Status string }
+	}
+	require.NoError(t, sub.Next(&event))
+	assert.Equal(t, commentID, event.CommentAdded.ID, "the comment is announced once it is approved")
+	assert.Equal(t, "PUBLISHED", event.CommentAdded.Status)
+
+	var published threadResponse
+	bob.MustPost(thread, &published, client.Var("id", postID))
+	require.Len(t, published.Post.Comments, 1)
+	moderator.MustPost(pending, &queued)
+	assert.Empty(t, queued.PendingComments)
+}
+
+func TestResolver_ContentFilter(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.clientFor(t, "alice")
+	moderator := s.clientFor(t, "carol")
+	s.setRole(t, "carol", entity.RoleModerator)
+
+	postID := createPost(t, alice, model.ModerationModeOpen)
+
+	resp, err := alice.RawPost(`mutation($postId: ID!) { createComment(postId: $postId, content: "Best casino in town") { id } }`,
+		client.Var("postId", postID))
+	require.NoError(t, err)
+	assert.Equal(t, "CONTENT_REJECTED", errorCode(t, resp))
+
+	createComment(t, alice, postID, nil, "Wow!!!!!!!!!!!!")
+
+	const thread = `query($id: ID!) { post(id: $id) { comments { tags } } }`
+	type threadResponse struct {
+		Post struct {
+			Comments []struct{ Tags []string }
+		}
+	}
+	var own, moderated threadResponse
+	alice.MustPost(thread, &own, client.Var("id", postID))
+	require.Len(t, own.Post.Comments, 1)
+	assert.Empty(t, own.Post.Comments[0].Tags, "tags are for moderators")
+	moderator.MustPost(thread, &moderated, client.Var("id", postID))
+	require.Len(t, moderated.Post.Comments, 1)
+	assert.Equal(t, []string{"repeated_chars"}, moderated.Post.Comments[0].Tags)
+}
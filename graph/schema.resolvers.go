@@ -6,208 +6,577 @@ package graph
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/apartapatia/wall_of_comments/graph/model"
+	"github.com/apartapatia/wall_of_comments/internal/auth"
+	"github.com/apartapatia/wall_of_comments/internal/database"
 	"github.com/apartapatia/wall_of_comments/internal/entity"
-	"github.com/google/uuid"
+	"github.com/apartapatia/wall_of_comments/internal/events"
+	"github.com/apartapatia/wall_of_comments/internal/service"
+	"github.com/sirupsen/logrus"
 )
 
+// MyVote is the resolver for the myVote field.
+func (r *commentResolver) MyVote(ctx context.Context, obj *model.Comment) (*model.VoteValue, error) {
+	return r.myVote(ctx, obj.ID)
+}
+
+// Author is the resolver for the author field.
+func (r *commentResolver) Author(ctx context.Context, obj *model.Comment) (*model.User, error) {
+	return r.author(ctx, obj.AuthorID)
+}
+
+// Reactions is the resolver for the reactions field.
+func (r *commentResolver) Reactions(ctx context.Context, obj *model.Comment) ([]*model.Reaction, error) {
+	return r.reactions(ctx, entity.ReactionTarget{PostID: obj.PostID, CommentID: obj.ID})
+}
+
+// Revisions is the resolver for the revisions field.
+func (r *commentResolver) Revisions(ctx context.Context, obj *model.Comment) ([]*model.CommentRevision, error) {
+	if obj.Deleted || (obj.Hidden && !service.CanSeeHidden(auth.UserFromContext(ctx))) {
+		return []*model.CommentRevision{}, nil
+	}
+
+	revisions, err := r.CommentService.GetRevisions(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	revisionModels := make([]*model.CommentRevision, 0, len(revisions))
+	for _, revision := range revisions {
+		revisionModels = append(revisionModels, &model.CommentRevision{
+			Content:   revision.Content,
+			CreatedAt: revision.CreatedAt,
+		})
+	}
+
+	return revisionModels, nil
+}
+
+// Replies is the resolver for the replies field.
+func (r *commentResolver) Replies(ctx context.Context, obj *model.Comment, first *int, depth *int, sort *model.CommentSort) ([]*model.Comment, error) {
+	if first == nil && depth == nil && sort == nil && obj.Replies != nil {
+		return obj.Replies, nil
+	}
+
+	opts, err := treeOptions(auth.UserFromContext(ctx), first, depth, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := r.commentTree(ctx, database.TreeRoot{PostID: obj.PostID, ParentID: obj.ID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildCommentTree(auth.UserFromContext(ctx), comments, &obj.ID, opts.MaxDepth), nil
+}
+
+// Register is the resolver for the register field.
+func (r *mutationResolver) Register(ctx context.Context, name string, password string) (*model.AuthPayload, error) {
+	session, err := r.UserService.Register(name, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildAuthPayload(session), nil
+}
+
+// Login is the resolver for the login field.
+func (r *mutationResolver) Login(ctx context.Context, name string, password string) (*model.AuthPayload, error) {
+	session, err := r.UserService.Login(name, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildAuthPayload(session), nil
+}
+
+// SetUserRole is the resolver for the setUserRole field.
+func (r *mutationResolver) SetUserRole(ctx context.Context, id string, role model.Role) (*model.User, error) {
+	user, err := r.UserService.SetRole(auth.UserFromContext(ctx), id, entityRole(role))
+	if err != nil {
+		return nil, err
+	}
+
+	return buildUserModel(user), nil
+}
+
 // CreatePost is the resolver for the createPost field.
-func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, commentsDisabled bool) (*model.Post, error) {
-	post := &entity.Post{
-		ID:             uuid.New().String(),
-		Title:          title,
-		Content:        content,
-		CommentsActive: !commentsDisabled,
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, moderationMode *model.ModerationMode) (*model.Post, error) {
+	mode := entity.ModerationOpen
+	if moderationMode != nil {
+		mode = entityModerationMode(*moderationMode)
+	}
+	savedPost, err := r.PostService.CreatePost(auth.UserFromContext(ctx), title, content, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildPostModel(savedPost), nil
+}
+
+// UpdatePost is the resolver for the updatePost field.
+func (r *mutationResolver) UpdatePost(ctx context.Context, id string, title *string, content *string) (*model.Post, error) {
+	updatedPost, err := r.PostService.UpdatePost(auth.UserFromContext(ctx), id, title, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildPostModel(updatedPost), nil
+}
+
+// DeletePost is the resolver for the deletePost field.
+func (r *mutationResolver) DeletePost(ctx context.Context, id string) (bool, error) {
+	if err := r.PostService.DeletePost(auth.UserFromContext(ctx), id); err != nil {
+		return false, err
 	}
 
-	savedPost, err := createAndSaveEntity(post, r.Repo.CreatePost)
+	return true, nil
+}
+
+// SetPostModerationMode is the resolver for the setPostModerationMode field.
+func (r *mutationResolver) SetPostModerationMode(ctx context.Context, id string, mode model.ModerationMode) (*model.Post, error) {
+	post, err := r.PostService.SetModerationMode(auth.UserFromContext(ctx), id, entityModerationMode(mode))
 	if err != nil {
 		return nil, err
 	}
 
-	return &model.Post{
-		ID:             savedPost.ID,
-		Title:          savedPost.Title,
-		Content:        savedPost.Content,
-		CommentsActive: savedPost.CommentsActive,
-		CreatedAt:      savedPost.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:      savedPost.UpdatedAt.Format(time.RFC3339),
-	}, nil
+	return buildPostModel(post), nil
 }
 
 // CreateComment is the resolver for the createComment field.
 func (r *mutationResolver) CreateComment(ctx context.Context, postID string, parentID *string, content string) (*model.Comment, error) {
-	comment := &entity.Comment{
-		ID:        uuid.New().String(),
-		PostID:    postID,
-		ParentID:  parentID,
-		Content:   content,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	savedComment, err := r.CommentService.CreateComment(auth.UserFromContext(ctx), postID, parentID, content)
+	if err != nil {
+		return nil, err
 	}
 
-	savedComment, err := createAndSaveEntity(comment, r.Repo.CreateComment)
+	if savedComment.Status == entity.CommentPublished {
+		r.publishCommentAdded(savedComment)
+	}
+
+	return buildCommentModel(auth.UserFromContext(ctx), savedComment), nil
+}
+
+// UpdateComment is the resolver for the updateComment field.
+func (r *mutationResolver) UpdateComment(ctx context.Context, id string, content string) (*model.Comment, error) {
+	updatedComment, err := r.CommentService.UpdateComment(auth.UserFromContext(ctx), id, content)
 	if err != nil {
 		return nil, err
 	}
 
-	if parentID != nil {
-		parentComment, err := r.Repo.GetCommentById(*parentID)
-		if parentComment.PostID != savedComment.PostID || err != nil {
-			return nil, ErrParentCommentNotFound
-		}
+	return buildCommentModel(auth.UserFromContext(ctx), updatedComment), nil
+}
+
+// DeleteComment is the resolver for the deleteComment field.
+func (r *mutationResolver) DeleteComment(ctx context.Context, id string) (bool, error) {
+	if err := r.CommentService.DeleteComment(auth.UserFromContext(ctx), id); err != nil {
+		return false, err
 	}
 
-	return buildCommentModel(savedComment), nil
+	return true, nil
 }
 
-// Posts is the resolver for the posts field.
-func (r *queryResolver) Posts(ctx context.Context) ([]*model.Post, error) {
-	posts, err := r.Repo.GetPosts()
+// VoteComment is the resolver for the voteComment field.
+func (r *mutationResolver) VoteComment(ctx context.Context, id string, value model.VoteValue) (*model.Comment, error) {
+	votedComment, err := r.CommentService.Vote(auth.UserFromContext(ctx), id, entityVote(value))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get posts: %w", err)
+		return nil, err
 	}
 
-	var result []*model.Post
-	for _, post := range posts {
-		comments, err := r.Repo.GetCommentsForPost(post.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get comments for post with ID %s: %w", post.ID, err)
-		}
+	return buildCommentModel(auth.UserFromContext(ctx), votedComment), nil
+}
 
-		commentModels, err := buildCommentTree(comments)
-		if err != nil {
-			return nil, err
-		}
+// AddReaction is the resolver for the addReaction field.
+func (r *mutationResolver) AddReaction(ctx context.Context, postID string, commentID *string, emoji string) (*model.ReactionSet, error) {
+	target := reactionTarget(postID, commentID)
+	added, err := r.ReactionService.AddReaction(auth.UserFromContext(ctx), target, emoji)
+	if err != nil {
+		return nil, err
+	}
+	if added {
+		r.publishReactionsChanged(target)
+	}
 
-		postModel := &model.Post{
-			ID:             post.ID,
-			Title:          post.Title,
-			Content:        post.Content,
-			CommentsActive: post.CommentsActive,
-			CreatedAt:      post.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:      post.UpdatedAt.Format(time.RFC3339),
-			Comments:       commentModels,
-		}
+	return buildReactionSetModel(target), nil
+}
 
-		result = append(result, postModel)
+// RemoveReaction is the resolver for the removeReaction field.
+func (r *mutationResolver) RemoveReaction(ctx context.Context, postID string, commentID *string, emoji string) (*model.ReactionSet, error) {
+	target := reactionTarget(postID, commentID)
+	removed, err := r.ReactionService.RemoveReaction(auth.UserFromContext(ctx), target, emoji)
+	if err != nil {
+		return nil, err
+	}
+	if removed {
+		r.publishReactionsChanged(target)
 	}
 
-	return result, nil
+	return buildReactionSetModel(target), nil
 }
 
-// Post is the resolver for the post field.
-func (r *queryResolver) Post(ctx context.Context, id string) (*model.Post, error) {
-	post, err := r.Repo.GetPostById(id)
+// ReportComment is the resolver for the reportComment field.
+func (r *mutationResolver) ReportComment(ctx context.Context, id string, reason string) (*model.Report, error) {
+	report, err := r.ModerationService.ReportComment(auth.UserFromContext(ctx), id, reason)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get post: %w", err)
+		return nil, err
 	}
 
-	comments, err := r.Repo.GetCommentsForPost(post.ID)
+	return buildReportModel(report), nil
+}
+
+// HideComment is the resolver for the hideComment field.
+func (r *mutationResolver) HideComment(ctx context.Context, id string) (*model.Comment, error) {
+	hiddenComment, err := r.ModerationService.HideComment(auth.UserFromContext(ctx), id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comments for post: %w", err)
+		return nil, err
 	}
 
-	commentModels, err := buildCommentTree(comments)
+	return buildCommentModel(auth.UserFromContext(ctx), hiddenComment), nil
+}
+
+// ApproveComment is the resolver for the approveComment field.
+func (r *mutationResolver) ApproveComment(ctx context.Context, id string) (*model.Comment, error) {
+	approvedComment, published, err := r.ModerationService.ApproveComment(auth.UserFromContext(ctx), id)
 	if err != nil {
 		return nil, err
 	}
+	if published {
+		r.publishCommentAdded(approvedComment)
+	}
 
-	return &model.Post{
-		ID:             post.ID,
-		Title:          post.Title,
-		Content:        post.Content,
-		CommentsActive: post.CommentsActive,
-		CreatedAt:      post.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:      post.UpdatedAt.Format(time.RFC3339),
-		Comments:       commentModels,
-	}, nil
+	return buildCommentModel(auth.UserFromContext(ctx), approvedComment), nil
+}
+
+// DismissReport is the resolver for the dismissReport field.
+func (r *mutationResolver) DismissReport(ctx context.Context, id string) (bool, error) {
+	if _, err := r.ModerationService.DismissReport(auth.UserFromContext(ctx), id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Author is the resolver for the author field.
+func (r *postResolver) Author(ctx context.Context, obj *model.Post) (*model.User, error) {
+	return r.author(ctx, obj.AuthorID)
+}
+
+// Reactions is the resolver for the reactions field.
+func (r *postResolver) Reactions(ctx context.Context, obj *model.Post) ([]*model.Reaction, error) {
+	return r.reactions(ctx, entity.ReactionTarget{PostID: obj.ID})
 }
 
 // Comments is the resolver for the comments field.
-func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int, offset *int) ([]*model.Comment, error) {
-	comments, err := r.Repo.GetCommentsForPostWithLimitAndOffset(postID, limit, offset)
+func (r *postResolver) Comments(ctx context.Context, obj *model.Post, limit *int, offset *int, first *int, depth *int, sort *model.CommentSort) ([]*model.Comment, error) {
+	if first == nil {
+		first = limit
+	}
+	opts, err := treeOptions(auth.UserFromContext(ctx), first, depth, sort)
+	if err != nil {
+		return nil, err
+	}
+	if offset != nil {
+		if *offset < 0 {
+			return nil, ErrInvalidOffset
+		}
+		opts.Offset = *offset
+	}
+
+	comments, err := r.commentTree(ctx, database.TreeRoot{PostID: obj.ID}, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comments for post with ID %s: %w", postID, err)
+		return nil, err
+	}
+
+	return buildCommentTree(auth.UserFromContext(ctx), comments, nil, opts.MaxDepth), nil
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return nil, nil
+	}
+
+	return buildUserModel(user), nil
+}
+
+// ReactionEmojis is the resolver for the reactionEmojis field.
+func (r *queryResolver) ReactionEmojis(ctx context.Context) ([]string, error) {
+	return r.ReactionService.Emojis(), nil
+}
+
+// Posts is the resolver for the posts field.
+func (r *queryResolver) Posts(ctx context.Context, sort *model.PostSort) ([]*model.Post, error) {
+	posts, err := r.PostService.GetPosts(postSort(sort))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*model.Post
+	for _, post := range posts {
+		result = append(result, buildPostModel(post))
+	}
+
+	return result, nil
+}
+
+// Post is the resolver for the post field.
+func (r *queryResolver) Post(ctx context.Context, id string) (*model.Post, error) {
+	post, err := r.PostService.GetPost(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildPostModel(post), nil
+}
+
+// Comments is the resolver for the comments field.
+func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int, offset *int, sort *model.CommentSort) ([]*model.Comment, error) {
+	if limit != nil && *limit < 0 {
+		return nil, ErrInvalidLimit
+	}
+	if offset != nil && *offset < 0 {
+		return nil, ErrInvalidOffset
+	}
+
+	actor := auth.UserFromContext(ctx)
+	comments, err := r.CommentService.GetCommentsForPostWithLimitAndOffset(actor, postID, limit, offset, commentSort(sort))
+	if err != nil {
+		return nil, err
 	}
 
 	var commentModels []*model.Comment
 	for _, comment := range comments {
-		commentModels = append(commentModels, buildCommentModel(comment))
+		commentModels = append(commentModels, buildCommentModel(actor, comment))
 	}
 
 	return commentModels, nil
 }
 
-// CommentAdded is the resolver for the commentAdded field.
-func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *model.Comment, error) {
-	panic(fmt.Errorf("not implemented: CommentAdded - commentAdded"))
+// PostsConnection is the resolver for the postsConnection field.
+func (r *queryResolver) PostsConnection(ctx context.Context, first *int, after *string) (*model.PostConnection, error) {
+	limit, cursor, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, hasNextPage, err := r.PostService.GetPostsAfter(limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make([]*model.PostEdge, 0, len(posts))
+	for _, post := range posts {
+		edges = append(edges, &model.PostEdge{
+			Node:   buildPostModel(post),
+			Cursor: database.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}.Encode(),
+		})
+	}
+
+	pageInfo := &model.PageInfo{HasNextPage: hasNextPage, HasPreviousPage: cursor != nil}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+
+	return &model.PostConnection{Edges: edges, PageInfo: pageInfo}, nil
 }
 
-// Mutation returns MutationResolver implementation.
-func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+// CommentsConnection is the resolver for the commentsConnection field.
+func (r *queryResolver) CommentsConnection(ctx context.Context, postID string, first *int, after *string) (*model.CommentConnection, error) {
+	limit, cursor, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
 
-// Query returns QueryResolver implementation.
-func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+	actor := auth.UserFromContext(ctx)
+	comments, hasNextPage, err := r.CommentService.GetCommentsForPostAfter(actor, postID, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
 
-// Subscription returns SubscriptionResolver implementation.
-func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+	edges := make([]*model.CommentEdge, 0, len(comments))
+	for _, comment := range comments {
+		edges = append(edges, &model.CommentEdge{
+			Node:   buildCommentModel(actor, comment),
+			Cursor: database.Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}.Encode(),
+		})
+	}
 
-type mutationResolver struct{ *Resolver }
-type queryResolver struct{ *Resolver }
-type subscriptionResolver struct{ *Resolver }
+	pageInfo := &model.PageInfo{HasNextPage: hasNextPage, HasPreviousPage: cursor != nil}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+
+	return &model.CommentConnection{Edges: edges, PageInfo: pageInfo}, nil
+}
+
+// Search is the resolver for the search field.
+func (r *queryResolver) Search(ctx context.Context, query string, typeArg model.SearchType, first *int, after *string) (*model.SearchConnection, error) {
+	limit, cursor, err := searchPageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, hasNextPage, err := r.SearchService.Search(query, database.SearchType(typeArg), limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	actor := auth.UserFromContext(ctx)
+	edges := make([]*model.SearchEdge, 0, len(hits))
+	for _, hit := range hits {
+		edges = append(edges, buildSearchEdge(actor, hit))
+	}
+
+	pageInfo := &model.PageInfo{HasNextPage: hasNextPage, HasPreviousPage: cursor != nil}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+
+	return &model.SearchConnection{Edges: edges, PageInfo: pageInfo}, nil
+}
+
+// ModerationQueue is the resolver for the moderationQueue field.
+func (r *queryResolver) ModerationQueue(ctx context.Context, first *int, offset *int) ([]*model.ModerationItem, error) {
+	limit, skip, err := offsetPageArgs(first, offset)
+	if err != nil {
+		return nil, err
+	}
 
-// !!! WARNING !!!
-// The code below was going to be deleted when updating resolvers. It has been copied here so you have
-// one last chance to move it out of harms way if you want. There are two reasons this happens:
-//   - When renaming or deleting a resolver the old code will be put in here. You can safely delete
-//     it when you're done.
-//   - You have helper methods in this file. Move them out to keep these resolver files clean.
-var ErrParentCommentNotFound = errors.New("parent comment not found")
+	actor := auth.UserFromContext(ctx)
+	items, err := r.ModerationService.GetQueue(actor, limit, skip)
+	if err != nil {
+		return nil, err
+	}
 
-func buildCommentModel(comment *entity.Comment) *model.Comment {
-	return &model.Comment{
-		ID:        comment.ID,
-		PostID:    comment.PostID,
-		ParentID:  comment.ParentID,
-		Content:   comment.Content,
-		CreatedAt: comment.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: comment.UpdatedAt.Format(time.RFC3339),
-		Replies:   []*model.Comment{},
+	itemModels := make([]*model.ModerationItem, 0, len(items))
+	for _, item := range items {
+		itemModels = append(itemModels, buildModerationItemModel(actor, item))
 	}
+
+	return itemModels, nil
 }
 
-func buildCommentTree(comments []*entity.Comment) ([]*model.Comment, error) {
-	commentMap := make(map[string]*model.Comment)
+// PendingComments is the resolver for the pendingComments field.
+func (r *queryResolver) PendingComments(ctx context.Context, first *int, offset *int) ([]*model.Comment, error) {
+	limit, skip, err := offsetPageArgs(first, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	actor := auth.UserFromContext(ctx)
+	comments, err := r.ModerationService.GetPending(actor, limit, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	commentModels := make([]*model.Comment, 0, len(comments))
 	for _, comment := range comments {
-		commentModel := buildCommentModel(comment)
-		commentMap[comment.ID] = commentModel
+		commentModels = append(commentModels, buildCommentModel(actor, comment))
 	}
 
-	var commentModels []*model.Comment
-	for _, comment := range commentMap {
-		if comment.ParentID == nil {
-			commentModels = append(commentModels, comment)
-		} else {
-			if parentComment, exists := commentMap[*comment.ParentID]; exists {
-				parentComment.Replies = append(parentComment.Replies, comment)
+	return commentModels, nil
+}
+
+// Reactions is the resolver for the reactions field.
+func (r *reactionSetResolver) Reactions(ctx context.Context, obj *model.ReactionSet) ([]*model.Reaction, error) {
+	return r.reactions(ctx, reactionTarget(obj.PostID, obj.CommentID))
+}
+
+// Reporter is the resolver for the reporter field.
+func (r *reportResolver) Reporter(ctx context.Context, obj *model.Report) (*model.User, error) {
+	return r.author(ctx, obj.UserID)
+}
+
+// CommentAdded is the resolver for the commentAdded field.
+func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *model.Comment, error) {
+	payloads, err := r.Events.Subscribe(ctx, events.CommentAddedTopic(postID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to comments for post with ID %s: %w", postID, err)
+	}
+
+	actor := auth.UserFromContext(ctx)
+	comments := make(chan *model.Comment)
+	go func() {
+		defer close(comments)
+		for payload := range payloads {
+			var comment entity.Comment
+			if err := json.Unmarshal(payload, &comment); err != nil {
+				logrus.Errorf("failed to unmarshal published comment: %v", err)
+				continue
+			}
+
+			select {
+			case comments <- buildCommentModel(actor, &comment):
+			case <-ctx.Done():
+				return
 			}
 		}
-	}
+	}()
 
-	return commentModels, nil
+	return comments, nil
 }
 
-func createAndSaveEntity[T any](entity T, saveFunc func(T) (T, error)) (T, error) {
-	savedEntity, err := saveFunc(entity)
+// ReactionsChanged is the resolver for the reactionsChanged field.
+func (r *subscriptionResolver) ReactionsChanged(ctx context.Context, postID string) (<-chan *model.ReactionSet, error) {
+	payloads, err := r.Events.Subscribe(ctx, events.ReactionsChangedTopic(postID))
 	if err != nil {
-		return savedEntity, fmt.Errorf("failed to create entity: %w", err)
+		return nil, fmt.Errorf("failed to subscribe to reactions for post with ID %s: %w", postID, err)
 	}
-	return savedEntity, nil
+
+	sets := make(chan *model.ReactionSet)
+	go func() {
+		defer close(sets)
+		for payload := range payloads {
+			var target entity.ReactionTarget
+			if err := json.Unmarshal(payload, &target); err != nil {
+				logrus.Errorf("failed to unmarshal published reaction target: %v", err)
+				continue
+			}
+
+			select {
+			case sets <- buildReactionSetModel(target):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return sets, nil
 }
+
+// Comment returns CommentResolver implementation.
+func (r *Resolver) Comment() CommentResolver { return &commentResolver{r} }
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
+// Post returns PostResolver implementation.
+func (r *Resolver) Post() PostResolver { return &postResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// ReactionSet returns ReactionSetResolver implementation.
+func (r *Resolver) ReactionSet() ReactionSetResolver { return &reactionSetResolver{r} }
+
+// Report returns ReportResolver implementation.
+func (r *Resolver) Report() ReportResolver { return &reportResolver{r} }
+
+// Subscription returns SubscriptionResolver implementation.
+func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+
+type commentResolver struct{ *Resolver }
+type mutationResolver struct{ *Resolver }
+type postResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type reactionSetResolver struct{ *Resolver }
+type reportResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type usersFunc func(id string) (*entity.User, error)
+
+func (f usersFunc) GetUser(id string) (*entity.User, error) {
+	return f(id)
+}
+
+func TestTokens(t *testing.T) {
+	tokens := NewTokens([]byte("secret"), time.Hour)
+
+	token, err := tokens.Issue("u1")
+	require.NoError(t, err)
+	userID, err := tokens.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", userID)
+
+	_, err = NewTokens([]byte("other secret"), time.Hour).Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = tokens.Verify(token[1:])
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = tokens.Verify("garbage")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, err := NewTokens([]byte("secret"), -time.Second).Issue("u1")
+	require.NoError(t, err)
+	_, err = tokens.Verify(expired)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestMiddleware(t *testing.T) {
+	tokens := NewTokens([]byte("secret"), time.Hour)
+	users := usersFunc(func(id string) (*entity.User, error) {
+		if id != "u1" {
+			return nil, errors.New("user not found")
+		}
+		return &entity.User{ID: "u1", Name: "alice"}, nil
+	})
+
+	var seen *entity.User
+	handler := Middleware(tokens, users)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = UserFromContext(r.Context())
+	}))
+
+	serve := func(header string) int {
+		seen = nil
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(""))
+	assert.Nil(t, seen)
+
+	token, err := tokens.Issue("u1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve("Bearer "+token))
+	require.NotNil(t, seen)
+	assert.Equal(t, "alice", seen.Name)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(token))
+	assert.Equal(t, http.StatusUnauthorized, serve("Bearer garbage"))
+
+	deleted, err := tokens.Issue("u2")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve("Bearer "+deleted))
+	assert.Nil(t, seen)
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/sirupsen/logrus"
+)
+
+type userKey struct{}
+
+// Users looks up the user a verified token was issued for.
+type Users interface {
+	GetUser(id string) (*entity.User, error)
+}
+
+// WithUser returns a copy of ctx that carries the authenticated user.
+func WithUser(ctx context.Context, user *entity.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the authenticated user, or nil for an anonymous request.
+func UserFromContext(ctx context.Context) *entity.User {
+	user, _ := ctx.Value(userKey{}).(*entity.User)
+	return user
+}
+
+// Middleware authenticates requests that carry an "Authorization: Bearer <token>"
+// header and puts the user into the request context. Requests without the header
+// stay anonymous; a header with a bad token is rejected with 401, so a client
+// never mistakes a stale login for anonymous access.
+func Middleware(tokens *Tokens, users Users) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found {
+				http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			userID, err := tokens.Verify(token)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			user, err := users.GetUser(userID)
+			if err != nil {
+				logrus.Warnf("rejected token of user %s: %v", userID, err)
+				http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+		})
+	}
+}
@@ -13,9 +13,19 @@ var ErrUnmarshallingConfig = errors.New("error unmarshalling config")
 var ErrLoadConfig = errors.New("failed to load configuration")
 
 type RedisConfig struct {
-	Address  string `mapstructure:"REDIS_ADDRESS"`
-	Password string `mapstructure:"REDIS_PASSWORD"`
-	DB       int    `mapstructure:"REDIS_DB"`
+	Address   string `mapstructure:"REDIS_ADDRESS"`
+	Password  string `mapstructure:"REDIS_PASSWORD"`
+	DB        int    `mapstructure:"REDIS_DB"`
+	Namespace string `mapstructure:"REDIS_NAMESPACE"`
+}
+
+// KeyPrefix is what every Redis key and pub/sub channel of the namespace starts
+// with, so deployments sharing one Redis never see each other's data or events.
+func (c RedisConfig) KeyPrefix() string {
+	if c.Namespace == "" {
+		return ""
+	}
+	return c.Namespace + ":"
 }
 
 type PostgresConfig struct {
@@ -27,9 +37,53 @@ type PostgresConfig struct {
 	SslMode  string `mapstructure:"POSTGRES_SSL_MODE"`
 }
 
+type SQLiteConfig struct {
+	Path string `mapstructure:"SQLITE_PATH"`
+}
+
+type MemoryConfig struct {
+	SnapshotPath string `mapstructure:"MEMORY_SNAPSHOT_PATH"`
+}
+
+// AuthConfig holds the HMAC secret tokens are signed with and how long they stay valid.
+type AuthConfig struct {
+	Secret   string        `mapstructure:"AUTH_SECRET"`
+	TokenTTL time.Duration `mapstructure:"AUTH_TOKEN_TTL"`
+}
+
+// ReactionsConfig lists the emojis users may react with, comma-separated in the
+// environment; the service falls back to its default set when it is empty.
+type ReactionsConfig struct {
+	Emojis []string `mapstructure:"REACTION_EMOJIS"`
+}
+
+// FilterConfig sets up the content filters every new or edited comment goes
+// through. Each filter takes one of the actions allow, tag, hold or reject;
+// allow turns it off. The banned words are comma-separated in the environment.
+type FilterConfig struct {
+	BannedWords         []string      `mapstructure:"FILTER_BANNED_WORDS"`
+	BannedWordsAction   string        `mapstructure:"FILTER_BANNED_WORDS_ACTION"`
+	MaxLinks            int           `mapstructure:"FILTER_MAX_LINKS"`
+	LinksAction         string        `mapstructure:"FILTER_LINKS_ACTION"`
+	MaxRepeatedChars    int           `mapstructure:"FILTER_MAX_REPEATED_CHARS"`
+	RepeatedCharsAction string        `mapstructure:"FILTER_REPEATED_CHARS_ACTION"`
+	CapsRatio           float64       `mapstructure:"FILTER_CAPS_RATIO"`
+	CapsAction          string        `mapstructure:"FILTER_CAPS_ACTION"`
+	DuplicateWindow     time.Duration `mapstructure:"FILTER_DUPLICATE_WINDOW"`
+	DuplicateAction     string        `mapstructure:"FILTER_DUPLICATE_ACTION"`
+	SpamThreshold       float64       `mapstructure:"FILTER_SPAM_THRESHOLD"`
+	SpamMinTraining     int           `mapstructure:"FILTER_SPAM_MIN_TRAINING"`
+	SpamAction          string        `mapstructure:"FILTER_SPAM_ACTION"`
+}
+
 type Config struct {
-	RedisConfig    `mapstructure:",squash"`
-	PostgresConfig `mapstructure:",squash"`
+	RedisConfig     `mapstructure:",squash"`
+	PostgresConfig  `mapstructure:",squash"`
+	SQLiteConfig    `mapstructure:",squash"`
+	MemoryConfig    `mapstructure:",squash"`
+	AuthConfig      `mapstructure:",squash"`
+	ReactionsConfig `mapstructure:",squash"`
+	FilterConfig    `mapstructure:",squash"`
 }
 
 func GetConfig() (*Config, error) {
@@ -47,6 +101,23 @@ func loadConfig() (*Config, error) {
 	viper.SetConfigName(".env")
 	viper.SetConfigType("env")
 	viper.AddConfigPath(".")
+	viper.SetDefault("REDIS_NAMESPACE", "wall")
+	viper.SetDefault("SQLITE_PATH", "wall.db")
+	viper.SetDefault("MEMORY_SNAPSHOT_PATH", "")
+	viper.SetDefault("AUTH_TOKEN_TTL", "24h")
+	viper.SetDefault("FILTER_BANNED_WORDS", "")
+	viper.SetDefault("FILTER_BANNED_WORDS_ACTION", "reject")
+	viper.SetDefault("FILTER_MAX_LINKS", 3)
+	viper.SetDefault("FILTER_LINKS_ACTION", "hold")
+	viper.SetDefault("FILTER_MAX_REPEATED_CHARS", 10)
+	viper.SetDefault("FILTER_REPEATED_CHARS_ACTION", "tag")
+	viper.SetDefault("FILTER_CAPS_RATIO", 0.8)
+	viper.SetDefault("FILTER_CAPS_ACTION", "tag")
+	viper.SetDefault("FILTER_DUPLICATE_WINDOW", "10m")
+	viper.SetDefault("FILTER_DUPLICATE_ACTION", "reject")
+	viper.SetDefault("FILTER_SPAM_THRESHOLD", 0.95)
+	viper.SetDefault("FILTER_SPAM_MIN_TRAINING", 20)
+	viper.SetDefault("FILTER_SPAM_ACTION", "hold")
 
 	if err := viper.ReadInConfig(); err != nil {
 		var configFileNotFoundError viper.ConfigFileNotFoundError
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor_EncodeDecode(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC), ID: "a:b"}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	assert.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.ID, decoded.ID)
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	for _, encoded := range []string{"", "!!!", "bm90LWEtY3Vyc29y", "MTIzOg"} {
+		_, err := DecodeCursor(encoded)
+		assert.ErrorIs(t, err, ErrInvalidCursor, encoded)
+	}
+}
+
+func TestCursor_Precedes(t *testing.T) {
+	now := time.Now()
+	cursor := Cursor{CreatedAt: now, ID: "2"}
+
+	assert.True(t, cursor.Precedes(now.Add(time.Second), "1"))
+	assert.True(t, cursor.Precedes(now, "3"))
+	assert.False(t, cursor.Precedes(now, "2"))
+	assert.False(t, cursor.Precedes(now, "1"))
+	assert.False(t, cursor.Precedes(now.Add(-time.Second), "3"))
+}
+
+func TestSearchCursor_EncodeDecode(t *testing.T) {
+	cursor := SearchCursor{Rank: 0.1 + 0.2, ID: "a:b"}
+
+	decoded, err := DecodeSearchCursor(cursor.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+
+	for _, encoded := range []string{"", "!!!", "bm90LWEtY3Vyc29y", "MC41Og"} {
+		_, err := DecodeSearchCursor(encoded)
+		assert.ErrorIs(t, err, ErrInvalidCursor, encoded)
+	}
+}
+
+func TestSearchCursor_Precedes(t *testing.T) {
+	cursor := SearchCursor{Rank: 0.5, ID: "2"}
+
+	assert.True(t, cursor.Precedes(0.4, "1"))
+	assert.True(t, cursor.Precedes(0.5, "3"))
+	assert.False(t, cursor.Precedes(0.5, "2"))
+	assert.False(t, cursor.Precedes(0.6, "3"))
+}
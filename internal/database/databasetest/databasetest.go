@@ -0,0 +1,1433 @@
+// Package databasetest holds a behavioral test suite that every database.Repo
+// implementation has to pass, so the backends cannot drift apart.
+//
+// Each backend calls Run from its own tests with a function that returns a fresh,
+// empty repo. The suite only talks to the repo through the database.Repo interface.
+package databasetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// base is truncated to seconds; tests that need finer offsets stay within database.TimePrecision.
+var base = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func Run(t *testing.T, newRepo func(t *testing.T) database.Repo) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo database.Repo)
+	}{
+		{"CreateAndGetPost", testCreateAndGetPost},
+		{"PostNotFound", testPostNotFound},
+		{"GetPostsOrder", testGetPostsOrder},
+		{"TimePrecision", testTimePrecision},
+		{"GetPostsAfter", testGetPostsAfter},
+		{"UpdatePost", testUpdatePost},
+		{"SetPostModerationMode", testSetPostModerationMode},
+		{"DeletePost", testDeletePost},
+		{"CreateAndGetComment", testCreateAndGetComment},
+		{"CreateCommentRules", testCreateCommentRules},
+		{"GetCommentsForPostOrder", testGetCommentsForPostOrder},
+		{"GetCommentsForPostWithLimitAndOffset", testGetCommentsForPostWithLimitAndOffset},
+		{"GetCommentsForPostAfter", testGetCommentsForPostAfter},
+		{"NestedComments", testNestedComments},
+		{"GetCommentTree", testGetCommentTree},
+		{"GetCommentTrees", testGetCommentTrees},
+		{"CommentTreeFields", testCommentTreeFields},
+		{"SortPosts", testSortPosts},
+		{"SortComments", testSortComments},
+		{"UpdateComment", testUpdateComment},
+		{"DeleteComment", testDeleteComment},
+		{"ConcurrentComments", testConcurrentComments},
+		{"Users", testUsers},
+		{"AuthorIDs", testAuthorIDs},
+		{"Votes", testVotes},
+		{"ConcurrentVotes", testConcurrentVotes},
+		{"Ranks", testRanks},
+		{"Reactions", testReactions},
+		{"Search", testSearch},
+		{"Moderation", testModeration},
+		{"PendingComments", testPendingComments},
+		{"VisibleComments", testVisibleComments},
+		{"VisibleCommentTrees", testVisibleCommentTrees},
+		{"HeldComments", testHeldComments},
+		{"SpamTokens", testSpamTokens},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func newPost(id string, offset time.Duration) *entity.Post {
+	createdAt := base.Add(offset)
+	return &entity.Post{
+		ID:             id,
+		Title:          "Post " + id,
+		Content:        "Content " + id,
+		ModerationMode: entity.ModerationOpen,
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+	}
+}
+
+func newComment(id string, postID string, parentID *string, offset time.Duration) *entity.Comment {
+	createdAt := base.Add(offset)
+	return &entity.Comment{
+		ID:        id,
+		PostID:    postID,
+		ParentID:  parentID,
+		Content:   "Comment " + id,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+}
+
+func createPosts(t *testing.T, repo database.Repo, posts ...*entity.Post) {
+	t.Helper()
+	for _, post := range posts {
+		_, err := repo.CreatePost(post)
+		require.NoError(t, err)
+	}
+}
+
+func createComments(t *testing.T, repo database.Repo, comments ...*entity.Comment) {
+	t.Helper()
+	for _, comment := range comments {
+		_, err := repo.CreateComment(comment)
+		require.NoError(t, err)
+	}
+}
+
+func postIDs(posts []*entity.Post) []string {
+	ids := make([]string, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+func commentIDs(comments []*entity.Comment) []string {
+	ids := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	return ids
+}
+
+// commentTree fetches the subtree of a single root.
+func commentTree(t *testing.T, repo database.Repo, postID string, parentID string, opts database.TreeOptions) []*entity.Comment {
+	t.Helper()
+	root := database.TreeRoot{PostID: postID, ParentID: parentID}
+	trees, err := repo.GetCommentTrees([]database.TreeRoot{root}, opts)
+	require.NoError(t, err)
+	require.Contains(t, trees, root)
+	return trees[root]
+}
+
+func testCreateAndGetPost(t *testing.T, repo database.Repo) {
+	post := newPost("1", 0)
+	post.ModerationMode = entity.ModerationClosed
+	createPosts(t, repo, post)
+
+	got, err := repo.GetPostById("1")
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, got.ID)
+	assert.Equal(t, post.Title, got.Title)
+	assert.Equal(t, post.Content, got.Content)
+	assert.Equal(t, entity.ModerationClosed, got.ModerationMode)
+	assert.True(t, post.CreatedAt.Equal(got.CreatedAt))
+	assert.True(t, post.UpdatedAt.Equal(got.UpdatedAt))
+}
+
+func testPostNotFound(t *testing.T, repo database.Repo) {
+	_, err := repo.GetPostById("missing")
+	assert.ErrorIs(t, err, database.ErrPostNotFound)
+
+	posts, err := repo.GetPosts(database.PostSortOldest)
+	assert.NoError(t, err)
+	assert.Empty(t, posts)
+}
+
+func testGetPostsOrder(t *testing.T, repo database.Repo) {
+	createPosts(t, repo,
+		newPost("c", 2*time.Second),
+		newPost("b", 0),
+		newPost("a", 0),
+		newPost("d", time.Second),
+	)
+
+	posts, err := repo.GetPosts(database.PostSortOldest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "d", "c"}, postIDs(posts))
+}
+
+func testGetPostsAfter(t *testing.T, repo database.Repo) {
+	for i := 1; i <= 5; i++ {
+		createPosts(t, repo, newPost(fmt.Sprintf("%d", i), time.Duration(i)*time.Second))
+	}
+
+	page, hasNext, err := repo.GetPostsAfter(2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, postIDs(page))
+	assert.True(t, hasNext)
+
+	cursor := &database.Cursor{CreatedAt: page[1].CreatedAt, ID: page[1].ID}
+	page, hasNext, err = repo.GetPostsAfter(3, cursor)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "4", "5"}, postIDs(page))
+	assert.False(t, hasNext)
+
+	cursor = &database.Cursor{CreatedAt: page[2].CreatedAt, ID: page[2].ID}
+	page, hasNext, err = repo.GetPostsAfter(2, cursor)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+	assert.False(t, hasNext)
+
+	page, hasNext, err = repo.GetPostsAfter(0, nil)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+	assert.True(t, hasNext)
+}
+
+func testUpdatePost(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+
+	updatedAt := base.Add(time.Minute)
+	_, err := repo.UpdatePost(&entity.Post{ID: "1", Title: "Edited", Content: "Edited content", ModerationMode: entity.ModerationOpen, CreatedAt: base, UpdatedAt: updatedAt})
+	require.NoError(t, err)
+
+	got, err := repo.GetPostById("1")
+	require.NoError(t, err)
+	assert.Equal(t, "Edited", got.Title)
+	assert.Equal(t, "Edited content", got.Content)
+	assert.True(t, updatedAt.Equal(got.UpdatedAt))
+	assert.True(t, base.Equal(got.CreatedAt))
+
+	_, err = repo.UpdatePost(newPost("missing", 0))
+	assert.ErrorIs(t, err, database.ErrPostNotFound)
+}
+
+func testSetPostModerationMode(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+
+	post, err := repo.SetPostModerationMode("1", entity.ModerationPremoderated)
+	require.NoError(t, err)
+	assert.Equal(t, entity.ModerationPremoderated, post.ModerationMode)
+
+	got, err := repo.GetPostById("1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.ModerationPremoderated, got.ModerationMode)
+
+	_, err = repo.SetPostModerationMode("missing", entity.ModerationClosed)
+	assert.ErrorIs(t, err, database.ErrPostNotFound)
+}
+
+func testDeletePost(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", time.Second))
+	parentID := "c1"
+	createComments(t, repo,
+		newComment("c1", "1", nil, 0),
+		newComment("c2", "1", &parentID, time.Second),
+		newComment("c3", "2", nil, 0),
+	)
+
+	require.NoError(t, repo.DeletePost("1"))
+
+	_, err := repo.GetPostById("1")
+	assert.ErrorIs(t, err, database.ErrPostNotFound)
+	_, err = repo.GetCommentById("c1")
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+	_, err = repo.GetCommentById("c2")
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+
+	posts, err := repo.GetPosts(database.PostSortOldest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, postIDs(posts))
+
+	comments, err := repo.GetCommentsForPost("2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c3"}, commentIDs(comments))
+
+	assert.ErrorIs(t, repo.DeletePost("1"), database.ErrPostNotFound)
+}
+
+func testCreateAndGetComment(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	comment := newComment("c1", "1", nil, 0)
+	createComments(t, repo, comment)
+
+	got, err := repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", got.PostID)
+	assert.Nil(t, got.ParentID)
+	assert.Equal(t, comment.Content, got.Content)
+	assert.False(t, got.Deleted)
+	assert.Equal(t, entity.CommentPublished, got.Status)
+	assert.Nil(t, got.EditedAt)
+	assert.True(t, comment.CreatedAt.Equal(got.CreatedAt))
+
+	_, err = repo.GetCommentById("missing")
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+}
+
+func testCreateCommentRules(t *testing.T, repo database.Repo) {
+	disabled := newPost("2", 0)
+	disabled.ModerationMode = entity.ModerationClosed
+	createPosts(t, repo, newPost("1", 0), disabled, newPost("3", 0))
+	createComments(t, repo, newComment("c1", "1", nil, 0))
+
+	_, err := repo.CreateComment(newComment("c2", "missing", nil, 0))
+	assert.ErrorIs(t, err, database.ErrPostNotFound)
+
+	_, err = repo.CreateComment(newComment("c3", "2", nil, 0))
+	assert.ErrorIs(t, err, database.ErrCommentsNotActive)
+
+	missingID := "missing"
+	_, err = repo.CreateComment(newComment("c4", "1", &missingID, 0))
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+
+	parentID := "c1"
+	_, err = repo.CreateComment(newComment("c5", "3", &parentID, 0))
+	assert.ErrorIs(t, err, database.ErrParentOnOtherPost)
+
+	for _, id := range []string{"c2", "c3", "c4", "c5"} {
+		_, err = repo.GetCommentById(id)
+		assert.ErrorIs(t, err, database.ErrCommentNotFound, id)
+	}
+}
+
+func testGetCommentsForPostOrder(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", 0))
+	createComments(t, repo,
+		newComment("c", "1", nil, 2*time.Second),
+		newComment("b", "1", nil, 0),
+		newComment("a", "1", nil, 0),
+		newComment("d", "1", nil, time.Second),
+		newComment("e", "2", nil, 0),
+	)
+
+	comments, err := repo.GetCommentsForPost("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "d", "c"}, commentIDs(comments))
+
+	comments, err = repo.GetCommentsForPost("missing")
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func testGetCommentsForPostWithLimitAndOffset(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	for i := 1; i <= 5; i++ {
+		createComments(t, repo, newComment(fmt.Sprintf("c%d", i), "1", nil, time.Duration(i)*time.Second))
+	}
+
+	limit, offset := 2, 1
+	comments, err := repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortOldest, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c2", "c3"}, commentIDs(comments))
+
+	offset = 4
+	comments, err = repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortOldest, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c5"}, commentIDs(comments))
+
+	offset = 10
+	comments, err = repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortOldest, database.Viewer{})
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+
+	comments, err = repo.GetCommentsForPostWithLimitAndOffset("1", nil, nil, database.CommentSortOldest, database.Viewer{})
+	require.NoError(t, err)
+	assert.Len(t, comments, 5)
+}
+
+func testGetCommentsForPostAfter(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", 0))
+	createComments(t, repo,
+		newComment("c1", "1", nil, 0),
+		newComment("c2", "1", nil, time.Second),
+		newComment("c3", "1", nil, time.Second),
+		newComment("c4", "2", nil, time.Second),
+	)
+
+	page, hasNext, err := repo.GetCommentsForPostAfter("1", 2, nil, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c2"}, commentIDs(page))
+	assert.True(t, hasNext)
+
+	cursor := &database.Cursor{CreatedAt: page[1].CreatedAt, ID: page[1].ID}
+	page, hasNext, err = repo.GetCommentsForPostAfter("1", 2, cursor, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c3"}, commentIDs(page))
+	assert.False(t, hasNext)
+
+	// A comment added before the cursor position must not shift the next page.
+	createComments(t, repo, newComment("c0", "1", nil, 0))
+	page, _, err = repo.GetCommentsForPostAfter("1", 2, cursor, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c3"}, commentIDs(page))
+}
+
+func testNestedComments(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	c1, c2 := "c1", "c2"
+	createComments(t, repo,
+		newComment("c1", "1", nil, 0),
+		newComment("c2", "1", &c1, time.Second),
+		newComment("c3", "1", &c2, 2*time.Second),
+		newComment("c4", "1", &c1, 3*time.Second),
+	)
+
+	comments, err := repo.GetCommentsForPost("1")
+	require.NoError(t, err)
+	require.Len(t, comments, 4)
+
+	parents := map[string]*string{}
+	for _, comment := range comments {
+		parents[comment.ID] = comment.ParentID
+	}
+	assert.Nil(t, parents["c1"])
+	assert.Equal(t, &c1, parents["c2"])
+	assert.Equal(t, &c2, parents["c3"])
+	assert.Equal(t, &c1, parents["c4"])
+}
+
+func testGetCommentTree(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", 0))
+	r1, r2, r1a, r1b := "r1", "r2", "r1a", "r1b"
+	createComments(t, repo,
+		newComment("r1", "1", nil, 0),
+		newComment("r2", "1", nil, time.Second),
+		newComment("r3", "1", nil, 2*time.Second),
+		newComment("r1a", "1", &r1, 3*time.Second),
+		newComment("r2a", "1", &r2, 4*time.Second),
+		newComment("r1b", "1", &r1, 5*time.Second),
+		newComment("r1c", "1", &r1, 6*time.Second),
+		newComment("r1a1", "1", &r1a, 7*time.Second),
+		newComment("r1b1", "1", &r1b, 8*time.Second),
+		newComment("other", "2", nil, 0),
+	)
+
+	tree := commentTree(t, repo, "1", "", database.TreeOptions{First: 2, MaxDepth: 1, Order: database.CommentSortOldest})
+	assert.Equal(t, []string{"r1", "r2"}, commentIDs(tree))
+
+	tree = commentTree(t, repo, "1", "", database.TreeOptions{First: 2, MaxDepth: 2, Order: database.CommentSortOldest})
+	assert.Equal(t, []string{"r1", "r2", "r1a", "r2a", "r1b"}, commentIDs(tree))
+
+	tree = commentTree(t, repo, "1", "", database.TreeOptions{First: 10, MaxDepth: 10, Order: database.CommentSortOldest})
+	assert.Equal(t, []string{"r1", "r2", "r3", "r1a", "r2a", "r1b", "r1c", "r1a1", "r1b1"}, commentIDs(tree))
+
+	tree = commentTree(t, repo, "1", r1, database.TreeOptions{First: 2, MaxDepth: 2, Order: database.CommentSortOldest})
+	assert.Equal(t, []string{"r1a", "r1b", "r1a1", "r1b1"}, commentIDs(tree))
+	require.NotNil(t, tree[2].ParentID)
+	assert.Equal(t, r1a, *tree[2].ParentID)
+
+	tree = commentTree(t, repo, "1", r1, database.TreeOptions{First: 0, MaxDepth: 2, Order: database.CommentSortOldest})
+	assert.Empty(t, tree)
+
+	tree = commentTree(t, repo, "missing", "", database.TreeOptions{First: 10, MaxDepth: 10, Order: database.CommentSortOldest})
+	assert.Empty(t, tree)
+}
+
+func testGetCommentTrees(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", 0), newPost("3", 0))
+	a, b := "a", "b"
+	createComments(t, repo,
+		newComment("a", "1", nil, 0),
+		newComment("b", "1", nil, time.Second),
+		newComment("c", "1", nil, 2*time.Second),
+		newComment("a1", "1", &a, 3*time.Second),
+		newComment("b1", "1", &b, 4*time.Second),
+		newComment("d", "2", nil, 0),
+		newComment("e", "2", nil, time.Second),
+	)
+
+	post1 := database.TreeRoot{PostID: "1"}
+	post2 := database.TreeRoot{PostID: "2"}
+	post3 := database.TreeRoot{PostID: "3"}
+	replies := database.TreeRoot{PostID: "1", ParentID: a}
+	wrongPost := database.TreeRoot{PostID: "2", ParentID: b}
+
+	trees, err := repo.GetCommentTrees([]database.TreeRoot{post1, post2, post3, replies, wrongPost},
+		database.TreeOptions{First: 2, MaxDepth: 2, Order: database.CommentSortOldest})
+	require.NoError(t, err)
+	assert.Len(t, trees, 5)
+	assert.Equal(t, []string{"a", "b", "a1", "b1"}, commentIDs(trees[post1]))
+	assert.Equal(t, []string{"d", "e"}, commentIDs(trees[post2]))
+	assert.Empty(t, trees[post3])
+	assert.Equal(t, []string{"a1"}, commentIDs(trees[replies]))
+	assert.Empty(t, trees[wrongPost])
+
+	// The offset only skips comments on the first level.
+	trees, err = repo.GetCommentTrees([]database.TreeRoot{post1, post2},
+		database.TreeOptions{First: 1, Offset: 1, MaxDepth: 2, Order: database.CommentSortOldest})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "b1"}, commentIDs(trees[post1]))
+	assert.Equal(t, []string{"e"}, commentIDs(trees[post2]))
+
+	trees, err = repo.GetCommentTrees(nil, database.TreeOptions{First: 1, MaxDepth: 1})
+	require.NoError(t, err)
+	assert.Empty(t, trees)
+}
+
+// testCommentTreeFields checks that trees carry the moderation state of every
+// comment, not just its content.
+func testCommentTreeFields(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	r1 := "r1"
+	tagged := newComment("r1", "1", nil, 0)
+	tagged.Tags = []string{"all_caps", "duplicate"}
+	createComments(t, repo, tagged, newComment("r1a", "1", &r1, time.Second))
+	_, err := repo.ModerateComment("r1a", true, entity.ReportResolved)
+	require.NoError(t, err)
+	_, err = repo.SetPostModerationMode("1", entity.ModerationPremoderated)
+	require.NoError(t, err)
+	createComments(t, repo, newComment("r1b", "1", &r1, 2*time.Second))
+
+	tree := commentTree(t, repo, "1", "", database.TreeOptions{First: 10, MaxDepth: 2, Order: database.CommentSortOldest, Viewer: database.Viewer{Moderator: true}})
+	require.Equal(t, []string{"r1", "r1a", "r1b"}, commentIDs(tree))
+	assert.False(t, tree[0].Hidden)
+	assert.Equal(t, []string{"all_caps", "duplicate"}, tree[0].Tags)
+	assert.Empty(t, tree[1].Tags)
+	assert.True(t, tree[1].Hidden)
+	assert.Equal(t, entity.CommentPublished, tree[1].Status)
+	assert.Equal(t, entity.CommentPending, tree[2].Status)
+}
+
+func testTimePrecision(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	createComments(t, repo,
+		newComment("b", "1", nil, 1500*time.Microsecond),
+		newComment("a", "1", nil, 1501*time.Microsecond),
+		newComment("c", "1", nil, 999*time.Microsecond),
+	)
+
+	comment, err := repo.GetCommentById("b")
+	require.NoError(t, err)
+	assert.True(t, base.Add(1500*time.Microsecond).Equal(comment.CreatedAt), "got %v", comment.CreatedAt)
+
+	comments, err := repo.GetCommentsForPost("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b", "a"}, commentIDs(comments))
+
+	page, _, err := repo.GetCommentsForPostAfter("1", 1, &database.Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, commentIDs(page))
+}
+
+func testSortPosts(t *testing.T, repo database.Repo) {
+	createPosts(t, repo,
+		newPost("c", 2*time.Second),
+		newPost("b", 0),
+		newPost("a", 0),
+		newPost("d", time.Second),
+	)
+
+	posts, err := repo.GetPosts(database.PostSortNewest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "d", "b", "a"}, postIDs(posts))
+}
+
+func testSortComments(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	r1, r2, r3, r2a := "r1", "r2", "r3", "r2a"
+	createComments(t, repo,
+		newComment("r1", "1", nil, 0),
+		newComment("r2", "1", nil, time.Second),
+		newComment("r3", "1", nil, 2*time.Second),
+		newComment("r4", "1", nil, 3*time.Second),
+		newComment("r1a", "1", &r1, 4*time.Second),
+		newComment("r2a", "1", &r2, 5*time.Second),
+		newComment("r2b", "1", &r2, 6*time.Second),
+		newComment("r2c", "1", &r2, 7*time.Second),
+		newComment("r3a", "1", &r3, 8*time.Second),
+		newComment("r2a1", "1", &r2a, 9*time.Second),
+	)
+
+	limit, offset := 3, 0
+	comments, err := repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortNewest, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r2a1", "r3a", "r2c"}, commentIDs(comments))
+
+	offset = 1
+	comments, err = repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortTop, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r1", "r3", "r2a"}, commentIDs(comments))
+
+	tree := commentTree(t, repo, "1", "", database.TreeOptions{First: 2, MaxDepth: 2, Order: database.CommentSortNewest})
+	assert.Equal(t, []string{"r4", "r3", "r3a"}, commentIDs(tree))
+
+	tree = commentTree(t, repo, "1", "", database.TreeOptions{First: 2, MaxDepth: 2, Order: database.CommentSortTop})
+	assert.Equal(t, []string{"r2", "r1", "r2a", "r1a", "r2b"}, commentIDs(tree))
+
+	tree = commentTree(t, repo, "1", r2, database.TreeOptions{First: 1, MaxDepth: 1, Order: database.CommentSortControversial})
+	assert.Equal(t, []string{"r2a"}, commentIDs(tree), "without votes nothing is controversial")
+
+	// r3 splits 1:1 with a reply, r2b splits 1:1 and r2c 2:1; r2a is only liked.
+	for _, vote := range []struct {
+		commentID string
+		userID    string
+		value     entity.Vote
+	}{
+		{"r3", "u1", entity.VoteUp}, {"r3", "u2", entity.VoteDown},
+		{"r2b", "u1", entity.VoteUp}, {"r2b", "u2", entity.VoteDown},
+		{"r2c", "u1", entity.VoteUp}, {"r2c", "u2", entity.VoteUp}, {"r2c", "u3", entity.VoteDown},
+		{"r2a", "u1", entity.VoteUp},
+	} {
+		_, err := repo.VoteComment(vote.commentID, vote.userID, vote.value)
+		require.NoError(t, err)
+	}
+
+	offset = 0
+	comments, err = repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortControversial, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r3", "r2b", "r2c"}, commentIDs(comments))
+
+	tree = commentTree(t, repo, "1", r2, database.TreeOptions{First: 3, MaxDepth: 1, Order: database.CommentSortControversial})
+	assert.Equal(t, []string{"r2b", "r2c", "r2a"}, commentIDs(tree))
+
+	tree = commentTree(t, repo, "1", "", database.TreeOptions{First: 2, MaxDepth: 1, Order: database.CommentSortControversial})
+	assert.Equal(t, []string{"r3", "r1"}, commentIDs(tree), "ties fall back to OLDEST")
+}
+
+func testUpdateComment(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	comment := newComment("c1", "1", nil, 0)
+	createComments(t, repo, comment)
+
+	revisions, err := repo.GetCommentRevisions("c1")
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+
+	for i, content := range []string{"First edit", "Second edit"} {
+		editedAt := base.Add(time.Duration(i+1) * time.Minute)
+		edited := newComment("c1", "1", nil, 0)
+		edited.Content = content
+		edited.EditedAt = &editedAt
+		edited.UpdatedAt = editedAt
+		_, err := repo.UpdateComment(edited)
+		require.NoError(t, err)
+	}
+
+	got, err := repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, "Second edit", got.Content)
+	require.NotNil(t, got.EditedAt)
+	assert.True(t, base.Add(2*time.Minute).Equal(*got.EditedAt))
+
+	revisions, err = repo.GetCommentRevisions("c1")
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, comment.Content, revisions[0].Content)
+	assert.True(t, base.Equal(revisions[0].CreatedAt))
+	assert.Equal(t, "First edit", revisions[1].Content)
+	assert.True(t, base.Add(time.Minute).Equal(revisions[1].CreatedAt))
+
+	_, err = repo.UpdateComment(newComment("missing", "1", nil, 0))
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+}
+
+func testDeleteComment(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	parentID := "c1"
+	createComments(t, repo,
+		newComment("c1", "1", nil, 0),
+		newComment("c2", "1", &parentID, time.Second),
+		newComment("c3", "1", nil, 2*time.Second),
+	)
+
+	editedAt := base.Add(time.Minute)
+	edited := newComment("c1", "1", nil, 0)
+	edited.Content = "Edited"
+	edited.EditedAt = &editedAt
+	_, err := repo.UpdateComment(edited)
+	require.NoError(t, err)
+
+	// A comment with replies is replaced by a tombstone so the thread stays intact.
+	require.NoError(t, repo.DeleteComment("c1"))
+	got, err := repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.True(t, got.Deleted)
+	assert.Equal(t, entity.DeletedCommentContent, got.Content)
+
+	revisions, err := repo.GetCommentRevisions("c1")
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+
+	// A comment without replies is removed completely.
+	require.NoError(t, repo.DeleteComment("c3"))
+	_, err = repo.GetCommentById("c3")
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+
+	comments, err := repo.GetCommentsForPost("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c2"}, commentIDs(comments))
+
+	assert.ErrorIs(t, repo.DeleteComment("missing"), database.ErrCommentNotFound)
+}
+
+func testConcurrentComments(t *testing.T, repo database.Repo) {
+	const writers = 20
+
+	createPosts(t, repo, newPost("1", 0))
+	parentID := "parent"
+	createComments(t, repo, newComment(parentID, "1", nil, 0))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var parent *string
+			if i%2 == 0 {
+				parent = &parentID
+			}
+			_, err := repo.CreateComment(newComment(fmt.Sprintf("c%02d", i), "1", parent, time.Second))
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	comments, err := repo.GetCommentsForPost("1")
+	require.NoError(t, err)
+	assert.Len(t, comments, writers+1)
+
+	replies := 0
+	for _, comment := range comments {
+		if comment.ParentID != nil && *comment.ParentID == parentID {
+			replies++
+		}
+	}
+	assert.Equal(t, writers/2, replies)
+}
+
+func testUsers(t *testing.T, repo database.Repo) {
+	user := &entity.User{ID: "u1", Name: "alice", PasswordHash: "hash", Role: entity.RoleModerator, CreatedAt: base}
+	_, err := repo.CreateUser(user)
+	require.NoError(t, err)
+
+	_, err = repo.CreateUser(&entity.User{ID: "u2", Name: "alice", PasswordHash: "hash", Role: entity.RoleCommenter, CreatedAt: base})
+	assert.ErrorIs(t, err, database.ErrUserExists)
+
+	stored, err := repo.GetUserByName("alice")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", stored.ID)
+	assert.Equal(t, "hash", stored.PasswordHash)
+	assert.Equal(t, entity.RoleModerator, stored.Role)
+	assert.True(t, base.Equal(stored.CreatedAt))
+
+	_, err = repo.GetUserByName("bob")
+	assert.ErrorIs(t, err, database.ErrUserNotFound)
+
+	users, err := repo.GetUsers([]string{"missing", "u1"})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "alice", users[0].Name)
+
+	users, err = repo.GetUsers(nil)
+	require.NoError(t, err)
+	assert.Empty(t, users)
+
+	updated, err := repo.SetUserRole("u1", entity.RoleAdmin)
+	require.NoError(t, err)
+	assert.Equal(t, entity.RoleAdmin, updated.Role)
+	assert.Equal(t, "hash", updated.PasswordHash)
+	stored, err = repo.GetUserByName("alice")
+	require.NoError(t, err)
+	assert.Equal(t, entity.RoleAdmin, stored.Role)
+
+	_, err = repo.SetUserRole("missing", entity.RoleAdmin)
+	assert.ErrorIs(t, err, database.ErrUserNotFound)
+}
+
+func testAuthorIDs(t *testing.T, repo database.Repo) {
+	post := newPost("1", 0)
+	post.AuthorID = "u1"
+	createPosts(t, repo, post)
+	comment := newComment("c1", "1", nil, 0)
+	comment.AuthorID = "u2"
+	createComments(t, repo, comment, newComment("c2", "1", nil, time.Second))
+
+	storedPost, err := repo.GetPostById("1")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", storedPost.AuthorID)
+
+	storedComment, err := repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, "u2", storedComment.AuthorID)
+
+	tree := commentTree(t, repo, "1", "", database.TreeOptions{First: 10, MaxDepth: 1, Order: database.CommentSortOldest})
+	require.Len(t, tree, 2)
+	assert.Equal(t, "u2", tree[0].AuthorID)
+	assert.Empty(t, tree[1].AuthorID)
+}
+
+func testVotes(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	createComments(t, repo, newComment("c1", "1", nil, 0), newComment("c2", "1", nil, time.Second))
+
+	vote := func(commentID string, userID string, value entity.Vote) *entity.Comment {
+		t.Helper()
+		comment, err := repo.VoteComment(commentID, userID, value)
+		require.NoError(t, err)
+		return comment
+	}
+
+	comment := vote("c1", "u1", entity.VoteUp)
+	assert.Equal(t, 1, comment.Upvotes)
+	assert.Equal(t, "Comment c1", comment.Content)
+	vote("c1", "u1", entity.VoteUp)
+	vote("c1", "u2", entity.VoteUp)
+	comment = vote("c1", "u3", entity.VoteDown)
+	assert.Equal(t, 2, comment.Upvotes, "voting the same way twice counts once")
+	assert.Equal(t, 1, comment.Downvotes)
+
+	comment = vote("c1", "u1", entity.VoteDown)
+	assert.Equal(t, 1, comment.Upvotes)
+	assert.Equal(t, 2, comment.Downvotes)
+	comment = vote("c1", "u3", entity.VoteNone)
+	assert.Equal(t, 1, comment.Upvotes)
+	assert.Equal(t, 1, comment.Downvotes)
+	assert.Zero(t, comment.Score())
+	vote("c2", "u1", entity.VoteUp)
+
+	stored, err := repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.Upvotes)
+	assert.Equal(t, 1, stored.Downvotes)
+	assert.True(t, base.Equal(stored.UpdatedAt), "votes do not touch updatedAt")
+
+	votes, err := repo.GetCommentVotes("u1", []string{"c1", "c2", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]entity.Vote{"c1": entity.VoteDown, "c2": entity.VoteUp}, votes)
+	votes, err = repo.GetCommentVotes("u3", []string{"c1", "c2"})
+	require.NoError(t, err)
+	assert.Empty(t, votes)
+
+	tree := commentTree(t, repo, "1", "", database.TreeOptions{First: 10, MaxDepth: 1, Order: database.CommentSortOldest})
+	require.Len(t, tree, 2)
+	assert.Equal(t, 1, tree[0].Upvotes)
+	assert.Equal(t, 1, tree[0].Downvotes)
+
+	// An edit writes the comment back, but must not reset its counters.
+	stored.Content = "Edited comment c1"
+	_, err = repo.UpdateComment(stored)
+	require.NoError(t, err)
+	vote("c1", "u4", entity.VoteUp)
+	stored, err = repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored.Upvotes)
+
+	_, err = repo.VoteComment("missing", "u1", entity.VoteUp)
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+
+	require.NoError(t, repo.DeleteComment("c2"))
+	votes, err = repo.GetCommentVotes("u1", []string{"c2"})
+	require.NoError(t, err)
+	assert.Empty(t, votes, "votes are deleted with the comment")
+}
+
+func testConcurrentVotes(t *testing.T, repo database.Repo) {
+	const voters = 20
+
+	createPosts(t, repo, newPost("1", 0))
+	createComments(t, repo, newComment("c1", "1", nil, 0))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*voters)
+	for i := 0; i < voters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("u%02d", i)
+			// Every voter changes their mind once, racing with everybody else.
+			_, err := repo.VoteComment("c1", userID, entity.VoteDown)
+			errs <- err
+			value := entity.VoteUp
+			if i%4 == 0 {
+				value = entity.VoteNone
+			}
+			_, err = repo.VoteComment("c1", userID, value)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	comment, err := repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, voters-voters/4, comment.Upvotes)
+	assert.Zero(t, comment.Downvotes)
+}
+
+func testRanks(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", time.Second), newPost("3", 2*time.Second))
+	c1 := "c1"
+	createComments(t, repo,
+		newComment("c1", "1", nil, 0),
+		newComment("c2", "1", nil, time.Second),
+		newComment("c3", "1", nil, 2*time.Second),
+		newComment("c4", "1", nil, 3*time.Second),
+		newComment("c1a", "1", &c1, 5*time.Second),
+		newComment("c1b", "1", &c1, 6*time.Second),
+		newComment("p2c", "2", nil, 0),
+	)
+
+	vote := func(commentID string, userID string, value entity.Vote) {
+		t.Helper()
+		_, err := repo.VoteComment(commentID, userID, value)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		vote("c1", fmt.Sprintf("u%d", i), entity.VoteUp)
+	}
+	vote("c2", "u1", entity.VoteUp)
+	vote("c1a", "u1", entity.VoteUp)
+	vote("p2c", "u1", entity.VoteUp)
+	vote("p2c", "u2", entity.VoteDown)
+
+	// HOT lets ten votes outweigh hours of age, but a single one is worth less
+	// than a second; BEST ignores age and breaks ties by NEWEST.
+	tree := commentTree(t, repo, "1", "", database.TreeOptions{First: 3, MaxDepth: 2, Order: database.CommentSortHot})
+	assert.Equal(t, []string{"c1", "c4", "c3", "c1b", "c1a"}, commentIDs(tree))
+	tree = commentTree(t, repo, "1", "", database.TreeOptions{First: 2, MaxDepth: 2, Order: database.CommentSortBest})
+	assert.Equal(t, []string{"c1", "c2", "c1a", "c1b"}, commentIDs(tree))
+	tree = commentTree(t, repo, "1", "", database.TreeOptions{First: 2, Offset: 1, MaxDepth: 2, Order: database.CommentSortBest})
+	assert.Equal(t, []string{"c2", "c4"}, commentIDs(tree))
+	tree = commentTree(t, repo, "1", c1, database.TreeOptions{First: 1, MaxDepth: 1, Order: database.CommentSortBest})
+	assert.Equal(t, []string{"c1a"}, commentIDs(tree))
+
+	limit, offset := 3, 0
+	comments, err := repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortBest, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c1a", "c2"}, commentIDs(comments))
+
+	// Changing a vote ranks the comment again.
+	vote("c1", "u0", entity.VoteNone)
+	for i := 0; i < 20; i++ {
+		vote("c3", fmt.Sprintf("u%d", i), entity.VoteUp)
+	}
+	tree = commentTree(t, repo, "1", "", database.TreeOptions{First: 2, MaxDepth: 1, Order: database.CommentSortHot})
+	assert.Equal(t, []string{"c3", "c1"}, commentIDs(tree))
+
+	// Posts collect the votes on their comments.
+	post, err := repo.GetPostById("1")
+	require.NoError(t, err)
+	assert.Equal(t, 31, post.Upvotes)
+	assert.Zero(t, post.Downvotes)
+	post, err = repo.GetPostById("2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, post.Upvotes)
+	assert.Equal(t, 1, post.Downvotes)
+
+	posts, err := repo.GetPosts(database.PostSortHot)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "3", "2"}, postIDs(posts))
+	posts, err = repo.GetPosts(database.PostSortBest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, postIDs(posts))
+
+	require.NoError(t, repo.DeleteComment("c4"))
+	tree = commentTree(t, repo, "1", "", database.TreeOptions{First: 10, MaxDepth: 1, Order: database.CommentSortBest})
+	assert.Equal(t, []string{"c3", "c1", "c2"}, commentIDs(tree))
+	offset = 1
+	comments, err = repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortBest, database.Viewer{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c1a", "c2"}, commentIDs(comments), "the flat list mixes every level")
+
+	require.NoError(t, repo.DeletePost("2"))
+	posts, err = repo.GetPosts(database.PostSortBest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, postIDs(posts))
+}
+
+func testReactions(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", time.Second))
+	createComments(t, repo, newComment("c1", "1", nil, 0), newComment("c2", "1", nil, time.Second))
+
+	post := entity.ReactionTarget{PostID: "1"}
+	comment := entity.ReactionTarget{PostID: "1", CommentID: "c1"}
+	react := func(target entity.ReactionTarget, userID string, emoji string) bool {
+		t.Helper()
+		added, err := repo.AddReaction(&entity.Reaction{PostID: target.PostID, CommentID: target.CommentID, UserID: userID, Emoji: emoji})
+		require.NoError(t, err)
+		return added
+	}
+
+	assert.True(t, react(post, "u1", "👍"))
+	assert.False(t, react(post, "u1", "👍"), "the same emoji counts once per user")
+	assert.True(t, react(post, "u1", "❤️"))
+	assert.True(t, react(post, "u2", "👍"))
+	assert.True(t, react(comment, "u2", "😂"))
+
+	counts := func(reactions []*entity.ReactionCount) map[string]entity.ReactionCount {
+		result := make(map[string]entity.ReactionCount, len(reactions))
+		for _, reaction := range reactions {
+			result[reaction.Emoji] = *reaction
+		}
+		return result
+	}
+	reactions, err := repo.GetReactions("u1", []entity.ReactionTarget{post, comment, post, {PostID: "2"}})
+	require.NoError(t, err)
+	assert.Len(t, reactions, 2, "targets without reactions are left out")
+	assert.Equal(t, map[string]entity.ReactionCount{
+		"👍":  {Emoji: "👍", Count: 2, ReactedByMe: true},
+		"❤️": {Emoji: "❤️", Count: 1, ReactedByMe: true},
+	}, counts(reactions[post]), "reactions on comments are not counted for the post")
+	assert.Equal(t, map[string]entity.ReactionCount{"😂": {Emoji: "😂", Count: 1}}, counts(reactions[comment]))
+
+	removed, err := repo.RemoveReaction(&entity.Reaction{PostID: "1", UserID: "u1", Emoji: "👍"})
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = repo.RemoveReaction(&entity.Reaction{PostID: "1", UserID: "u1", Emoji: "👍"})
+	require.NoError(t, err)
+	assert.False(t, removed)
+	removed, err = repo.RemoveReaction(&entity.Reaction{PostID: "1", UserID: "u1", Emoji: "❤️"})
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	reactions, err = repo.GetReactions("", []entity.ReactionTarget{post})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]entity.ReactionCount{"👍": {Emoji: "👍", Count: 1}}, counts(reactions[post]), "emojis nobody is left with are dropped")
+
+	_, err = repo.AddReaction(&entity.Reaction{PostID: "missing", UserID: "u1", Emoji: "👍"})
+	assert.ErrorIs(t, err, database.ErrPostNotFound)
+	_, err = repo.AddReaction(&entity.Reaction{PostID: "2", CommentID: "c1", UserID: "u1", Emoji: "👍"})
+	assert.ErrorIs(t, err, database.ErrCommentNotFound, "the comment must be on the post")
+
+	require.NoError(t, repo.DeleteComment("c1"))
+	reactions, err = repo.GetReactions("u2", []entity.ReactionTarget{comment})
+	require.NoError(t, err)
+	assert.Empty(t, reactions, "reactions are deleted with the comment")
+
+	react(entity.ReactionTarget{PostID: "1", CommentID: "c2"}, "u1", "😮")
+	require.NoError(t, repo.DeletePost("1"))
+	createPosts(t, repo, newPost("1", 0))
+	createComments(t, repo, newComment("c2", "1", nil, time.Second))
+	reactions, err = repo.GetReactions("u1", []entity.ReactionTarget{post, {PostID: "1", CommentID: "c2"}})
+	require.NoError(t, err)
+	assert.Empty(t, reactions, "reactions are deleted with the post")
+}
+
+func testSearch(t *testing.T, repo database.Repo) {
+	posts := []*entity.Post{newPost("1", 0), newPost("2", time.Second), newPost("3", 2*time.Second)}
+	posts[0].Title, posts[0].Content = "Redis guide", "How to <index> data in Redis: Redis is fast."
+	posts[1].Title, posts[1].Content = "Postgres", "Postgres has a GIN index and can do more than Redis, much more than it."
+	posts[2].Title, posts[2].Content = "Cooking", "Soup"
+	createPosts(t, repo, posts...)
+
+	comments := []*entity.Comment{newComment("c1", "1", nil, 0), newComment("c2", "1", nil, time.Second), newComment("c3", "2", nil, 2*time.Second)}
+	comments[0].Content, comments[1].Content, comments[2].Content = "Привет, мир", "Мир, труд, май", "Ответ"
+	createComments(t, repo, comments...)
+
+	find := func(text string, kind database.SearchType, first int, after *database.SearchCursor) ([]*database.SearchHit, bool) {
+		t.Helper()
+		hits, hasNext, err := repo.Search(database.SearchQuery{Text: text, Type: kind, First: first, After: after})
+		require.NoError(t, err)
+		return hits, hasNext
+	}
+	ids := func(hits []*database.SearchHit) []string {
+		result := make([]string, 0, len(hits))
+		for _, hit := range hits {
+			result = append(result, hit.ID())
+		}
+		return result
+	}
+
+	hits, hasNext := find("REDIS", database.SearchPosts, 10, nil)
+	assert.Equal(t, []string{"1", "2"}, ids(hits), "the post naming Redis most often in fewer words comes first")
+	assert.False(t, hasNext)
+	assert.Greater(t, hits[0].Rank, hits[1].Rank)
+	assert.Equal(t, "Redis guide", hits[0].Post.Title)
+
+	hits, _ = find("redis index", database.SearchPosts, 10, nil)
+	assert.Len(t, hits, 2, "every word has to occur, in the title or the content")
+	hits, _ = find("guide index", database.SearchPosts, 10, nil)
+	require.Equal(t, []string{"1"}, ids(hits))
+	assert.Contains(t, hits[0].Snippet, "&lt;<b>index</b>&gt; data")
+	hits, _ = find("redis soup", database.SearchPosts, 10, nil)
+	assert.Empty(t, hits)
+	hits, _ = find(" ?! ", database.SearchPosts, 10, nil)
+	assert.Empty(t, hits, "a query without words matches nothing")
+
+	hits, hasNext = find("мир", database.SearchComments, 1, nil)
+	require.Len(t, hits, 1)
+	assert.True(t, hasNext)
+	assert.Equal(t, "1", hits[0].Comment.PostID)
+	cursor := hits[0].Cursor()
+	rest, hasNext := find("мир", database.SearchComments, 1, &cursor)
+	require.Len(t, rest, 1)
+	assert.False(t, hasNext)
+	assert.ElementsMatch(t, []string{"c1", "c2"}, append(ids(hits), ids(rest)...))
+	hits, _ = find("мир", database.SearchPosts, 10, nil)
+	assert.Empty(t, hits, "posts and comments are searched separately")
+
+	posts[2].Title = "Redis soup"
+	_, err := repo.UpdatePost(posts[2])
+	require.NoError(t, err)
+	hits, _ = find("redis soup", database.SearchPosts, 10, nil)
+	assert.Equal(t, []string{"3"}, ids(hits), "edited posts are found by their new words")
+
+	comments[0].Content = "Пока"
+	_, err = repo.UpdateComment(comments[0])
+	require.NoError(t, err)
+	hits, _ = find("мир", database.SearchComments, 10, nil)
+	assert.Equal(t, []string{"c2"}, ids(hits), "edited comments are no longer found by their old words")
+	hits, _ = find("пока", database.SearchComments, 10, nil)
+	assert.Equal(t, []string{"c1"}, ids(hits))
+
+	parentID := "c2"
+	createComments(t, repo, newComment("c4", "1", &parentID, 3*time.Second))
+	require.NoError(t, repo.DeleteComment("c2"))
+	require.NoError(t, repo.DeleteComment("c1"))
+	hits, _ = find("мир", database.SearchComments, 10, nil)
+	assert.Empty(t, hits, "deleted comments are not found, even with replies left")
+	hits, _ = find("пока", database.SearchComments, 10, nil)
+	assert.Empty(t, hits)
+
+	require.NoError(t, repo.DeletePost("2"))
+	hits, _ = find("postgres", database.SearchPosts, 10, nil)
+	assert.Empty(t, hits)
+	hits, _ = find("ответ", database.SearchComments, 10, nil)
+	assert.Empty(t, hits, "comments are deleted with the post")
+}
+
+func testModeration(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", time.Second))
+	parentID := "c1"
+	createComments(t, repo,
+		newComment("c1", "1", nil, 0), newComment("c2", "1", nil, time.Second),
+		newComment("c3", "1", &parentID, 2*time.Second), newComment("c4", "2", nil, 3*time.Second))
+
+	report := func(id string, commentID string, userID string, offset time.Duration) bool {
+		t.Helper()
+		comment, err := repo.GetCommentById(commentID)
+		require.NoError(t, err)
+		created, err := repo.CreateReport(&entity.Report{
+			ID: id, PostID: comment.PostID, CommentID: commentID, UserID: userID,
+			Reason: "spam", CreatedAt: base.Add(offset),
+		})
+		require.NoError(t, err)
+		return created
+	}
+	queue := func() []*database.ModerationItem {
+		t.Helper()
+		items, err := repo.GetModerationQueue(10, 0)
+		require.NoError(t, err)
+		return items
+	}
+	queueIDs := func(items []*database.ModerationItem) []string {
+		ids := make([]string, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, item.Comment.ID)
+		}
+		return ids
+	}
+
+	assert.Empty(t, queue())
+	assert.True(t, report("r1", "c2", "u1", 0))
+	assert.False(t, report("r2", "c2", "u1", time.Second), "a user has one open report per comment")
+	assert.True(t, report("r3", "c2", "u2", 2*time.Second))
+	assert.True(t, report("r4", "c1", "u1", 3*time.Second))
+	assert.True(t, report("r5", "c3", "u1", time.Second))
+	_, err := repo.CreateReport(&entity.Report{ID: "r6", PostID: "1", CommentID: "missing", UserID: "u1", Reason: "spam", CreatedAt: base})
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+
+	items := queue()
+	assert.Equal(t, []string{"c2", "c3", "c1"}, queueIDs(items), "most reported first, then reported earliest")
+	require.Len(t, items[0].Reports, 2)
+	assert.Equal(t, "r1", items[0].Reports[0].ID, "reports are oldest first")
+	assert.Equal(t, entity.ReportOpen, items[0].Reports[0].Status)
+	assert.Equal(t, "spam", items[0].Reports[0].Reason)
+	assert.Equal(t, "u2", items[0].Reports[1].UserID)
+
+	page, err := repo.GetModerationQueue(1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c3"}, queueIDs(page))
+	page, err = repo.GetModerationQueue(10, 5)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+
+	comment, err := repo.ModerateComment("c2", true, entity.ReportResolved)
+	require.NoError(t, err)
+	assert.True(t, comment.Hidden)
+	comment, err = repo.GetCommentById("c2")
+	require.NoError(t, err)
+	assert.True(t, comment.Hidden)
+	assert.Equal(t, "Comment c2", comment.Content, "hiding keeps the content for the moderators")
+	assert.Equal(t, []string{"c3", "c1"}, queueIDs(queue()), "moderated comments leave the queue")
+	hits, _, err := repo.Search(database.SearchQuery{Text: "c2", Type: database.SearchComments, First: 10})
+	require.NoError(t, err)
+	assert.Empty(t, hits, "hidden comments are not found")
+
+	assert.True(t, report("r7", "c2", "u1", 4*time.Second), "closed reports do not count against a new one")
+	comment, err = repo.ModerateComment("c2", false, entity.ReportDismissed)
+	require.NoError(t, err)
+	assert.False(t, comment.Hidden)
+	_, err = repo.ModerateComment("missing", true, entity.ReportResolved)
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+
+	dismissed, err := repo.DismissReport("r5")
+	require.NoError(t, err)
+	assert.Equal(t, entity.ReportDismissed, dismissed.Status)
+	assert.Equal(t, "c3", dismissed.CommentID)
+	_, err = repo.DismissReport("r5")
+	assert.ErrorIs(t, err, database.ErrReportNotFound, "only open reports can be dismissed")
+	_, err = repo.DismissReport("r1")
+	assert.ErrorIs(t, err, database.ErrReportNotFound)
+	_, err = repo.DismissReport("missing")
+	assert.ErrorIs(t, err, database.ErrReportNotFound)
+	assert.Equal(t, []string{"c1"}, queueIDs(queue()))
+
+	require.NoError(t, repo.DeleteComment("c1"))
+	assert.Empty(t, queue(), "reports are deleted with the comment, even with replies left")
+
+	assert.True(t, report("r8", "c4", "u1", 5*time.Second))
+	require.NoError(t, repo.DeletePost("2"))
+	assert.Empty(t, queue(), "reports are deleted with the post")
+}
+
+func testPendingComments(t *testing.T, repo database.Repo) {
+	premoderated := newPost("2", 0)
+	premoderated.ModerationMode = entity.ModerationPremoderated
+	createPosts(t, repo, newPost("1", 0), premoderated)
+	parentID := "p1"
+	createComments(t, repo,
+		newComment("c1", "1", nil, 0),
+		newComment("p2", "2", nil, 2*time.Second),
+		newComment("p1", "2", nil, time.Second),
+		newComment("p3", "2", &parentID, 3*time.Second),
+	)
+
+	pending := func(limit int, offset int) []string {
+		comments, err := repo.GetPendingComments(limit, offset)
+		require.NoError(t, err)
+		return commentIDs(comments)
+	}
+	assert.Equal(t, []string{"p1", "p2", "p3"}, pending(10, 0), "oldest first")
+	assert.Equal(t, []string{"p2"}, pending(1, 1))
+	assert.Empty(t, pending(10, 3))
+	assert.Empty(t, pending(0, 0), "an empty page is not the whole queue")
+	assert.Equal(t, []string{"p1"}, pending(1, -1), "a negative offset starts at the top")
+
+	got, err := repo.GetCommentById("p1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, got.Status)
+	got, err = repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPublished, got.Status)
+	hits, _, err := repo.Search(database.SearchQuery{Text: "p1", Type: database.SearchComments, First: 10})
+	require.NoError(t, err)
+	assert.Empty(t, hits, "pending comments are not found")
+
+	approved, err := repo.ModerateComment("p1", false, entity.ReportDismissed)
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPublished, approved.Status)
+	got, err = repo.GetCommentById("p1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPublished, got.Status)
+	assert.Equal(t, []string{"p2", "p3"}, pending(10, 0))
+	hits, _, err = repo.Search(database.SearchQuery{Text: "p1", Type: database.SearchComments, First: 10})
+	require.NoError(t, err)
+	assert.Len(t, hits, 1, "published comments are found")
+
+	hidden, err := repo.ModerateComment("p2", true, entity.ReportResolved)
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, hidden.Status, "hiding does not publish")
+
+	require.NoError(t, repo.DeleteComment("p2"))
+	assert.Equal(t, []string{"p3"}, pending(10, 0), "deleted comments stop waiting")
+	require.NoError(t, repo.DeletePost("2"))
+	assert.Empty(t, pending(10, 0))
+}
+
+func testHeldComments(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	held := newComment("c1", "1", nil, 0)
+	held.Status = entity.CommentPending
+	held.Tags = []string{"too_many_links"}
+	createComments(t, repo, held, newComment("c2", "1", nil, time.Second))
+
+	got, err := repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, got.Status, "a held comment waits even on an open post")
+	assert.Equal(t, []string{"too_many_links"}, got.Tags)
+
+	edited, err := repo.GetCommentById("c2")
+	require.NoError(t, err)
+	assert.Empty(t, edited.Tags)
+	edited.Content = "Held on edit"
+	edited.Status = entity.CommentPending
+	edited.Tags = []string{"spam", "all_caps"}
+	_, err = repo.UpdateComment(edited)
+	require.NoError(t, err)
+
+	got, err = repo.GetCommentById("c2")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, got.Status)
+	assert.Equal(t, []string{"spam", "all_caps"}, got.Tags)
+	pending, err := repo.GetPendingComments(10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c2"}, commentIDs(pending))
+
+	got.Content = "Clean again"
+	got.Status = entity.CommentPublished
+	got.Tags = nil
+	_, err = repo.UpdateComment(got)
+	require.NoError(t, err)
+	got, err = repo.GetCommentById("c2")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, got.Status, "only a moderator publishes a held comment")
+	assert.Empty(t, got.Tags)
+}
+
+func testSpamTokens(t *testing.T, repo database.Repo) {
+	counts, err := repo.GetSpamTokens([]string{"buy", "now"})
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+
+	train := func(commentID string, tokens []string, spam bool) bool {
+		t.Helper()
+		trained, err := repo.TrainSpamFilter(commentID, tokens, spam)
+		require.NoError(t, err)
+		return trained
+	}
+	assert.True(t, train("c1", []string{"buy", "now", "*"}, true))
+	assert.True(t, train("c2", []string{"buy", "*"}, true))
+	assert.False(t, train("c2", []string{"buy", "*"}, true), "a comment is trained once per verdict")
+	assert.True(t, train("c1", []string{"now", "hello", "*"}, false))
+	assert.True(t, train("c3", nil, false))
+
+	counts, err = repo.GetSpamTokens([]string{"buy", "now", "hello", "missing", "*"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*entity.SpamToken{
+		"buy":   {Token: "buy", Spam: 2},
+		"now":   {Token: "now", Spam: 1, Ham: 1},
+		"hello": {Token: "hello", Ham: 1},
+		"*":     {Token: "*", Spam: 2, Ham: 1},
+	}, counts)
+}
+
+func testVisibleComments(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0), newPost("2", 0))
+	createComments(t, repo, newComment("c1", "1", nil, 0))
+	_, err := repo.SetPostModerationMode("1", entity.ModerationPremoderated)
+	require.NoError(t, err)
+	mine, theirs := newComment("c2", "1", nil, time.Second), newComment("c3", "1", nil, 2*time.Second)
+	mine.AuthorID, theirs.AuthorID = "u1", "u2"
+	createComments(t, repo, mine, theirs)
+	_, err = repo.SetPostModerationMode("1", entity.ModerationOpen)
+	require.NoError(t, err)
+	createComments(t, repo,
+		newComment("c4", "1", nil, 3*time.Second),
+		newComment("c5", "1", nil, 4*time.Second),
+		newComment("c6", "2", nil, 0),
+	)
+
+	anonymous, author, moderator := database.Viewer{}, database.Viewer{UserID: "u1"}, database.Viewer{Moderator: true}
+	page := func(viewer database.Viewer, limit int, offset int, order database.CommentSort) []string {
+		t.Helper()
+		comments, err := repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, order, viewer)
+		require.NoError(t, err)
+		return commentIDs(comments)
+	}
+	assert.Equal(t, []string{"c1", "c4"}, page(anonymous, 2, 0, database.CommentSortOldest), "pages are full")
+	assert.Equal(t, []string{"c5"}, page(anonymous, 2, 2, database.CommentSortOldest))
+	assert.Equal(t, []string{"c5", "c4"}, page(anonymous, 2, 0, database.CommentSortNewest))
+	assert.Equal(t, []string{"c4", "c1"}, page(anonymous, 2, 1, database.CommentSortNewest))
+	assert.Equal(t, []string{"c1", "c2", "c4"}, page(author, 3, 0, database.CommentSortOldest), "authors see their own")
+	assert.Equal(t, []string{"c1", "c2", "c3"}, page(moderator, 3, 0, database.CommentSortOldest))
+	assert.Equal(t, []string{"c4", "c5"}, page(anonymous, 2, 1, database.CommentSortTop))
+	assert.Equal(t, []string{"c4", "c1"}, page(anonymous, 2, 1, database.CommentSortHot))
+	comments, err := repo.GetCommentsForPostWithLimitAndOffset("1", nil, nil, database.CommentSortOldest, author)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c2", "c4", "c5"}, commentIDs(comments))
+
+	after := func(viewer database.Viewer, first int, cursor *database.Cursor) ([]string, bool) {
+		t.Helper()
+		comments, hasNext, err := repo.GetCommentsForPostAfter("1", first, cursor, viewer)
+		require.NoError(t, err)
+		return commentIDs(comments), hasNext
+	}
+	ids, hasNext := after(anonymous, 2, nil)
+	assert.Equal(t, []string{"c1", "c4"}, ids)
+	assert.True(t, hasNext)
+	ids, hasNext = after(anonymous, 1, &database.Cursor{CreatedAt: base.Add(3 * time.Second), ID: "c4"})
+	assert.Equal(t, []string{"c5"}, ids)
+	assert.False(t, hasNext)
+	ids, hasNext = after(anonymous, 1, &database.Cursor{CreatedAt: base, ID: "c1"})
+	assert.Equal(t, []string{"c4"}, ids, "the cursor skips hidden comments")
+	assert.True(t, hasNext)
+	ids, hasNext = after(author, 2, nil)
+	assert.Equal(t, []string{"c1", "c2"}, ids)
+	assert.True(t, hasNext)
+	ids, hasNext = after(moderator, 5, nil)
+	assert.Equal(t, []string{"c1", "c2", "c3", "c4", "c5"}, ids)
+	assert.False(t, hasNext)
+
+	_, err = repo.ModerateComment("c3", false, entity.ReportDismissed)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteComment("c2"))
+	ids, _ = after(anonymous, 5, nil)
+	assert.Equal(t, []string{"c1", "c3", "c4", "c5"}, ids, "approved comments show up for everyone")
+}
+
+func testVisibleCommentTrees(t *testing.T, repo database.Repo) {
+	createPosts(t, repo, newPost("1", 0))
+	a, c, d := "a", "c", "d"
+	createComments(t, repo, newComment("a", "1", nil, 0), newComment("a1", "1", &a, time.Second))
+	_, err := repo.SetPostModerationMode("1", entity.ModerationPremoderated)
+	require.NoError(t, err)
+	sibling, child := newComment("b", "1", nil, 2*time.Second), newComment("a2", "1", &a, 3*time.Second)
+	sibling.AuthorID, child.AuthorID = "u1", "u2"
+	createComments(t, repo, sibling, child)
+	_, err = repo.SetPostModerationMode("1", entity.ModerationOpen)
+	require.NoError(t, err)
+	createComments(t, repo,
+		newComment("c", "1", nil, 4*time.Second),
+		newComment("a3", "1", &a, 5*time.Second),
+		newComment("d", "1", nil, 6*time.Second),
+		newComment("d1", "1", &d, 7*time.Second),
+	)
+	_, err = repo.SetPostModerationMode("1", entity.ModerationPremoderated)
+	require.NoError(t, err)
+	createComments(t, repo, newComment("c1", "1", &c, 8*time.Second))
+
+	anonymous, author, moderator := database.Viewer{}, database.Viewer{UserID: "u1"}, database.Viewer{Moderator: true}
+	tree := func(parentID string, offset int, depth int, order database.CommentSort, viewer database.Viewer) []string {
+		t.Helper()
+		opts := database.TreeOptions{First: 2, Offset: offset, MaxDepth: depth, Order: order, Viewer: viewer}
+		return commentIDs(commentTree(t, repo, "1", parentID, opts))
+	}
+	assert.Equal(t, []string{"a", "c", "a1", "a3"}, tree("", 0, 2, database.CommentSortOldest, anonymous), "pages are full")
+	assert.Equal(t, []string{"c", "d", "d1"}, tree("", 1, 2, database.CommentSortOldest, anonymous))
+	assert.Equal(t, []string{"d", "c", "d1"}, tree("", 0, 2, database.CommentSortNewest, anonymous))
+	assert.Equal(t, []string{"a1", "a3"}, tree("a", 0, 1, database.CommentSortOldest, anonymous))
+	assert.Equal(t, []string{"a3", "a1"}, tree("a", 0, 1, database.CommentSortHot, anonymous))
+	assert.Equal(t, []string{"a", "b", "a1", "a3"}, tree("", 0, 2, database.CommentSortOldest, author), "authors see their own")
+	assert.Equal(t, []string{"a", "b", "a1", "a2"}, tree("", 0, 2, database.CommentSortOldest, moderator))
+	assert.Equal(t, []string{"a3", "a2"}, tree("a", 0, 1, database.CommentSortHot, moderator))
+	assert.Equal(t, []string{"a", "d"}, tree("", 0, 1, database.CommentSortTop, anonymous), "hidden replies are not counted")
+	assert.Equal(t, []string{"a", "c"}, tree("", 0, 1, database.CommentSortTop, moderator))
+}
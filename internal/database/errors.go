@@ -0,0 +1,15 @@
+package database
+
+import (
+	"errors"
+)
+
+// Every Repo implementation reports these conditions with the same errors,
+// so callers can tell them apart without knowing which backend is in use.
+var ErrPostNotFound = errors.New("post not found")
+var ErrCommentNotFound = errors.New("comment not found")
+var ErrCommentsNotActive = errors.New("post comments are not active")
+var ErrParentOnOtherPost = errors.New("parent comment belongs to another post")
+var ErrUserNotFound = errors.New("user not found")
+var ErrUserExists = errors.New("user name is taken")
+var ErrReportNotFound = errors.New("report not found")
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+func (m *Repo) AddReaction(reaction *entity.Reaction) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkReactionTarget(reaction.Target()); err != nil {
+		return false, err
+	}
+
+	emojis := m.reactions[reaction.Target()]
+	if emojis == nil {
+		emojis = make(map[string]map[string]struct{})
+		m.reactions[reaction.Target()] = emojis
+	}
+	users := emojis[reaction.Emoji]
+	if users == nil {
+		users = make(map[string]struct{})
+		emojis[reaction.Emoji] = users
+	}
+	if _, ok := users[reaction.UserID]; ok {
+		return false, nil
+	}
+	users[reaction.UserID] = struct{}{}
+	return true, nil
+}
+
+func (m *Repo) RemoveReaction(reaction *entity.Reaction) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	emojis := m.reactions[reaction.Target()]
+	users := emojis[reaction.Emoji]
+	if _, ok := users[reaction.UserID]; !ok {
+		return false, nil
+	}
+
+	delete(users, reaction.UserID)
+	if len(users) == 0 {
+		delete(emojis, reaction.Emoji)
+	}
+	if len(emojis) == 0 {
+		delete(m.reactions, reaction.Target())
+	}
+	return true, nil
+}
+
+func (m *Repo) GetReactions(userID string, targets []entity.ReactionTarget) (map[entity.ReactionTarget][]*entity.ReactionCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[entity.ReactionTarget][]*entity.ReactionCount)
+	for _, target := range targets {
+		if _, done := result[target]; done {
+			continue
+		}
+		for emoji, users := range m.reactions[target] {
+			_, reacted := users[userID]
+			result[target] = append(result[target], &entity.ReactionCount{Emoji: emoji, Count: len(users), ReactedByMe: reacted})
+		}
+	}
+	return result, nil
+}
+
+// checkReactionTarget fails unless the post, and the comment on it if any, exist.
+func (m *Repo) checkReactionTarget(target entity.ReactionTarget) error {
+	if _, ok := m.posts[target.PostID]; !ok {
+		return fmt.Errorf("%w: %s", database.ErrPostNotFound, target.PostID)
+	}
+	if target.CommentID == "" {
+		return nil
+	}
+	if comment, ok := m.comments[target.CommentID]; !ok || comment.PostID != target.PostID {
+		return fmt.Errorf("%w: %s", database.ErrCommentNotFound, target.CommentID)
+	}
+	return nil
+}
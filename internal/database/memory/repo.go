@@ -0,0 +1,429 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+// Repo keeps every post, comment and user in process memory. It is meant for tests,
+// demos and local development; data only survives a restart through Save and Load.
+//
+// Entities are copied on the way in and out, so callers can never change stored
+// data without going through the repo.
+type Repo struct {
+	mu            sync.RWMutex
+	posts         map[string]*entity.Post
+	comments      map[string]*entity.Comment
+	revisions     map[string][]*entity.CommentRevision
+	nextRevID     uint
+	users         map[string]*entity.User
+	userNames     map[string]string
+	votes         map[string]map[string]entity.Vote                        // comment ID -> user ID -> vote
+	reactions     map[entity.ReactionTarget]map[string]map[string]struct{} // target -> emoji -> user IDs
+	reports       map[string]*entity.Report
+	spamTokens    map[string]*entity.SpamToken
+	spamTrainings map[entity.SpamTraining]struct{}
+}
+
+func NewRepo() *Repo {
+	return &Repo{
+		posts:         make(map[string]*entity.Post),
+		comments:      make(map[string]*entity.Comment),
+		revisions:     make(map[string][]*entity.CommentRevision),
+		users:         make(map[string]*entity.User),
+		userNames:     make(map[string]string),
+		votes:         make(map[string]map[string]entity.Vote),
+		reactions:     make(map[entity.ReactionTarget]map[string]map[string]struct{}),
+		reports:       make(map[string]*entity.Report),
+		spamTokens:    make(map[string]*entity.SpamToken),
+		spamTrainings: make(map[entity.SpamTraining]struct{}),
+	}
+}
+
+func (m *Repo) GetPosts(order database.PostSort) ([]*entity.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	posts := m.sortedPosts(nil)
+	database.SortPosts(posts, order)
+	return posts, nil
+}
+
+func (m *Repo) GetPostsAfter(first int, after *database.Cursor) ([]*entity.Post, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	posts := m.sortedPosts(after)
+	if len(posts) > first {
+		return posts[:first], true, nil
+	}
+	return posts, false, nil
+}
+
+func (m *Repo) CreatePost(post *entity.Post) (*entity.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	database.RankPost(post)
+	m.posts[post.ID] = copyPost(post)
+	return post, nil
+}
+
+func (m *Repo) GetPostById(id string) (*entity.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	post, ok := m.posts[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrPostNotFound, id)
+	}
+	return copyPost(post), nil
+}
+
+func (m *Repo) UpdatePost(post *entity.Post) (*entity.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.posts[post.ID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrPostNotFound, post.ID)
+	}
+
+	stored.Title = post.Title
+	stored.Content = post.Content
+	stored.UpdatedAt = post.UpdatedAt
+	return post, nil
+}
+
+func (m *Repo) DeletePost(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.posts[id]; !ok {
+		return fmt.Errorf("%w: %s", database.ErrPostNotFound, id)
+	}
+
+	for commentID, comment := range m.comments {
+		if comment.PostID == id {
+			delete(m.comments, commentID)
+			delete(m.revisions, commentID)
+			delete(m.votes, commentID)
+		}
+	}
+	for target := range m.reactions {
+		if target.PostID == id {
+			delete(m.reactions, target)
+		}
+	}
+	m.deleteReports(func(report *entity.Report) bool { return report.PostID == id })
+	delete(m.posts, id)
+
+	return nil
+}
+
+func (m *Repo) SetPostModerationMode(id string, mode entity.ModerationMode) (*entity.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	post, ok := m.posts[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrPostNotFound, id)
+	}
+
+	post.ModerationMode = mode
+	post.UpdatedAt = database.Now()
+	return copyPost(post), nil
+}
+
+func (m *Repo) CreateComment(comment *entity.Comment) (*entity.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	post, ok := m.posts[comment.PostID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrPostNotFound, comment.PostID)
+	}
+	if post.ModerationMode == entity.ModerationClosed {
+		return nil, database.ErrCommentsNotActive
+	}
+
+	if comment.ParentID != nil {
+		parent, ok := m.comments[*comment.ParentID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, *comment.ParentID)
+		}
+		if parent.PostID != comment.PostID {
+			return nil, database.ErrParentOnOtherPost
+		}
+	}
+
+	if post.ModerationMode == entity.ModerationPremoderated || comment.Status == entity.CommentPending {
+		comment.Status = entity.CommentPending
+	} else {
+		comment.Status = entity.CommentPublished
+	}
+	database.RankComment(comment)
+	m.comments[comment.ID] = copyComment(comment)
+	return comment, nil
+}
+
+func (m *Repo) GetCommentById(id string) (*entity.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comment, ok := m.comments[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, id)
+	}
+	return copyComment(comment), nil
+}
+
+func (m *Repo) GetCommentsForPost(postID string) ([]*entity.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sortedComments(postID, nil), nil
+}
+
+func (m *Repo) GetCommentsForPostWithLimitAndOffset(postID string, limit *int, offset *int, order database.CommentSort, viewer database.Viewer) ([]*entity.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comments := visibleComments(m.sortedComments(postID, nil), viewer)
+	database.SortComments(comments, order, replyCounts(comments))
+	if limit == nil || offset == nil {
+		return comments, nil
+	}
+
+	start := min(max(*offset, 0), len(comments))
+	end := min(start+max(*limit, 0), len(comments))
+	return comments[start:end], nil
+}
+
+func (m *Repo) GetCommentsForPostAfter(postID string, first int, after *database.Cursor, viewer database.Viewer) ([]*entity.Comment, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comments := visibleComments(m.sortedComments(postID, after), viewer)
+	if len(comments) > first {
+		return comments[:first], true, nil
+	}
+	return comments, false, nil
+}
+
+func (m *Repo) GetCommentTrees(roots []database.TreeRoot, opts database.TreeOptions) (map[database.TreeRoot][]*entity.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	trees := make(map[database.TreeRoot][]*entity.Comment, len(roots))
+	for _, root := range roots {
+		trees[root] = []*entity.Comment{}
+	}
+	if opts.First <= 0 || opts.MaxDepth <= 0 {
+		return trees, nil
+	}
+
+	// Siblings are grouped under the root they would start, so every parent
+	// in the post, including the post itself, maps to its sorted replies.
+	children := make(map[string]map[database.TreeRoot][]*entity.Comment)
+	counts := make(map[string]map[string]int)
+	for root := range trees {
+		if _, loaded := children[root.PostID]; loaded {
+			continue
+		}
+
+		comments := visibleComments(m.sortedComments(root.PostID, nil), opts.Viewer)
+		counts[root.PostID] = replyCounts(comments)
+		database.SortComments(comments, opts.Order, counts[root.PostID])
+
+		siblings := make(map[database.TreeRoot][]*entity.Comment)
+		for _, comment := range comments {
+			key := database.TreeRoot{PostID: comment.PostID}
+			if comment.ParentID != nil {
+				key.ParentID = *comment.ParentID
+			}
+			siblings[key] = append(siblings[key], comment)
+		}
+		children[root.PostID] = siblings
+	}
+
+	for root := range trees {
+		siblings := children[root.PostID]
+		level := siblings[root]
+		level = level[min(max(opts.Offset, 0), len(level)):]
+		level = level[:min(opts.First, len(level))]
+
+		var tree []*entity.Comment
+		for depth := 1; len(level) > 0; depth++ {
+			tree = append(tree, level...)
+			if depth == opts.MaxDepth {
+				break
+			}
+
+			var next []*entity.Comment
+			for _, comment := range level {
+				replies := siblings[database.TreeRoot{PostID: root.PostID, ParentID: comment.ID}]
+				next = append(next, replies[:min(opts.First, len(replies))]...)
+			}
+			database.SortComments(next, opts.Order, counts[root.PostID])
+			level = next
+		}
+		if tree != nil {
+			trees[root] = tree
+		}
+	}
+
+	return trees, nil
+}
+
+func (m *Repo) UpdateComment(comment *entity.Comment) (*entity.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.comments[comment.ID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, comment.ID)
+	}
+
+	writtenAt := stored.CreatedAt
+	if stored.EditedAt != nil {
+		writtenAt = *stored.EditedAt
+	}
+
+	m.nextRevID++
+	m.revisions[stored.ID] = append(m.revisions[stored.ID], &entity.CommentRevision{
+		ID:        m.nextRevID,
+		CommentID: stored.ID,
+		Content:   stored.Content,
+		CreatedAt: writtenAt,
+	})
+
+	stored.Content = comment.Content
+	stored.EditedAt = copyTime(comment.EditedAt)
+	stored.UpdatedAt = comment.UpdatedAt
+	stored.Tags = slices.Clone(comment.Tags)
+	if comment.Status == entity.CommentPending {
+		stored.Status = entity.CommentPending
+	}
+	return comment, nil
+}
+
+func (m *Repo) DeleteComment(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment, ok := m.comments[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", database.ErrCommentNotFound, id)
+	}
+
+	delete(m.revisions, id)
+	m.deleteReports(func(report *entity.Report) bool { return report.CommentID == id })
+
+	for _, other := range m.comments {
+		if other.ParentID != nil && *other.ParentID == id {
+			comment.Content = entity.DeletedCommentContent
+			comment.Deleted = true
+			comment.UpdatedAt = database.Now()
+			return nil
+		}
+	}
+
+	delete(m.comments, id)
+	delete(m.votes, id)
+	delete(m.reactions, entity.ReactionTarget{PostID: comment.PostID, CommentID: id})
+	return nil
+}
+
+func (m *Repo) GetCommentRevisions(commentID string) ([]*entity.CommentRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := make([]*entity.CommentRevision, 0, len(m.revisions[commentID]))
+	for _, revision := range m.revisions[commentID] {
+		copied := *revision
+		revisions = append(revisions, &copied)
+	}
+	return revisions, nil
+}
+
+// sortedPosts returns copies of the posts after the cursor, ordered by creation time and then by ID.
+func (m *Repo) sortedPosts(after *database.Cursor) []*entity.Post {
+	posts := make([]*entity.Post, 0, len(m.posts))
+	for _, post := range m.posts {
+		if after == nil || after.Precedes(post.CreatedAt, post.ID) {
+			posts = append(posts, copyPost(post))
+		}
+	}
+
+	database.SortPosts(posts, database.PostSortOldest)
+	return posts
+}
+
+// sortedComments returns copies of the post's comments after the cursor, ordered by creation time and then by ID.
+func (m *Repo) sortedComments(postID string, after *database.Cursor) []*entity.Comment {
+	comments := []*entity.Comment{}
+	for _, comment := range m.comments {
+		if comment.PostID != postID {
+			continue
+		}
+		if after == nil || after.Precedes(comment.CreatedAt, comment.ID) {
+			comments = append(comments, copyComment(comment))
+		}
+	}
+
+	database.SortComments(comments, database.CommentSortOldest, nil)
+	return comments
+}
+
+// visibleComments filters the comments in place, keeping the ones the viewer can see.
+func visibleComments(comments []*entity.Comment, viewer database.Viewer) []*entity.Comment {
+	visible := comments[:0]
+	for _, comment := range comments {
+		if viewer.CanSee(comment) {
+			visible = append(visible, comment)
+		}
+	}
+	return visible
+}
+
+// replyCounts returns the number of direct replies to each of the comments.
+func replyCounts(comments []*entity.Comment) map[string]int {
+	counts := make(map[string]int)
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			counts[*comment.ParentID]++
+		}
+	}
+	return counts
+}
+
+func copyPost(post *entity.Post) *entity.Post {
+	copied := *post
+	return &copied
+}
+
+func copyComment(comment *entity.Comment) *entity.Comment {
+	copied := *comment
+	copied.Replies = nil
+	if comment.ParentID != nil {
+		parentID := *comment.ParentID
+		copied.ParentID = &parentID
+	}
+	copied.EditedAt = copyTime(comment.EditedAt)
+	copied.Tags = slices.Clone(comment.Tags)
+	return &copied
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
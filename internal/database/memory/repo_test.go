@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/database/databasetest"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_Conformance(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Repo {
+		return NewRepo()
+	})
+}
+
+func TestRepo_ReturnsCopies(t *testing.T) {
+	repo := NewRepo()
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "1", PostID: "1", Content: "Content comment 1"})
+	require.NoError(t, err)
+
+	comment, err := repo.GetCommentById("1")
+	require.NoError(t, err)
+	comment.Content = "Changed outside the repo"
+
+	stored, err := repo.GetCommentById("1")
+	require.NoError(t, err)
+	assert.Equal(t, "Content comment 1", stored.Content)
+}
+
+func TestRepo_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	empty, err := Load(path)
+	require.NoError(t, err)
+	posts, err := empty.GetPosts(database.PostSortOldest)
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+
+	repo := NewRepo()
+	_, err = repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	parentID := "1"
+	_, err = repo.CreateComment(&entity.Comment{ID: "1", PostID: "1", Content: "Content comment 1"})
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "2", PostID: "1", ParentID: &parentID, Content: "Content comment 2"})
+	require.NoError(t, err)
+	editedAt := time.Now()
+	_, err = repo.UpdateComment(&entity.Comment{ID: "1", PostID: "1", Content: "Edited comment 1", EditedAt: &editedAt})
+	require.NoError(t, err)
+	_, err = repo.VoteComment("2", "u1", entity.VoteUp)
+	require.NoError(t, err)
+	_, err = repo.AddReaction(&entity.Reaction{PostID: "1", CommentID: "2", UserID: "u1", Emoji: "👍"})
+	require.NoError(t, err)
+	_, err = repo.CreateReport(&entity.Report{ID: "r1", PostID: "1", CommentID: "2", UserID: "u1", Reason: "spam", CreatedAt: time.Now()})
+	require.NoError(t, err)
+	_, err = repo.TrainSpamFilter("c1", []string{"spam"}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Save(path))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+
+	post, err := loaded.GetPostById("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Post 1", post.Title)
+
+	comments, err := loaded.GetCommentsForPost("1")
+	assert.NoError(t, err)
+	assert.Len(t, comments, 2)
+
+	revisions, err := loaded.GetCommentRevisions("1")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+	assert.Equal(t, "Content comment 1", revisions[0].Content)
+
+	votes, err := loaded.GetCommentVotes("u1", []string{"2"})
+	assert.NoError(t, err)
+	assert.Equal(t, entity.VoteUp, votes["2"])
+
+	target := entity.ReactionTarget{PostID: "1", CommentID: "2"}
+	reactions, err := loaded.GetReactions("u1", []entity.ReactionTarget{target})
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.ReactionCount{{Emoji: "👍", Count: 1, ReactedByMe: true}}, reactions[target])
+
+	queue, err := loaded.GetModerationQueue(10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, queue, 1) {
+		assert.Equal(t, "spam", queue[0].Reports[0].Reason)
+	}
+
+	tokens, err := loaded.GetSpamTokens([]string{"spam"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*entity.SpamToken{"spam": {Token: "spam", Spam: 1}}, tokens)
+	trained, err := loaded.TrainSpamFilter("c1", []string{"spam"}, true)
+	assert.NoError(t, err)
+	assert.False(t, trained, "trained comments are remembered")
+
+	// Revision IDs keep growing after a reload.
+	_, err = loaded.UpdateComment(&entity.Comment{ID: "1", PostID: "1", Content: "Edited comment 2", EditedAt: &editedAt})
+	require.NoError(t, err)
+	revisions, err = loaded.GetCommentRevisions("1")
+	assert.NoError(t, err)
+	assert.Greater(t, revisions[1].ID, revisions[0].ID)
+}
+
+func TestLoad_LegacySnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	legacy := `{"posts": [
+		{"id": "1", "title": "Post 1", "content": "Content 1", "commentsActive": true},
+		{"id": "2", "title": "Post 2", "content": "Content 2", "commentsActive": false}
+	], "comments": [{"id": "c1", "postId": "1", "content": "Comment c1"}]}`
+	require.NoError(t, os.WriteFile(path, []byte(legacy), 0o600))
+
+	repo, err := Load(path)
+	require.NoError(t, err)
+
+	for id, mode := range map[string]entity.ModerationMode{"1": entity.ModerationOpen, "2": entity.ModerationClosed} {
+		post, err := repo.GetPostById(id)
+		require.NoError(t, err)
+		assert.Equal(t, mode, post.ModerationMode, id)
+	}
+	comment, err := repo.GetCommentById("c1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPublished, comment.Status)
+}
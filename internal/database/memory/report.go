@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+func (m *Repo) CreateReport(report *entity.Report) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.comments[report.CommentID]; !ok {
+		return false, fmt.Errorf("%w: %s", database.ErrCommentNotFound, report.CommentID)
+	}
+	for _, other := range m.reports {
+		if other.CommentID == report.CommentID && other.UserID == report.UserID && other.Status == entity.ReportOpen {
+			return false, nil
+		}
+	}
+
+	report.Status = entity.ReportOpen
+	copied := *report
+	m.reports[report.ID] = &copied
+	return true, nil
+}
+
+func (m *Repo) GetModerationQueue(limit int, offset int) ([]*database.ModerationItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byComment := make(map[string]*database.ModerationItem)
+	var items []*database.ModerationItem
+	for _, report := range m.reports {
+		if report.Status != entity.ReportOpen {
+			continue
+		}
+		item, ok := byComment[report.CommentID]
+		if !ok {
+			item = &database.ModerationItem{Comment: copyComment(m.comments[report.CommentID])}
+			byComment[report.CommentID] = item
+			items = append(items, item)
+		}
+		copied := *report
+		item.Reports = append(item.Reports, &copied)
+	}
+
+	database.SortModerationQueue(items)
+	if offset >= len(items) {
+		return []*database.ModerationItem{}, nil
+	}
+	return items[offset:min(len(items), offset+limit)], nil
+}
+
+func (m *Repo) ModerateComment(id string, hidden bool, status entity.ReportStatus) (*entity.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment, ok := m.comments[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, id)
+	}
+
+	comment.Hidden = hidden
+	if !hidden {
+		comment.Status = entity.CommentPublished
+	}
+	for _, report := range m.reports {
+		if report.CommentID == id && report.Status == entity.ReportOpen {
+			report.Status = status
+		}
+	}
+	return copyComment(comment), nil
+}
+
+func (m *Repo) GetPendingComments(limit int, offset int) ([]*entity.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var pending []*entity.Comment
+	for _, comment := range m.comments {
+		if comment.Status == entity.CommentPending && !comment.Deleted {
+			pending = append(pending, copyComment(comment))
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return database.Cursor{CreatedAt: pending[i].CreatedAt, ID: pending[i].ID}.Precedes(pending[j].CreatedAt, pending[j].ID)
+	})
+	offset = max(offset, 0)
+	if limit <= 0 || offset >= len(pending) {
+		return []*entity.Comment{}, nil
+	}
+	return pending[offset:min(len(pending), offset+limit)], nil
+}
+
+func (m *Repo) DismissReport(id string) (*entity.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report, ok := m.reports[id]
+	if !ok || report.Status != entity.ReportOpen {
+		return nil, fmt.Errorf("%w: %s", database.ErrReportNotFound, id)
+	}
+
+	report.Status = entity.ReportDismissed
+	copied := *report
+	return &copied, nil
+}
+
+// deleteReports drops every report for which drop returns true.
+func (m *Repo) deleteReports(drop func(report *entity.Report) bool) {
+	for id, report := range m.reports {
+		if drop(report) {
+			delete(m.reports, id)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/search"
+)
+
+// Search scans every post or comment; the repo holds little enough data for that.
+func (m *Repo) Search(query database.SearchQuery) ([]*database.SearchHit, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := search.Terms(query.Text)
+	var hits []*database.SearchHit
+	if query.Type == database.SearchPosts {
+		for _, post := range m.posts {
+			if hit, ok := database.MatchPost(terms, post); ok {
+				hit.Post = copyPost(post)
+				hits = append(hits, hit)
+			}
+		}
+	} else {
+		for _, comment := range m.comments {
+			if hit, ok := database.MatchComment(terms, comment); ok {
+				hit.Comment = copyComment(comment)
+				hits = append(hits, hit)
+			}
+		}
+	}
+
+	page, hasNext := database.PageHits(terms, hits, query.First, query.After)
+	return page, hasNext, nil
+}
@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/sirupsen/logrus"
+)
+
+// snapshot is the on-disk form of the repo.
+type snapshot struct {
+	Posts         []*entity.Post            `json:"posts"`
+	Comments      []*entity.Comment         `json:"comments"`
+	Revisions     []*entity.CommentRevision `json:"revisions"`
+	Users         []*entity.User            `json:"users"`
+	Votes         []*entity.CommentVote     `json:"votes"`
+	Reactions     []*entity.Reaction        `json:"reactions"`
+	Reports       []*entity.Report          `json:"reports"`
+	SpamTokens    []*entity.SpamToken       `json:"spamTokens"`
+	SpamTrainings []*entity.SpamTraining    `json:"spamTrainings"`
+}
+
+// legacySnapshot holds what older snapshots stored differently: posts had a
+// commentsActive flag before they got a moderation mode.
+type legacySnapshot struct {
+	Posts []struct {
+		CommentsActive *bool `json:"commentsActive"`
+	} `json:"posts"`
+}
+
+// Load returns a repo filled from the snapshot at path, or an empty repo if the file does not exist.
+func Load(path string) (*Repo, error) {
+	repo := NewRepo()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logrus.Infof("no memory snapshot at %s, starting empty", path)
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+	var legacy legacySnapshot
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+
+	for i, post := range snap.Posts {
+		if post.ModerationMode == "" {
+			post.ModerationMode = entity.ModerationOpen
+			if active := legacy.Posts[i].CommentsActive; active != nil && !*active {
+				post.ModerationMode = entity.ModerationClosed
+			}
+		}
+		repo.posts[post.ID] = post
+	}
+	for _, comment := range snap.Comments {
+		if comment.Status == "" {
+			comment.Status = entity.CommentPublished
+		}
+		repo.comments[comment.ID] = comment
+	}
+	for _, revision := range snap.Revisions {
+		repo.revisions[revision.CommentID] = append(repo.revisions[revision.CommentID], revision)
+		repo.nextRevID = max(repo.nextRevID, revision.ID)
+	}
+	for _, user := range snap.Users {
+		repo.users[user.ID] = user
+		repo.userNames[user.Name] = user.ID
+	}
+	for _, vote := range snap.Votes {
+		if repo.votes[vote.CommentID] == nil {
+			repo.votes[vote.CommentID] = make(map[string]entity.Vote)
+		}
+		repo.votes[vote.CommentID][vote.UserID] = vote.Value
+	}
+	for _, reaction := range snap.Reactions {
+		emojis := repo.reactions[reaction.Target()]
+		if emojis == nil {
+			emojis = make(map[string]map[string]struct{})
+			repo.reactions[reaction.Target()] = emojis
+		}
+		if emojis[reaction.Emoji] == nil {
+			emojis[reaction.Emoji] = make(map[string]struct{})
+		}
+		emojis[reaction.Emoji][reaction.UserID] = struct{}{}
+	}
+	for _, report := range snap.Reports {
+		repo.reports[report.ID] = report
+	}
+	for _, token := range snap.SpamTokens {
+		repo.spamTokens[token.Token] = token
+	}
+	for _, training := range snap.SpamTrainings {
+		repo.spamTrainings[*training] = struct{}{}
+	}
+
+	logrus.Infof("loaded %d posts and %d comments from %s", len(snap.Posts), len(snap.Comments), path)
+	return repo, nil
+}
+
+// Save writes the whole repo, spam filter training included, to path.
+// The file is replaced atomically, so a crash never leaves a truncated snapshot behind.
+func (m *Repo) Save(path string) error {
+	m.mu.RLock()
+	snap := snapshot{
+		Posts:         m.sortedPosts(nil),
+		Comments:      make([]*entity.Comment, 0, len(m.comments)),
+		Revisions:     []*entity.CommentRevision{},
+		Users:         make([]*entity.User, 0, len(m.users)),
+		Votes:         []*entity.CommentVote{},
+		Reactions:     []*entity.Reaction{},
+		Reports:       make([]*entity.Report, 0, len(m.reports)),
+		SpamTokens:    make([]*entity.SpamToken, 0, len(m.spamTokens)),
+		SpamTrainings: make([]*entity.SpamTraining, 0, len(m.spamTrainings)),
+	}
+	for _, comment := range m.comments {
+		snap.Comments = append(snap.Comments, copyComment(comment))
+	}
+	for _, revisions := range m.revisions {
+		snap.Revisions = append(snap.Revisions, revisions...)
+	}
+	for _, user := range m.users {
+		snap.Users = append(snap.Users, copyUser(user))
+	}
+	for commentID, votes := range m.votes {
+		for userID, value := range votes {
+			snap.Votes = append(snap.Votes, &entity.CommentVote{CommentID: commentID, UserID: userID, Value: value})
+		}
+	}
+	for target, emojis := range m.reactions {
+		for emoji, users := range emojis {
+			for userID := range users {
+				snap.Reactions = append(snap.Reactions, &entity.Reaction{PostID: target.PostID, CommentID: target.CommentID, UserID: userID, Emoji: emoji})
+			}
+		}
+	}
+	for _, report := range m.reports {
+		copied := *report
+		snap.Reports = append(snap.Reports, &copied)
+	}
+	for _, token := range m.spamTokens {
+		copied := *token
+		snap.SpamTokens = append(snap.SpamTokens, &copied)
+	}
+	for training := range m.spamTrainings {
+		snap.SpamTrainings = append(snap.SpamTrainings, &training)
+	}
+	data, err := json.Marshal(snap)
+	m.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+
+	logrus.Infof("saved %d posts and %d comments to %s", len(snap.Posts), len(snap.Comments), path)
+	return nil
+}
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+func (m *Repo) TrainSpamFilter(commentID string, tokens []string, spam bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	training := entity.SpamTraining{CommentID: commentID, Spam: spam}
+	if _, ok := m.spamTrainings[training]; ok {
+		return false, nil
+	}
+	m.spamTrainings[training] = struct{}{}
+
+	for _, token := range tokens {
+		counts, ok := m.spamTokens[token]
+		if !ok {
+			counts = &entity.SpamToken{Token: token}
+			m.spamTokens[token] = counts
+		}
+		if spam {
+			counts.Spam++
+		} else {
+			counts.Ham++
+		}
+	}
+	return true, nil
+}
+
+func (m *Repo) GetSpamTokens(tokens []string) (map[string]*entity.SpamToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]*entity.SpamToken, len(tokens))
+	for _, token := range tokens {
+		if counts, ok := m.spamTokens[token]; ok {
+			copied := *counts
+			result[token] = &copied
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+func (m *Repo) CreateUser(user *entity.User) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, taken := m.userNames[user.Name]; taken {
+		return nil, fmt.Errorf("%w: %s", database.ErrUserExists, user.Name)
+	}
+
+	m.users[user.ID] = copyUser(user)
+	m.userNames[user.Name] = user.ID
+	return user, nil
+}
+
+func (m *Repo) GetUserByName(name string) (*entity.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.userNames[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrUserNotFound, name)
+	}
+	return copyUser(m.users[id]), nil
+}
+
+func (m *Repo) GetUsers(ids []string) ([]*entity.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]*entity.User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := m.users[id]; ok {
+			users = append(users, copyUser(user))
+		}
+	}
+	return users, nil
+}
+
+func (m *Repo) SetUserRole(id string, role entity.Role) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrUserNotFound, id)
+	}
+	user.Role = role
+	return copyUser(user), nil
+}
+
+func copyUser(user *entity.User) *entity.User {
+	copied := *user
+	return &copied
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+func (m *Repo) VoteComment(commentID string, userID string, value entity.Vote) (*entity.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment, ok := m.comments[commentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, commentID)
+	}
+
+	votes := m.votes[commentID]
+	if votes == nil {
+		votes = make(map[string]entity.Vote)
+		m.votes[commentID] = votes
+	}
+
+	up, down := database.VoteDelta(votes[userID], value)
+	if value == entity.VoteNone {
+		delete(votes, userID)
+	} else {
+		votes[userID] = value
+	}
+	comment.Upvotes += up
+	comment.Downvotes += down
+	database.RankComment(comment)
+
+	if post, ok := m.posts[comment.PostID]; ok {
+		post.Upvotes += up
+		post.Downvotes += down
+		database.RankPost(post)
+	}
+
+	return copyComment(comment), nil
+}
+
+func (m *Repo) GetCommentVotes(userID string, commentIDs []string) (map[string]entity.Vote, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]entity.Vote)
+	for _, commentID := range commentIDs {
+		if value, ok := m.votes[commentID][userID]; ok {
+			result[commentID] = value
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+// ModerationItem is a comment in the moderation queue with its open reports, oldest first.
+type ModerationItem struct {
+	Comment *entity.Comment
+	Reports []*entity.Report
+}
+
+// SortModerationQueue orders the queue in place for backends that cannot sort natively:
+// the comments with the most open reports first, then the ones reported earliest.
+func SortModerationQueue(items []*ModerationItem) {
+	for _, item := range items {
+		sort.Slice(item.Reports, func(i, j int) bool {
+			a, b := item.Reports[i], item.Reports[j]
+			return Cursor{CreatedAt: a.CreatedAt, ID: a.ID}.Precedes(b.CreatedAt, b.ID)
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if len(a.Reports) != len(b.Reports) {
+			return len(a.Reports) > len(b.Reports)
+		}
+		reportedAt := Cursor{CreatedAt: a.Reports[0].CreatedAt, ID: a.Comment.ID}
+		return reportedAt.Precedes(b.Reports[0].CreatedAt, b.Comment.ID)
+	})
+}
+
+// Viewer is who comments are listed for: pending comments only show up for their
+// author and for moderators. The zero Viewer is an anonymous reader.
+type Viewer struct {
+	UserID    string
+	Moderator bool
+}
+
+// CanSee reports whether the comment shows up for the viewer.
+func (v Viewer) CanSee(comment *entity.Comment) bool {
+	return comment.Status != entity.CommentPending || v.Moderator || (v.UserID != "" && v.UserID == comment.AuthorID)
+}
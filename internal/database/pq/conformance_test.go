@@ -0,0 +1,30 @@
+package pq
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/database/databasetest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRepo_Conformance(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Repo {
+		// A file database is shared by every pooled connection, unlike ":memory:".
+		db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		require.NoError(t, err)
+
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		sqlDB.SetMaxOpenConns(1)
+		t.Cleanup(func() { sqlDB.Close() })
+
+		require.NoError(t, Migrate(db))
+
+		return Repo{db: db}
+	})
+}
@@ -5,21 +5,41 @@ import (
 	"fmt"
 
 	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/apartapatia/wall_of_comments/internal/database"
 	"github.com/apartapatia/wall_of_comments/internal/entity"
 	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+const backfillBatchSize = 500
+
 var ErrMigrateComment = errors.New("failed to migrate comment")
 var ErrMigratePost = errors.New("failed to migrate post")
+var ErrMigrateCommentRevision = errors.New("failed to migrate comment revision")
+var ErrMigrateUser = errors.New("failed to migrate user")
+var ErrMigrateCommentVote = errors.New("failed to migrate comment vote")
+var ErrMigrateReaction = errors.New("failed to migrate reaction")
+var ErrMigrateReport = errors.New("failed to migrate report")
+var ErrMigrateSpamToken = errors.New("failed to migrate spam token")
+var ErrMigrateSpamTraining = errors.New("failed to migrate spam training")
+var ErrMigrateModerationMode = errors.New("failed to migrate moderation mode")
+var ErrMigrateRanks = errors.New("failed to backfill ranks")
+var ErrMigrateSearch = errors.New("failed to migrate search index")
 
 func GetRepo(cfg config.PostgresConfig) (*Repo, error) {
 	db, err := newClient(cfg)
 	if err != nil {
 		return nil, err
 	}
-	return &Repo{db: db}, nil
+	repo := NewRepo(db)
+	return &repo, nil
+}
+
+// NewRepo wraps an already opened and migrated database. The queries stay within
+// what both Postgres and SQLite support, so the sqlite package reuses this repo.
+func NewRepo(db *gorm.DB) Repo {
+	return Repo{db: db}
 }
 
 func newClient(cfg config.PostgresConfig) (*gorm.DB, error) {
@@ -31,14 +51,15 @@ func newClient(cfg config.PostgresConfig) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	if err := migrateDB(db); err != nil {
+	if err := Migrate(db); err != nil {
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func migrateDB(db *gorm.DB) error {
+// Migrate creates or updates the tables for every entity.
+func Migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(&entity.Comment{}); err != nil {
 		logrus.Error(ErrMigrateComment)
 		return ErrMigrateComment
@@ -47,5 +68,101 @@ func migrateDB(db *gorm.DB) error {
 		logrus.Error(ErrMigratePost)
 		return ErrMigratePost
 	}
+	if err := migrateModerationMode(db); err != nil {
+		logrus.Errorf("%v: %v", ErrMigrateModerationMode, err)
+		return ErrMigrateModerationMode
+	}
+	if err := db.AutoMigrate(&entity.CommentRevision{}); err != nil {
+		logrus.Error(ErrMigrateCommentRevision)
+		return ErrMigrateCommentRevision
+	}
+	if err := db.AutoMigrate(&entity.User{}); err != nil {
+		logrus.Error(ErrMigrateUser)
+		return ErrMigrateUser
+	}
+	if err := db.AutoMigrate(&entity.CommentVote{}); err != nil {
+		logrus.Error(ErrMigrateCommentVote)
+		return ErrMigrateCommentVote
+	}
+	if err := db.AutoMigrate(&entity.Reaction{}); err != nil {
+		logrus.Error(ErrMigrateReaction)
+		return ErrMigrateReaction
+	}
+	if err := db.AutoMigrate(&entity.Report{}); err != nil {
+		logrus.Error(ErrMigrateReport)
+		return ErrMigrateReport
+	}
+	if err := db.AutoMigrate(&entity.SpamToken{}); err != nil {
+		logrus.Error(ErrMigrateSpamToken)
+		return ErrMigrateSpamToken
+	}
+	if err := db.AutoMigrate(&entity.SpamTraining{}); err != nil {
+		logrus.Error(ErrMigrateSpamTraining)
+		return ErrMigrateSpamTraining
+	}
+	if err := backfillRanks(db); err != nil {
+		logrus.Errorf("%v: %v", ErrMigrateRanks, err)
+		return ErrMigrateRanks
+	}
+	if err := migrateSearch(db); err != nil {
+		logrus.Errorf("%v: %v", ErrMigrateSearch, err)
+		return ErrMigrateSearch
+	}
 	return nil
 }
+
+// migrateModerationMode closes the posts whose comments were turned off before
+// posts had a moderation mode, and drops the old comments_active column. The
+// column is gone afterwards, so later starts skip this.
+func migrateModerationMode(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&entity.Post{}, "comments_active") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.Post{}).Where("NOT comments_active").UpdateColumn("moderation_mode", entity.ModerationClosed).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE posts DROP COLUMN comments_active").Error
+	})
+}
+
+// backfillRanks ranks the posts and comments stored before the rank columns existed.
+// Everything written since is ranked on write, so only rows still holding the
+// column default are touched and the backfill is a no-op on later starts.
+func backfillRanks(db *gorm.DB) error {
+	var comments []*entity.Comment
+	err := db.Where("hot_rank = 0").FindInBatches(&comments, backfillBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, comment := range comments {
+			database.RankComment(comment)
+			if err := tx.Model(comment).UpdateColumns(rankColumns(comment.Upvotes, comment.Downvotes, comment.HotRank, comment.BestRank)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	// Posts collect the votes of their comments, which may have been cast before posts counted them.
+	err = db.Exec(`UPDATE posts SET
+		upvotes = (SELECT COALESCE(SUM(upvotes), 0) FROM comments WHERE comments.post_id = posts.id),
+		downvotes = (SELECT COALESCE(SUM(downvotes), 0) FROM comments WHERE comments.post_id = posts.id)
+		WHERE hot_rank = 0`).Error
+	if err != nil {
+		return err
+	}
+
+	var posts []*entity.Post
+	return db.Where("hot_rank = 0").FindInBatches(&posts, backfillBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, post := range posts {
+			database.RankPost(post)
+			if err := tx.Model(post).UpdateColumns(rankColumns(post.Upvotes, post.Downvotes, post.HotRank, post.BestRank)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
@@ -0,0 +1,90 @@
+package pq
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddReaction holds a share lock on the post and the comment while it inserts,
+// so a reaction can never outlive a concurrently deleted target.
+func (p Repo) AddReaction(reaction *entity.Reaction) (bool, error) {
+	added := false
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockReactionTarget(tx, reaction.Target()); err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+		added = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	return added, nil
+}
+
+func (p Repo) RemoveReaction(reaction *entity.Reaction) (bool, error) {
+	result := p.db.Where("post_id = ? AND comment_id = ? AND user_id = ? AND emoji = ?",
+		reaction.PostID, reaction.CommentID, reaction.UserID, reaction.Emoji).Delete(&entity.Reaction{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to remove reaction: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// GetReactions counts the reactions of all targets in one grouped query.
+func (p Repo) GetReactions(userID string, targets []entity.ReactionTarget) (map[entity.ReactionTarget][]*entity.ReactionCount, error) {
+	result := make(map[entity.ReactionTarget][]*entity.ReactionCount)
+	if len(targets) == 0 {
+		return result, nil
+	}
+
+	pairs := make([][]interface{}, len(targets))
+	for i, target := range targets {
+		pairs[i] = []interface{}{target.PostID, target.CommentID}
+	}
+
+	var rows []struct {
+		PostID    string
+		CommentID string
+		Emoji     string
+		Count     int
+		Reacted   int
+	}
+	err := p.db.Model(&entity.Reaction{}).
+		Select("post_id, comment_id, emoji, COUNT(*) AS count, MAX(CASE WHEN user_id = ? THEN 1 ELSE 0 END) AS reacted", userID).
+		Where("(post_id, comment_id) IN ?", pairs).
+		Group("post_id, comment_id, emoji").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions: %w", err)
+	}
+
+	for _, row := range rows {
+		target := entity.ReactionTarget{PostID: row.PostID, CommentID: row.CommentID}
+		result[target] = append(result[target], &entity.ReactionCount{Emoji: row.Emoji, Count: row.Count, ReactedByMe: row.Reacted == 1})
+	}
+	return result, nil
+}
+
+func lockReactionTarget(tx *gorm.DB, target entity.ReactionTarget) error {
+	var post entity.Post
+	if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id").First(&post, "id = ?", target.PostID).Error; err != nil {
+		return notFound(err, database.ErrPostNotFound)
+	}
+	if target.CommentID == "" {
+		return nil
+	}
+
+	var comment entity.Comment
+	err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id").
+		First(&comment, "id = ? AND post_id = ?", target.CommentID, target.PostID).Error
+	return notFound(err, database.ErrCommentNotFound)
+}
@@ -1,25 +1,42 @@
 package pq
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 
+	"github.com/apartapatia/wall_of_comments/internal/database"
 	"github.com/apartapatia/wall_of_comments/internal/entity"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repo struct {
 	db *gorm.DB
 }
 
-func (p Repo) GetPosts() ([]*entity.Post, error) {
+func (p Repo) GetPosts(order database.PostSort) ([]*entity.Post, error) {
 	var posts []*entity.Post
-	if err := p.db.Find(&posts).Error; err != nil {
+	if err := p.db.Order(postOrder(order)).Find(&posts).Error; err != nil {
 		return nil, err
 	}
 	return posts, nil
 }
 
+func (p Repo) GetPostsAfter(first int, after *database.Cursor) ([]*entity.Post, bool, error) {
+	var posts []*entity.Post
+	if err := afterCursor(p.db, after).Limit(first + 1).Find(&posts).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to get posts: %w", err)
+	}
+
+	if len(posts) > first {
+		return posts[:first], true, nil
+	}
+	return posts, false, nil
+}
+
 func (p Repo) CreatePost(post *entity.Post) (*entity.Post, error) {
+	database.RankPost(post)
 	if err := p.db.Create(post).Error; err != nil {
 		return nil, err
 	}
@@ -29,29 +46,119 @@ func (p Repo) CreatePost(post *entity.Post) (*entity.Post, error) {
 func (p Repo) GetPostById(id string) (*entity.Post, error) {
 	post := &entity.Post{}
 	if err := p.db.First(&post, "id = ?", id).Error; err != nil {
+		return nil, notFound(err, database.ErrPostNotFound)
+	}
+	return post, nil
+}
+
+func (p Repo) UpdatePost(post *entity.Post) (*entity.Post, error) {
+	result := p.db.Model(&entity.Post{}).Where("id = ?", post.ID).Updates(map[string]interface{}{
+		"title":      post.Title,
+		"content":    post.Content,
+		"updated_at": post.UpdatedAt,
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update post with ID %s: %w", post.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("failed to update post with ID %s: %w", post.ID, database.ErrPostNotFound)
+	}
+	return post, nil
+}
+
+func (p Repo) DeletePost(id string) error {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var post entity.Post
+		if err := tx.First(&post, "id = ?", id).Error; err != nil {
+			return notFound(err, database.ErrPostNotFound)
+		}
+
+		postComments := tx.Model(&entity.Comment{}).Select("id").Where("post_id = ?", id)
+		if err := tx.Where("comment_id IN (?)", postComments).Delete(&entity.CommentRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("comment_id IN (?)", postComments).Delete(&entity.CommentVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("post_id = ?", id).Delete(&entity.Reaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("post_id = ?", id).Delete(&entity.Report{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("post_id = ?", id).Delete(&entity.Comment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&post).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete post with ID %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (p Repo) SetPostModerationMode(id string, mode entity.ModerationMode) (*entity.Post, error) {
+	post, err := p.GetPostById(id)
+	if err != nil {
 		return nil, err
 	}
+
+	post.ModerationMode = mode
+	post.UpdatedAt = database.Now()
+	if err := p.db.Model(post).Select("moderation_mode", "updated_at").Updates(post).Error; err != nil {
+		return nil, fmt.Errorf("failed to update post with ID %s: %w", id, err)
+	}
+
 	return post, nil
 }
 
 func (p Repo) CreateComment(comment *entity.Comment) (*entity.Comment, error) {
-	if err := p.db.Create(comment).Error; err != nil {
-		return nil, err
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var post entity.Post
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&post, "id = ?", comment.PostID).Error; err != nil {
+			return notFound(err, database.ErrPostNotFound)
+		}
+		if post.ModerationMode == entity.ModerationClosed {
+			return database.ErrCommentsNotActive
+		}
+
+		if comment.ParentID != nil {
+			var parent entity.Comment
+			if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&parent, "id = ?", *comment.ParentID).Error; err != nil {
+				return notFound(err, database.ErrCommentNotFound)
+			}
+			if parent.PostID != comment.PostID {
+				return database.ErrParentOnOtherPost
+			}
+		}
+
+		if post.ModerationMode == entity.ModerationPremoderated || comment.Status == entity.CommentPending {
+			comment.Status = entity.CommentPending
+		} else {
+			comment.Status = entity.CommentPublished
+		}
+		database.RankComment(comment)
+		return tx.Create(comment).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
 	}
+
 	return comment, nil
 }
 
 func (p Repo) GetCommentById(id string) (*entity.Comment, error) {
 	var comment entity.Comment
 	if err := p.db.First(&comment, "id = ?", id).Error; err != nil {
-		return nil, err
+		return nil, notFound(err, database.ErrCommentNotFound)
 	}
 	return &comment, nil
 }
 
 func (p Repo) GetCommentsForPost(postID string) ([]*entity.Comment, error) {
 	var comments []*entity.Comment
-	if err := p.db.Where("post_id = ?", postID).Find(&comments).Error; err != nil {
+	if err := p.db.Where("post_id = ?", postID).Order("created_at, id").Find(&comments).Error; err != nil {
 		return nil, err
 	}
 
@@ -61,9 +168,12 @@ func (p Repo) GetCommentsForPost(postID string) ([]*entity.Comment, error) {
 	return comments, nil
 }
 
-func (p Repo) GetCommentsForPostWithLimitAndOffset(postID string, limit *int, offset *int) ([]*entity.Comment, error) {
+func (p Repo) GetCommentsForPostWithLimitAndOffset(postID string, limit *int, offset *int, order database.CommentSort, viewer database.Viewer) ([]*entity.Comment, error) {
 	var comments []*entity.Comment
-	query := p.db.Where("post_id = ?", postID)
+	args := visibleArgs(viewer)
+	args["post"] = postID
+	counted := p.db.Raw("SELECT comments.*, ("+replyCountQuery(viewer)+") AS reply_count FROM comments WHERE post_id = @post AND "+visibleQuery("comments", viewer), args)
+	query := p.db.Table("(?) AS comments", counted).Order(commentOrder(order))
 
 	if limit != nil && offset != nil {
 		query = query.Limit(*limit).Offset(*offset)
@@ -75,3 +185,267 @@ func (p Repo) GetCommentsForPostWithLimitAndOffset(postID string, limit *int, of
 
 	return comments, nil
 }
+
+func (p Repo) GetCommentsForPostAfter(postID string, first int, after *database.Cursor, viewer database.Viewer) ([]*entity.Comment, bool, error) {
+	var comments []*entity.Comment
+	query := afterCursor(visibleTo(p.db.Where("post_id = ?", postID), viewer), after)
+	if err := query.Limit(first + 1).Find(&comments).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to get comments for post with ID %s: %w", postID, err)
+	}
+
+	if len(comments) > first {
+		return comments[:first], true, nil
+	}
+	return comments, false, nil
+}
+
+// visibleTo leaves out the pending comments the viewer cannot see.
+func visibleTo(query *gorm.DB, viewer database.Viewer) *gorm.DB {
+	switch {
+	case viewer.Moderator:
+		return query
+	case viewer.UserID == "":
+		return query.Where("status <> ?", entity.CommentPending)
+	default:
+		return query.Where("(status <> ? OR author_id = ?)", entity.CommentPending, viewer.UserID)
+	}
+}
+
+// visibleQuery is the condition that the viewer can see the comment under alias.
+// It takes its named arguments from visibleArgs.
+func visibleQuery(alias string, viewer database.Viewer) string {
+	switch {
+	case viewer.Moderator:
+		return "1 = 1"
+	case viewer.UserID == "":
+		return alias + ".status <> @pending"
+	default:
+		return "(" + alias + ".status <> @pending OR " + alias + ".author_id = @viewer)"
+	}
+}
+
+// visibleArgs returns the named arguments of visibleQuery.
+func visibleArgs(viewer database.Viewer) map[string]interface{} {
+	return map[string]interface{}{"pending": entity.CommentPending, "viewer": viewer.UserID}
+}
+
+// replyCountQuery counts the direct replies of the comment in the enclosing
+// query that the viewer can see.
+func replyCountQuery(viewer database.Viewer) string {
+	return "SELECT COUNT(*) FROM comments AS replies WHERE replies.parent_id = comments.id AND " + visibleQuery("replies", viewer)
+}
+
+// commentTreeQuery ranks siblings in a plain CTE because SQLite does not allow
+// window functions in the recursive part of a query. Every row carries the root
+// it was reached from, so one query serves any number of roots. The comments
+// the viewer cannot see are left out before ranking and counting, so they
+// neither shorten a page nor show up in a reply count.
+const commentTreeQuery = `
+WITH RECURSIVE counted AS (
+	SELECT comments.*, (%[2]s) AS reply_count
+	FROM comments
+	WHERE post_id IN @posts AND %[3]s
+), ranked AS (
+	SELECT *, ROW_NUMBER() OVER (PARTITION BY post_id, parent_id ORDER BY %[1]s) AS sibling_rank
+	FROM counted
+), tree AS (
+	SELECT ranked.*, ranked.post_id AS root_post_id, COALESCE(ranked.parent_id, '') AS root_parent_id, 1 AS depth
+	FROM ranked
+	WHERE ((parent_id IS NULL AND post_id IN @rootPosts) OR parent_id IN @parents)
+		AND sibling_rank > @offset AND sibling_rank <= @offset + @first
+	UNION ALL
+	SELECT ranked.*, tree.root_post_id, tree.root_parent_id, tree.depth + 1
+	FROM ranked
+	JOIN tree ON ranked.parent_id = tree.id
+	WHERE ranked.sibling_rank <= @first AND tree.depth < @depth
+)
+SELECT id, post_id, parent_id, author_id, content, deleted, hidden, status, tags, created_at, updated_at, edited_at, upvotes, downvotes, hot_rank, best_rank, root_post_id, root_parent_id
+FROM tree
+ORDER BY root_post_id, root_parent_id, depth, %[1]s`
+
+// treeRow is a comment of commentTreeQuery together with the root it belongs to.
+type treeRow struct {
+	entity.Comment `gorm:"embedded"`
+	RootPostID     string
+	RootParentID   string
+}
+
+func (p Repo) GetCommentTrees(roots []database.TreeRoot, opts database.TreeOptions) (map[database.TreeRoot][]*entity.Comment, error) {
+	trees := make(map[database.TreeRoot][]*entity.Comment, len(roots))
+	var posts, rootPosts, parents []string
+	for _, root := range roots {
+		trees[root] = []*entity.Comment{}
+		posts = append(posts, root.PostID)
+		if root.ParentID == "" {
+			rootPosts = append(rootPosts, root.PostID)
+		} else {
+			parents = append(parents, root.ParentID)
+		}
+	}
+	if len(roots) == 0 || opts.First <= 0 || opts.MaxDepth <= 0 {
+		return trees, nil
+	}
+
+	args := visibleArgs(opts.Viewer)
+	args["posts"] = posts
+	args["rootPosts"] = rootPosts
+	args["parents"] = parents
+	args["offset"] = max(opts.Offset, 0)
+	args["first"] = opts.First
+	args["depth"] = opts.MaxDepth
+
+	query := fmt.Sprintf(commentTreeQuery, commentOrder(opts.Order), replyCountQuery(opts.Viewer), visibleQuery("comments", opts.Viewer))
+	var rows []treeRow
+	if err := p.db.Raw(query, args).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get comment trees: %w", err)
+	}
+
+	for i := range rows {
+		root := database.TreeRoot{PostID: rows[i].RootPostID, ParentID: rows[i].RootParentID}
+		if tree, requested := trees[root]; requested {
+			trees[root] = append(tree, &rows[i].Comment)
+		}
+	}
+	return trees, nil
+}
+
+func (p Repo) UpdateComment(comment *entity.Comment) (*entity.Comment, error) {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var stored entity.Comment
+		if err := tx.First(&stored, "id = ?", comment.ID).Error; err != nil {
+			return notFound(err, database.ErrCommentNotFound)
+		}
+
+		writtenAt := stored.CreatedAt
+		if stored.EditedAt != nil {
+			writtenAt = *stored.EditedAt
+		}
+
+		revision := &entity.CommentRevision{CommentID: stored.ID, Content: stored.Content, CreatedAt: writtenAt}
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+
+		// Updates with a map skips the serializer of the tags column, so they are encoded here.
+		tags, err := json.Marshal(comment.Tags)
+		if err != nil {
+			return err
+		}
+		columns := map[string]interface{}{
+			"content":    comment.Content,
+			"edited_at":  comment.EditedAt,
+			"updated_at": comment.UpdatedAt,
+			"tags":       string(tags),
+		}
+		if comment.Status == entity.CommentPending {
+			columns["status"] = entity.CommentPending
+		}
+		return tx.Model(&stored).Updates(columns).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update comment with ID %s: %w", comment.ID, err)
+	}
+
+	return comment, nil
+}
+
+func (p Repo) DeleteComment(id string) error {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var comment entity.Comment
+		if err := tx.First(&comment, "id = ?", id).Error; err != nil {
+			return notFound(err, database.ErrCommentNotFound)
+		}
+
+		if err := tx.Where("comment_id = ?", id).Delete(&entity.CommentRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("comment_id = ?", id).Delete(&entity.Report{}).Error; err != nil {
+			return err
+		}
+
+		var replies int64
+		if err := tx.Model(&entity.Comment{}).Where("parent_id = ?", id).Count(&replies).Error; err != nil {
+			return err
+		}
+
+		if replies == 0 {
+			if err := tx.Where("comment_id = ?", id).Delete(&entity.CommentVote{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("comment_id = ?", id).Delete(&entity.Reaction{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&comment).Error
+		}
+
+		return tx.Model(&comment).Updates(map[string]interface{}{
+			"content":    entity.DeletedCommentContent,
+			"deleted":    true,
+			"updated_at": database.Now(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete comment with ID %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (p Repo) GetCommentRevisions(commentID string) ([]*entity.CommentRevision, error) {
+	var revisions []*entity.CommentRevision
+	if err := p.db.Where("comment_id = ?", commentID).Order("created_at, id").Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get revisions for comment with ID %s: %w", commentID, err)
+	}
+	return revisions, nil
+}
+
+func afterCursor(query *gorm.DB, after *database.Cursor) *gorm.DB {
+	query = query.Order("created_at, id")
+	if after == nil {
+		return query
+	}
+	return query.Where("created_at > ? OR (created_at = ? AND id > ?)", after.CreatedAt, after.CreatedAt, after.ID)
+}
+
+func postOrder(order database.PostSort) string {
+	switch order {
+	case database.PostSortNewest:
+		return "created_at DESC, id DESC"
+	case database.PostSortHot:
+		return "hot_rank DESC, created_at DESC, id DESC"
+	case database.PostSortBest:
+		return "best_rank DESC, created_at DESC, id DESC"
+	default:
+		return "created_at, id"
+	}
+}
+
+// controversyQuery is database.Controversy of the comment in the enclosing query.
+const controversyQuery = `(CASE WHEN upvotes = 0 OR downvotes = 0 THEN 0
+	ELSE (upvotes + downvotes + reply_count) * (CASE WHEN upvotes < downvotes THEN upvotes ELSE downvotes END) * 1.0
+		/ (CASE WHEN upvotes < downvotes THEN downvotes ELSE upvotes END) END)`
+
+// commentOrder expects a reply_count column when the order depends on replies.
+func commentOrder(order database.CommentSort) string {
+	switch {
+	case order == database.CommentSortNewest:
+		return "created_at DESC, id DESC"
+	case order == database.CommentSortControversial:
+		return controversyQuery + " DESC, created_at, id"
+	case order.ByReplies():
+		return "reply_count DESC, created_at, id"
+	case order == database.CommentSortHot:
+		return "hot_rank DESC, created_at DESC, id DESC"
+	case order == database.CommentSortBest:
+		return "best_rank DESC, created_at DESC, id DESC"
+	default:
+		return "created_at, id"
+	}
+}
+
+func notFound(err error, notFoundErr error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFoundErr
+	}
+	return err
+}
@@ -3,8 +3,11 @@ package pq
 import (
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/apartapatia/wall_of_comments/internal/database"
 	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/ranking"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -16,7 +19,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("failed to connect database: %v", err)
 	}
 
-	err = db.AutoMigrate(&entity.Post{}, &entity.Comment{})
+	err = db.AutoMigrate(&entity.Post{}, &entity.Comment{}, &entity.CommentRevision{}, &entity.User{}, &entity.CommentVote{}, &entity.Reaction{}, &entity.Report{}, &entity.SpamToken{})
 	if err != nil {
 		t.Fatalf("failed to migrate database: %v", err)
 	}
@@ -24,6 +27,20 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	return db
 }
 
+func editComment(t *testing.T, repo Repo, id string, content string) (*entity.Comment, error) {
+	comment, err := repo.GetCommentById(id)
+	if err != nil {
+		t.Fatalf("failed to get comment: %v", err)
+	}
+
+	now := time.Now()
+	comment.Content = content
+	comment.EditedAt = &now
+	comment.UpdatedAt = now
+
+	return repo.UpdateComment(comment)
+}
+
 func TestRepo_GetPosts(t *testing.T) {
 	db := setupTestDB(t)
 	repo := Repo{db: db}
@@ -39,7 +56,7 @@ func TestRepo_GetPosts(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	retPosts, err := repo.GetPosts()
+	retPosts, err := repo.GetPosts(database.PostSortOldest)
 	assert.NoError(t, err)
 
 	assert.Equal(t, len(posts), len(retPosts))
@@ -52,7 +69,7 @@ func TestRepo_GetPostById(t *testing.T) {
 	db := setupTestDB(t)
 	repo := Repo{db: db}
 
-	post := &entity.Post{Title: "Post 1", Content: "Content 1"}
+	post := &entity.Post{Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
 	_, err := repo.CreatePost(post)
 	assert.NoError(t, err)
 
@@ -68,7 +85,7 @@ func TestRepo_GetCommentsForPost(t *testing.T) {
 	db := setupTestDB(t)
 	repo := Repo{db: db}
 
-	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1"}
+	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
 	_, err := repo.CreatePost(post)
 	assert.NoError(t, err)
 
@@ -85,7 +102,7 @@ func TestRepo_GetCommentsForPostWithLimitAndOffset(t *testing.T) {
 	db := setupTestDB(t)
 	repo := Repo{db: db}
 
-	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1"}
+	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
 	_, err := repo.CreatePost(post)
 	assert.NoError(t, err)
 
@@ -97,7 +114,7 @@ func TestRepo_GetCommentsForPostWithLimitAndOffset(t *testing.T) {
 
 	limit := 10
 	offset := 20
-	comments, err := repo.GetCommentsForPostWithLimitAndOffset(post.ID, &limit, &offset)
+	comments, err := repo.GetCommentsForPostWithLimitAndOffset(post.ID, &limit, &offset, database.CommentSortOldest, database.Viewer{})
 	assert.NoError(t, err)
 	assert.Len(t, comments, limit)
 
@@ -110,7 +127,7 @@ func TestRepo_GetCommentById(t *testing.T) {
 	db := setupTestDB(t)
 	repo := Repo{db: db}
 
-	post := &entity.Post{Title: "Post 1", Content: "Content 1"}
+	post := &entity.Post{Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
 	_, err := repo.CreatePost(post)
 	assert.NoError(t, err)
 
@@ -123,3 +140,247 @@ func TestRepo_GetCommentById(t *testing.T) {
 	assert.NotNil(t, getComment)
 	assert.Equal(t, comment.Content, getComment.Content)
 }
+
+func TestRepo_UpdateComment(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
+	_, err := repo.CreatePost(post)
+	assert.NoError(t, err)
+
+	comment := &entity.Comment{ID: "1", PostID: post.ID, Content: "Content comment 1"}
+	_, err = repo.CreateComment(comment)
+	assert.NoError(t, err)
+
+	_, err = editComment(t, repo, comment.ID, "Content comment 2")
+	assert.NoError(t, err)
+	updated, err := editComment(t, repo, comment.ID, "Content comment 3")
+	assert.NoError(t, err)
+	assert.Equal(t, "Content comment 3", updated.Content)
+	assert.NotNil(t, updated.EditedAt)
+
+	getComment, err := repo.GetCommentById(comment.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Content comment 3", getComment.Content)
+	assert.NotNil(t, getComment.EditedAt)
+
+	revisions, err := repo.GetCommentRevisions(comment.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, "Content comment 1", revisions[0].Content)
+	assert.Equal(t, "Content comment 2", revisions[1].Content)
+}
+
+func TestRepo_DeleteComment(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
+	_, err := repo.CreatePost(post)
+	assert.NoError(t, err)
+
+	parentID := "1"
+	parent := &entity.Comment{ID: parentID, PostID: post.ID, Content: "Content comment 1"}
+	_, err = repo.CreateComment(parent)
+	assert.NoError(t, err)
+
+	reply := &entity.Comment{ID: "2", PostID: post.ID, ParentID: &parentID, Content: "Content comment 2"}
+	_, err = repo.CreateComment(reply)
+	assert.NoError(t, err)
+
+	_, err = editComment(t, repo, parent.ID, "Content comment 1 edited")
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.DeleteComment(parent.ID))
+
+	tombstone, err := repo.GetCommentById(parent.ID)
+	assert.NoError(t, err)
+	assert.True(t, tombstone.Deleted)
+	assert.Equal(t, entity.DeletedCommentContent, tombstone.Content)
+
+	revisions, err := repo.GetCommentRevisions(parent.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+
+	assert.NoError(t, repo.DeleteComment(reply.ID))
+
+	_, err = repo.GetCommentById(reply.ID)
+	assert.Error(t, err)
+}
+
+func TestRepo_UpdatePost(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
+	_, err := repo.CreatePost(post)
+	assert.NoError(t, err)
+
+	post.Title = "Post 1 edited"
+	_, err = repo.UpdatePost(post)
+	assert.NoError(t, err)
+
+	retPost, err := repo.GetPostById(post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Post 1 edited", retPost.Title)
+	assert.Equal(t, "Content 1", retPost.Content)
+	assert.Equal(t, entity.ModerationOpen, retPost.ModerationMode)
+
+	_, err = repo.UpdatePost(&entity.Post{ID: "2", Title: "Post 2", Content: "Content 2"})
+	assert.Error(t, err)
+}
+
+func TestRepo_SetPostModerationMode(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
+	_, err := repo.CreatePost(post)
+	assert.NoError(t, err)
+
+	_, err = repo.SetPostModerationMode(post.ID, entity.ModerationPremoderated)
+	assert.NoError(t, err)
+
+	retPost, err := repo.GetPostById(post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.ModerationPremoderated, retPost.ModerationMode)
+}
+
+func TestRepo_DeletePost(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
+	_, err := repo.CreatePost(post)
+	assert.NoError(t, err)
+
+	comment := &entity.Comment{ID: "1", PostID: post.ID, Content: "Content comment 1"}
+	_, err = repo.CreateComment(comment)
+	assert.NoError(t, err)
+	_, err = editComment(t, repo, comment.ID, "Content comment 1 edited")
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.DeletePost(post.ID))
+
+	_, err = repo.GetPostById(post.ID)
+	assert.Error(t, err)
+	_, err = repo.GetCommentById(comment.ID)
+	assert.Error(t, err)
+	revisions, err := repo.GetCommentRevisions(comment.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+
+	assert.Error(t, repo.DeletePost(post.ID))
+}
+
+func TestRepo_GetPostsAfter(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	for i := range 5 {
+		_, err := repo.CreatePost(&entity.Post{ID: fmt.Sprintf("%d", i), Title: fmt.Sprintf("Post %d", i), Content: "Content"})
+		assert.NoError(t, err)
+	}
+
+	page, hasNext, err := repo.GetPostsAfter(3, nil)
+	assert.NoError(t, err)
+	assert.True(t, hasNext)
+	assert.Len(t, page, 3)
+	assert.Equal(t, "Post 0", page[0].Title)
+
+	last := page[len(page)-1]
+	page, hasNext, err = repo.GetPostsAfter(3, &database.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "Post 3", page[0].Title)
+	assert.Equal(t, "Post 4", page[1].Title)
+}
+
+func TestRepo_GetCommentsForPostAfter(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	post := &entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen}
+	_, err := repo.CreatePost(post)
+	assert.NoError(t, err)
+
+	for i := range 4 {
+		_, err := repo.CreateComment(&entity.Comment{ID: fmt.Sprintf("%d", i), PostID: post.ID, Content: fmt.Sprintf("Content comment %d", i)})
+		assert.NoError(t, err)
+	}
+
+	page, hasNext, err := repo.GetCommentsForPostAfter(post.ID, 2, nil, database.Viewer{})
+	assert.NoError(t, err)
+	assert.True(t, hasNext)
+	assert.Len(t, page, 2)
+
+	_, err = repo.CreateComment(&entity.Comment{ID: "4", PostID: post.ID, Content: "Content comment 4"})
+	assert.NoError(t, err)
+
+	last := page[len(page)-1]
+	page, hasNext, err = repo.GetCommentsForPostAfter(post.ID, 10, &database.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, database.Viewer{})
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	assert.Len(t, page, 3)
+	for i, comment := range page {
+		assert.Equal(t, fmt.Sprintf("Content comment %d", i+2), comment.Content)
+	}
+}
+
+func TestMigrate_BackfillsRanks(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// Rows written before the rank columns existed hold the column defaults.
+	assert.NoError(t, db.Create(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", CreatedAt: createdAt, UpdatedAt: createdAt}).Error)
+	assert.NoError(t, db.Create(&entity.Comment{ID: "1", PostID: "1", Content: "Content comment 1", Upvotes: 3, Downvotes: 1, CreatedAt: createdAt, UpdatedAt: createdAt}).Error)
+	assert.NoError(t, db.Create(&entity.Comment{ID: "2", PostID: "1", Content: "Content comment 2", Upvotes: 1, CreatedAt: createdAt, UpdatedAt: createdAt}).Error)
+
+	assert.NoError(t, Migrate(db))
+
+	comment, err := repo.GetCommentById("1")
+	assert.NoError(t, err)
+	assert.InDelta(t, ranking.Hot(3, 1, createdAt), comment.HotRank, 1e-9)
+	assert.InDelta(t, ranking.Best(3, 1), comment.BestRank, 1e-9)
+	assert.True(t, createdAt.Equal(comment.UpdatedAt), "the backfill does not touch updatedAt")
+
+	post, err := repo.GetPostById("1")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, post.Upvotes)
+	assert.Equal(t, 1, post.Downvotes)
+	assert.InDelta(t, ranking.Best(4, 1), post.BestRank, 1e-9)
+
+	// Ranked rows are left alone on later starts.
+	assert.NoError(t, db.Model(&entity.Post{}).Where("id = ?", "1").UpdateColumn("best_rank", 0.5).Error)
+	assert.NoError(t, Migrate(db))
+	post, err = repo.GetPostById("1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, post.BestRank)
+}
+
+func TestMigrate_ModerationMode(t *testing.T) {
+	db := setupTestDB(t)
+	repo := Repo{db: db}
+
+	// Posts written before moderation modes had a comments_active flag instead.
+	assert.NoError(t, db.Exec("ALTER TABLE posts ADD COLUMN comments_active boolean NOT NULL DEFAULT true").Error)
+	assert.NoError(t, db.Create(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1"}).Error)
+	assert.NoError(t, db.Create(&entity.Post{ID: "2", Title: "Post 2", Content: "Content 2"}).Error)
+	assert.NoError(t, db.Exec("UPDATE posts SET comments_active = false WHERE id = ?", "2").Error)
+
+	assert.NoError(t, Migrate(db))
+	assert.False(t, db.Migrator().HasColumn(&entity.Post{}, "comments_active"))
+
+	for id, mode := range map[string]entity.ModerationMode{"1": entity.ModerationOpen, "2": entity.ModerationClosed} {
+		post, err := repo.GetPostById(id)
+		assert.NoError(t, err)
+		assert.Equal(t, mode, post.ModerationMode, id)
+	}
+
+	_, err := repo.CreatePost(&entity.Post{ID: "3", Title: "Post 3", Content: "Content 3", ModerationMode: entity.ModerationOpen})
+	assert.NoError(t, err, "new posts no longer need the dropped column")
+	assert.NoError(t, Migrate(db))
+}
@@ -0,0 +1,142 @@
+package pq
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateReport relies on the partial unique index over the open reports, so two
+// concurrent reports of one user on a comment never both get in.
+func (p Repo) CreateReport(report *entity.Report) (bool, error) {
+	created := false
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var comment entity.Comment
+		err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id").First(&comment, "id = ?", report.CommentID).Error
+		if err != nil {
+			return notFound(err, database.ErrCommentNotFound)
+		}
+
+		report.Status = entity.ReportOpen
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(report)
+		created = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create report: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetModerationQueue pages over the reported comments in one grouped query and
+// then loads the page with its open reports.
+func (p Repo) GetModerationQueue(limit int, offset int) ([]*database.ModerationItem, error) {
+	var commentIDs []string
+	err := p.db.Model(&entity.Report{}).
+		Where("status = ?", entity.ReportOpen).
+		Group("comment_id").
+		Order("COUNT(*) DESC, MIN(created_at), comment_id").
+		Limit(limit).Offset(offset).
+		Pluck("comment_id", &commentIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation queue: %w", err)
+	}
+
+	items := make([]*database.ModerationItem, 0, len(commentIDs))
+	if len(commentIDs) == 0 {
+		return items, nil
+	}
+
+	var comments []*entity.Comment
+	if err := p.db.Where("id IN ?", commentIDs).Find(&comments).Error; err != nil {
+		return nil, fmt.Errorf("failed to get moderation queue: %w", err)
+	}
+	var reports []*entity.Report
+	err = p.db.Where("comment_id IN ? AND status = ?", commentIDs, entity.ReportOpen).Order("created_at, id").Find(&reports).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation queue: %w", err)
+	}
+
+	byComment := make(map[string]*database.ModerationItem, len(comments))
+	for _, comment := range comments {
+		byComment[comment.ID] = &database.ModerationItem{Comment: comment}
+	}
+	for _, report := range reports {
+		if item, ok := byComment[report.CommentID]; ok {
+			item.Reports = append(item.Reports, report)
+		}
+	}
+	for _, id := range commentIDs {
+		if item, ok := byComment[id]; ok && len(item.Reports) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (p Repo) ModerateComment(id string, hidden bool, status entity.ReportStatus) (*entity.Comment, error) {
+	var comment entity.Comment
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&comment, "id = ?", id).Error; err != nil {
+			return notFound(err, database.ErrCommentNotFound)
+		}
+
+		columns := map[string]interface{}{"hidden": hidden}
+		if !hidden {
+			columns["status"] = entity.CommentPublished
+		}
+		if err := tx.Model(&comment).UpdateColumns(columns).Error; err != nil {
+			return err
+		}
+		comment.Hidden = hidden
+		if !hidden {
+			comment.Status = entity.CommentPublished
+		}
+		return tx.Model(&entity.Report{}).
+			Where("comment_id = ? AND status = ?", id, entity.ReportOpen).
+			Update("status", status).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate comment with ID %s: %w", id, err)
+	}
+
+	return &comment, nil
+}
+
+func (p Repo) GetPendingComments(limit int, offset int) ([]*entity.Comment, error) {
+	if limit <= 0 {
+		return []*entity.Comment{}, nil
+	}
+
+	var comments []*entity.Comment
+	err := p.db.Where("status = ? AND NOT deleted", entity.CommentPending).
+		Order("created_at, id").
+		Limit(limit).Offset(max(offset, 0)).
+		Find(&comments).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending comments: %w", err)
+	}
+	return comments, nil
+}
+
+func (p Repo) DismissReport(id string) (*entity.Report, error) {
+	result := p.db.Model(&entity.Report{}).
+		Where("id = ? AND status = ?", id, entity.ReportOpen).
+		Update("status", entity.ReportDismissed)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to dismiss report with ID %s: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrReportNotFound, id)
+	}
+
+	var report entity.Report
+	if err := p.db.First(&report, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("failed to get report with ID %s: %w", id, notFound(err, database.ErrReportNotFound))
+	}
+	return &report, nil
+}
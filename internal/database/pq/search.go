@@ -0,0 +1,215 @@
+package pq
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/search"
+	"gorm.io/gorm"
+)
+
+// searchTables lists the searched columns of every table. Postgres keeps a generated
+// tsvector column over them with a GIN index; SQLite, which has no tsvector, keeps an
+// FTS4 table over them in sync with triggers. Both use the "simple" word splitting
+// of the search package, without stemming, so every backend finds the same items.
+var searchTables = []struct {
+	table   string
+	index   string
+	columns []string
+}{
+	{table: "posts", index: "post_search", columns: []string{"title", "content"}},
+	{table: "comments", index: "comment_search", columns: []string{"content"}},
+}
+
+// headlineOptions make ts_headline cut snippets as search.Snippet does.
+var headlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=%d, MinWords=%d, ShortWord=0",
+	search.StartSel, search.StopSel, search.SnippetWords, search.SnippetWords/2)
+
+// postgresSearch ranks the matches of one table and highlights only the page it returns.
+// The content is HTML-escaped before ts_headline, which leaves the entities alone.
+const postgresSearch = `WITH search_query AS (SELECT plainto_tsquery('simple', @text) AS q),
+hits AS (
+	SELECT t.*, ts_rank(t.search_vector, search_query.q, 1)::float8 AS rank
+	FROM %s t, search_query
+	WHERE t.search_vector @@ search_query.q %s
+),
+page AS (
+	SELECT * FROM hits
+	WHERE @after_id = '' OR hits.rank < @after_rank OR (hits.rank = @after_rank AND hits.id > @after_id)
+	ORDER BY hits.rank DESC, hits.id
+	LIMIT @limit
+)
+SELECT page.*, ts_headline('simple', replace(replace(replace(page.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), search_query.q, @options) AS snippet
+FROM page, search_query
+ORDER BY page.rank DESC, page.id`
+
+func migrateSearch(db *gorm.DB) error {
+	if db.Dialector.Name() == "postgres" {
+		return migratePostgresSearch(db)
+	}
+	return migrateSQLiteSearch(db)
+}
+
+// migratePostgresSearch adds the tsvector columns, which Postgres fills in for
+// the existing rows itself.
+func migratePostgresSearch(db *gorm.DB) error {
+	for _, t := range searchTables {
+		document := make([]string, len(t.columns))
+		for i, column := range t.columns {
+			document[i] = fmt.Sprintf("coalesce(%s, '')", column)
+		}
+
+		statements := []string{
+			fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS search_vector tsvector
+				GENERATED ALWAYS AS (to_tsvector('simple', %s)) STORED`, t.table, strings.Join(document, " || ' ' || ")),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_search_vector ON %s USING GIN (search_vector)`, t.table, t.table),
+		}
+		for _, statement := range statements {
+			if err := db.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateSQLiteSearch creates the FTS4 tables, filling them from the existing rows
+// once, and the triggers that keep them in sync. An FTS4 table with external content
+// only stores the index, so the text is not kept twice.
+func migrateSQLiteSearch(db *gorm.DB) error {
+	for _, t := range searchTables {
+		columns := strings.Join(t.columns, ", ")
+		values := "new." + strings.Join(t.columns, ", new.")
+
+		var statements []string
+		if !db.Migrator().HasTable(t.index) {
+			statements = append(statements,
+				fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING fts4(content="%s", %s, tokenize=unicode61)`, t.index, t.table, columns),
+				fmt.Sprintf(`INSERT INTO %[1]s(%[1]s) VALUES ('rebuild')`, t.index))
+		}
+		statements = append(statements,
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_bu BEFORE UPDATE OF %[3]s ON %[2]s BEGIN
+				DELETE FROM %[1]s WHERE docid = old.rowid; END`, t.index, t.table, columns),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_bd BEFORE DELETE ON %[2]s BEGIN
+				DELETE FROM %[1]s WHERE docid = old.rowid; END`, t.index, t.table),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_au AFTER UPDATE OF %[3]s ON %[2]s BEGIN
+				INSERT INTO %[1]s(docid, %[3]s) VALUES (new.rowid, %[4]s); END`, t.index, t.table, columns, values),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ai AFTER INSERT ON %[2]s BEGIN
+				INSERT INTO %[1]s(docid, %[3]s) VALUES (new.rowid, %[4]s); END`, t.index, t.table, columns, values))
+
+		for _, statement := range statements {
+			if err := db.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type postHit struct {
+	entity.Post
+	Rank    float64
+	Snippet string
+}
+
+type commentHit struct {
+	entity.Comment
+	Rank    float64
+	Snippet string
+}
+
+func (p Repo) Search(query database.SearchQuery) ([]*database.SearchHit, bool, error) {
+	terms := search.Terms(query.Text)
+	if len(terms) == 0 {
+		return nil, false, nil
+	}
+
+	var hits []*database.SearchHit
+	var hasNext bool
+	var err error
+	if p.db.Dialector.Name() == "postgres" {
+		hits, hasNext, err = p.searchPostgres(query, terms)
+	} else {
+		hits, hasNext, err = p.searchSQLite(query, terms)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to search: %w", err)
+	}
+	return hits, hasNext, nil
+}
+
+// searchPostgres leaves matching, ranking and highlighting to Postgres and reads
+// one extra row to tell whether more follow.
+func (p Repo) searchPostgres(query database.SearchQuery, terms []string) ([]*database.SearchHit, bool, error) {
+	args := map[string]interface{}{
+		"text":       strings.Join(terms, " "),
+		"after_rank": 0.0,
+		"after_id":   "",
+		"limit":      query.First + 1,
+		"options":    headlineOptions,
+	}
+	if query.After != nil {
+		args["after_rank"] = query.After.Rank
+		args["after_id"] = query.After.ID
+	}
+
+	var hits []*database.SearchHit
+	if query.Type == database.SearchPosts {
+		var rows []*postHit
+		if err := p.db.Raw(fmt.Sprintf(postgresSearch, "posts", ""), args).Scan(&rows).Error; err != nil {
+			return nil, false, err
+		}
+		for _, row := range rows {
+			hits = append(hits, &database.SearchHit{Post: &row.Post, Rank: row.Rank, Snippet: row.Snippet})
+		}
+	} else {
+		var rows []*commentHit
+		if err := p.db.Raw(fmt.Sprintf(postgresSearch, "comments", "AND NOT t.deleted AND NOT t.hidden AND t.status = 'published'"), args).Scan(&rows).Error; err != nil {
+			return nil, false, err
+		}
+		for _, row := range rows {
+			hits = append(hits, &database.SearchHit{Comment: &row.Comment, Rank: row.Rank, Snippet: row.Snippet})
+		}
+	}
+
+	if len(hits) > query.First {
+		return hits[:query.First], true, nil
+	}
+	return hits, false, nil
+}
+
+// searchSQLite finds the candidates in the FTS4 table and ranks them in Go, as
+// FTS4 has no ranking of its own.
+func (p Repo) searchSQLite(query database.SearchQuery, terms []string) ([]*database.SearchHit, bool, error) {
+	match := `"` + strings.Join(terms, `" "`) + `"`
+
+	var hits []*database.SearchHit
+	if query.Type == database.SearchPosts {
+		var posts []*entity.Post
+		err := p.db.Where("rowid IN (SELECT docid FROM post_search WHERE post_search MATCH ?)", match).Find(&posts).Error
+		if err != nil {
+			return nil, false, err
+		}
+		for _, post := range posts {
+			if hit, ok := database.MatchPost(terms, post); ok {
+				hits = append(hits, hit)
+			}
+		}
+	} else {
+		var comments []*entity.Comment
+		err := p.db.Where("NOT deleted AND NOT hidden AND status = ? AND rowid IN (SELECT docid FROM comment_search WHERE comment_search MATCH ?)", entity.CommentPublished, match).Find(&comments).Error
+		if err != nil {
+			return nil, false, err
+		}
+		for _, comment := range comments {
+			if hit, ok := database.MatchComment(terms, comment); ok {
+				hits = append(hits, hit)
+			}
+		}
+	}
+
+	page, hasNext := database.PageHits(terms, hits, query.First, query.After)
+	return page, hasNext, nil
+}
@@ -0,0 +1,62 @@
+package pq
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TrainSpamFilter records the training and upserts every token in one
+// transaction, adding to the counts already there.
+func (p Repo) TrainSpamFilter(commentID string, tokens []string, spam bool) (bool, error) {
+	column := "ham"
+	if spam {
+		column = "spam"
+	}
+	rows := make([]*entity.SpamToken, len(tokens))
+	for i, token := range tokens {
+		rows[i] = &entity.SpamToken{Token: token}
+		if spam {
+			rows[i].Spam = 1
+		} else {
+			rows[i].Ham = 1
+		}
+	}
+
+	trained := false
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.SpamTraining{CommentID: commentID, Spam: spam})
+		if result.Error != nil {
+			return result.Error
+		}
+		if trained = result.RowsAffected > 0; !trained || len(rows) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "token"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{column: gorm.Expr("spam_tokens." + column + " + 1")}),
+		}).Create(&rows).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to train spam filter: %w", err)
+	}
+	return trained, nil
+}
+
+func (p Repo) GetSpamTokens(tokens []string) (map[string]*entity.SpamToken, error) {
+	result := make(map[string]*entity.SpamToken, len(tokens))
+	if len(tokens) == 0 {
+		return result, nil
+	}
+
+	var rows []*entity.SpamToken
+	if err := p.db.Where("token IN ?", tokens).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get spam tokens: %w", err)
+	}
+	for _, row := range rows {
+		result[row.Token] = row
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package pq
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"gorm.io/gorm"
+)
+
+// CreateUser checks the name inside the transaction so a clear ErrUserExists is
+// returned; the unique index still rejects a name registered concurrently.
+func (p Repo) CreateUser(user *entity.User) (*entity.User, error) {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var existing entity.User
+		err := tx.Where("name = ?", user.Name).First(&existing).Error
+		if err == nil {
+			return database.ErrUserExists
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(user).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user %s: %w", user.Name, err)
+	}
+
+	return user, nil
+}
+
+func (p Repo) GetUserByName(name string) (*entity.User, error) {
+	var user entity.User
+	if err := p.db.Where("name = ?", name).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %w", name, notFound(err, database.ErrUserNotFound))
+	}
+	return &user, nil
+}
+
+func (p Repo) GetUsers(ids []string) ([]*entity.User, error) {
+	users := []*entity.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	if err := p.db.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	return users, nil
+}
+
+func (p Repo) SetUserRole(id string, role entity.Role) (*entity.User, error) {
+	result := p.db.Model(&entity.User{}).Where("id = ?", id).Update("role", role)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update role of user %s: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("failed to update role of user %s: %w", id, database.ErrUserNotFound)
+	}
+
+	var user entity.User
+	if err := p.db.First(&user, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %w", id, notFound(err, database.ErrUserNotFound))
+	}
+	return &user, nil
+}
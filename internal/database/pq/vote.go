@@ -0,0 +1,101 @@
+package pq
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// VoteComment locks the post and then the comment, the order CreateComment takes
+// them in, so concurrent votes are applied one after another and the counters and
+// ranks of both always match the votes table.
+func (p Repo) VoteComment(commentID string, userID string, value entity.Vote) (*entity.Comment, error) {
+	var comment entity.Comment
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var postID string
+		if err := tx.Model(&entity.Comment{}).Select("post_id").Where("id = ?", commentID).Limit(1).Find(&postID).Error; err != nil {
+			return err
+		}
+
+		var post entity.Post
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Limit(1).Find(&post, "id = ?", postID).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&comment, "id = ?", commentID).Error; err != nil {
+			return notFound(err, database.ErrCommentNotFound)
+		}
+
+		var previous entity.CommentVote
+		err := tx.Where("comment_id = ? AND user_id = ?", commentID, userID).Limit(1).Find(&previous).Error
+		if err != nil {
+			return err
+		}
+
+		up, down := database.VoteDelta(previous.Value, value)
+		if up == 0 && down == 0 {
+			return nil
+		}
+
+		if value == entity.VoteNone {
+			err = tx.Where("comment_id = ? AND user_id = ?", commentID, userID).Delete(&entity.CommentVote{}).Error
+		} else {
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "comment_id"}, {Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value"}),
+			}).Create(&entity.CommentVote{CommentID: commentID, UserID: userID, Value: value}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		comment.Upvotes += up
+		comment.Downvotes += down
+		database.RankComment(&comment)
+		// UpdateColumns leaves updated_at alone: a vote does not change the comment itself.
+		if err := tx.Model(&comment).UpdateColumns(rankColumns(comment.Upvotes, comment.Downvotes, comment.HotRank, comment.BestRank)).Error; err != nil {
+			return err
+		}
+
+		if post.ID == "" {
+			return nil
+		}
+		post.Upvotes += up
+		post.Downvotes += down
+		database.RankPost(&post)
+		return tx.Model(&post).UpdateColumns(rankColumns(post.Upvotes, post.Downvotes, post.HotRank, post.BestRank)).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to vote on comment with ID %s: %w", commentID, err)
+	}
+
+	return &comment, nil
+}
+
+func rankColumns(upvotes int, downvotes int, hotRank float64, bestRank float64) map[string]interface{} {
+	return map[string]interface{}{
+		"upvotes":   upvotes,
+		"downvotes": downvotes,
+		"hot_rank":  hotRank,
+		"best_rank": bestRank,
+	}
+}
+
+func (p Repo) GetCommentVotes(userID string, commentIDs []string) (map[string]entity.Vote, error) {
+	result := make(map[string]entity.Vote)
+	if len(commentIDs) == 0 {
+		return result, nil
+	}
+
+	var votes []*entity.CommentVote
+	if err := p.db.Where("user_id = ? AND comment_id IN ?", userID, commentIDs).Find(&votes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get votes of user %s: %w", userID, err)
+	}
+
+	for _, vote := range votes {
+		result[vote.CommentID] = vote.Value
+	}
+	return result, nil
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/ranking"
+)
+
+// RankComment sets the HOT and BEST ranks of the comment from its votes. Backends
+// call it whenever they store new counters, so the ranks can be sorted by directly.
+func RankComment(comment *entity.Comment) {
+	comment.HotRank = ranking.Hot(comment.Upvotes, comment.Downvotes, comment.CreatedAt)
+	comment.BestRank = ranking.Best(comment.Upvotes, comment.Downvotes)
+}
+
+// RankPost sets the HOT and BEST ranks of the post from the votes on its comments.
+func RankPost(post *entity.Post) {
+	post.HotRank = ranking.Hot(post.Upvotes, post.Downvotes, post.CreatedAt)
+	post.BestRank = ranking.Best(post.Upvotes, post.Downvotes)
+}
@@ -0,0 +1,24 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/database/databasetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_Conformance(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Repo {
+		s, err := miniredis.Run()
+		require.NoError(t, err)
+		t.Cleanup(s.Close)
+
+		repo, err := GetRepo(config.RedisConfig{Address: s.Addr(), Namespace: "test"})
+		require.NoError(t, err)
+
+		return repo
+	})
+}
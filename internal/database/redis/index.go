@@ -0,0 +1,498 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const scanBatchSize = 500
+
+// score matches the precision timestamps are stored with, so a cursor built
+// from a stored item always maps back to that item's score. Microseconds since
+// the epoch stay well within the integers a float64 represents exactly.
+func score(t time.Time) float64 {
+	return float64(t.Truncate(database.TimePrecision).UnixMicro())
+}
+
+// formatTime encodes a timestamp for a hash field.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseTime decodes a hash field written by formatTime or by the second-precision
+// encoding of schema version 1.
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// rankMember is the member of an item in a rank index. Redis orders members with
+// equal scores by their bytes, and backwards in ZREVRANGE, so prefixing the ID with
+// the fixed-width creation time breaks ties between equal ranks by NEWEST, as the
+// other backends do.
+func rankMember(createdAt time.Time, id string) string {
+	return fmt.Sprintf("%016x:%s", createdAt.Truncate(database.TimePrecision).UnixMicro(), id)
+}
+
+func rankMemberID(member string) string {
+	_, id, _ := strings.Cut(member, ":")
+	return id
+}
+
+// formatRank encodes a rank for a hash field or a script argument without losing precision.
+func formatRank(rank float64) string {
+	return strconv.FormatFloat(rank, 'g', -1, 64)
+}
+
+// parseNumber reads a counter or rank field, which older hashes may lack, so a missing one is zero.
+func parseNumber[T int | float64](value string) (T, error) {
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	return T(number), err
+}
+
+// zrevrangeIDs reads members start to stop of a rank index, highest rank first, as IDs.
+func (rp *Repo) zrevrangeIDs(key string, start int64, stop int64) ([]string, error) {
+	members, err := rp.db.ZRevRange(key, start, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index %s from Redis: %w", key, err)
+	}
+	ids := make([]string, len(members))
+	for i, member := range members {
+		ids[i] = rankMemberID(member)
+	}
+	return ids, nil
+}
+
+// rangeAfter returns up to first members of the index that come after the cursor,
+// ordered by score and then by member, and whether more members follow.
+func (rp *Repo) rangeAfter(key string, first int, after *database.Cursor) ([]string, bool, error) {
+	min := "-inf"
+	if after != nil {
+		min = strconv.FormatFloat(score(after.CreatedAt), 'f', -1, 64)
+	}
+
+	batch := int64(first + 1)
+	ids := make([]string, 0, batch)
+	for offset := int64(0); ; offset += batch {
+		values, err := rp.db.ZRangeByScoreWithScores(key, redis.ZRangeBy{Min: min, Max: "+inf", Offset: offset, Count: batch}).Result()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read index %s from Redis: %w", key, err)
+		}
+
+		for _, value := range values {
+			id := value.Member.(string)
+			if after != nil && value.Score == score(after.CreatedAt) && id <= after.ID {
+				continue
+			}
+			ids = append(ids, id)
+		}
+
+		if len(ids) > first {
+			return ids[:first], true, nil
+		}
+		if int64(len(values)) < batch {
+			return ids, false, nil
+		}
+	}
+}
+
+// zrange reads members start to stop of the index, from the highest score down when reverse is set.
+func (rp *Repo) zrange(key string, start int64, stop int64, reverse bool) ([]string, error) {
+	if reverse {
+		return rp.db.ZRevRange(key, start, stop).Result()
+	}
+	return rp.db.ZRange(key, start, stop).Result()
+}
+
+// rootCommentIDs walks the post's comment index in order and returns the first
+// comments that are neither replies nor hidden, or all of them when first is
+// negative. There is no separate index of root comments, so reply IDs are
+// skipped after reading their parentId field.
+func (rp *Repo) rootCommentIDs(postID string, first int, reverse bool, hidden map[string]*entity.Comment) ([]string, error) {
+	key := rp.keys.postComments(postID)
+	var ids []string
+	for start := int64(0); ; start += scanBatchSize {
+		batch, err := rp.zrange(key, start, start+scanBatchSize-1, reverse)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s from Redis: %w", key, err)
+		}
+		last := len(batch) < scanBatchSize
+		batch = withoutHidden(batch, hidden)
+
+		pipe := rp.db.Pipeline()
+		cmds := make([]*redis.StringCmd, len(batch))
+		for i, id := range batch {
+			cmds[i] = pipe.HGet(rp.keys.comment(id), "parentId")
+		}
+		if _, err := pipe.Exec(); err != nil && !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("failed to get comments from Redis: %w", err)
+		}
+
+		for i, cmd := range cmds {
+			if parentID, err := cmd.Result(); err == nil && parentID == "" {
+				ids = append(ids, batch[i])
+				if len(ids) == first {
+					return ids, nil
+				}
+			}
+		}
+
+		if last {
+			return ids, nil
+		}
+	}
+}
+
+// replyIDs returns the first replies to each of the parents that are not hidden,
+// parent by parent, or all of them when first is negative. A parent may get a
+// few more than first, as the hidden replies are read past before filtering.
+func (rp *Repo) replyIDs(parentIDs []string, first int, reverse bool, hidden map[string]*entity.Comment) ([]string, error) {
+	stop := int64(first + len(hidden) - 1)
+	if first < 0 {
+		stop = -1
+	}
+
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(parentIDs))
+	for i, parentID := range parentIDs {
+		if reverse {
+			cmds[i] = pipe.ZRevRange(rp.keys.replies(parentID), 0, stop)
+		} else {
+			cmds[i] = pipe.ZRange(rp.keys.replies(parentID), 0, stop)
+		}
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to read reply indexes from Redis: %w", err)
+	}
+
+	var ids []string
+	for _, cmd := range cmds {
+		ids = append(ids, cmd.Val()...)
+	}
+	return withoutHidden(ids, hidden), nil
+}
+
+// rankedIDs reads first comments from the rank index of every parent in one
+// pipeline, skipping offset comments in each, highest rank first. Hidden
+// comments are not counted, so the index is read past them from the top.
+func (rp *Repo) rankedIDs(order database.CommentSort, parents []database.TreeRoot, offset int, first int, hidden map[string]*entity.Comment) ([]string, error) {
+	if len(parents) == 0 {
+		return nil, nil
+	}
+
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(parents))
+	for i, parent := range parents {
+		key := rp.keys.commentRanks(order, parent.PostID, parent.ParentID)
+		if len(hidden) == 0 {
+			cmds[i] = pipe.ZRevRange(key, int64(offset), int64(offset+first-1))
+		} else {
+			cmds[i] = pipe.ZRevRange(key, 0, int64(offset+first+len(hidden)-1))
+		}
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to read rank indexes from Redis: %w", err)
+	}
+
+	var ids []string
+	for _, cmd := range cmds {
+		var visible []string
+		for _, member := range cmd.Val() {
+			visible = append(visible, rankMemberID(member))
+		}
+		if len(hidden) > 0 {
+			visible = withoutHidden(visible, hidden)
+			visible = visible[min(offset, len(visible)):]
+			visible = visible[:min(first, len(visible))]
+		}
+		ids = append(ids, visible...)
+	}
+	return ids, nil
+}
+
+// replyCounts returns the number of direct replies to each of the comments,
+// leaving out the hidden ones.
+func (rp *Repo) replyCounts(comments []*entity.Comment, hidden map[string]*entity.Comment) (map[string]int, error) {
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.IntCmd, len(comments))
+	for i, comment := range comments {
+		cmds[i] = pipe.ZCard(rp.keys.replies(comment.ID))
+	}
+	if len(comments) > 0 {
+		if _, err := pipe.Exec(); err != nil {
+			return nil, fmt.Errorf("failed to read reply indexes from Redis: %w", err)
+		}
+	}
+
+	counts := make(map[string]int, len(comments))
+	for i, cmd := range cmds {
+		counts[comments[i].ID] = int(cmd.Val())
+	}
+	for _, comment := range hidden {
+		if comment.ParentID == nil {
+			continue
+		}
+		if _, counted := counts[*comment.ParentID]; counted {
+			counts[*comment.ParentID]--
+		}
+	}
+	return counts, nil
+}
+
+// pagePerParent skips offset comments under each parent and keeps the next first
+// ones, preserving their order. Root comments are grouped per post.
+func pagePerParent(comments []*entity.Comment, offset int, first int) []*entity.Comment {
+	kept := make([]*entity.Comment, 0, len(comments))
+	perParent := make(map[database.TreeRoot]int)
+	for _, comment := range comments {
+		parent := database.TreeRoot{PostID: comment.PostID}
+		if comment.ParentID != nil {
+			parent.ParentID = *comment.ParentID
+		}
+		rank := perParent[parent]
+		perParent[parent]++
+		if rank >= offset && rank < offset+first {
+			kept = append(kept, comment)
+		}
+	}
+	return kept
+}
+
+// loadPosts fetches post hashes in one pipeline, skipping IDs whose hash no longer exists.
+func (rp *Repo) loadPosts(ids []string) ([]*entity.Post, error) {
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(rp.keys.post(id))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to get posts from Redis: %w", err)
+	}
+
+	posts := make([]*entity.Post, 0, len(ids))
+	for _, cmd := range cmds {
+		data := cmd.Val()
+		if len(data) == 0 {
+			continue
+		}
+		post, err := mapToPost(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed map to post: %w", err)
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
+
+// loadComments fetches comment hashes in one pipeline, skipping IDs whose hash no longer exists.
+func (rp *Repo) loadComments(ids []string) ([]*entity.Comment, error) {
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(rp.keys.comment(id))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to get comments from Redis: %w", err)
+	}
+
+	comments := make([]*entity.Comment, 0, len(ids))
+	for _, cmd := range cmds {
+		data := cmd.Val()
+		if len(data) == 0 {
+			continue
+		}
+		comment, err := mapToComment(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed map to comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
+
+// Reindex drops and rebuilds every sorted-set index from the stored post and comment hashes,
+// then stamps the namespace with the current schema version.
+// It is meant to be run once over data written before the indexes existed.
+// The ranks and the search index are recomputed from the comment counters, and the counters of every post
+// are summed up again from its comments, so votes on comments deleted for good are lost.
+func (rp *Repo) Reindex() error {
+	start := time.Now()
+
+	for _, pattern := range []string{
+		rp.keys.posts(),
+		rp.keys.postComments("*"),
+		rp.keys.replies("*"),
+		rp.keys.postRanks("*"),
+		rp.keys.commentRanks("*", "*", "*"),
+		rp.keys.postCommentRanks("*", "*"),
+		rp.keys.searchTerms("*", "*"),
+		rp.keys.searchDoc("*", "*"),
+		rp.keys.pendingComments(),
+		rp.keys.postPendingComments("*"),
+	} {
+		if err := rp.scan(pattern, deleteKeys(rp.db)); err != nil {
+			return err
+		}
+	}
+
+	comments := 0
+	votes := make(map[string][2]int)
+	err := rp.scan(rp.keys.comment("*"), func(keys []string) error {
+		pipe := rp.db.Pipeline()
+		cmds := make([]*redis.SliceCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.HMGet(key, "id", "createdAt", "postId", "parentId", "upvotes", "downvotes", "content", "deleted", "status")
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return err
+		}
+
+		pipe = rp.db.Pipeline()
+		for i, cmd := range cmds {
+			values := cmd.Val()
+			id, createdAt, err := indexFields(values)
+			if err != nil {
+				return fmt.Errorf("failed to reindex %s: %w", keys[i], err)
+			}
+			member := redis.Z{Score: score(createdAt), Member: id}
+
+			postID, _ := values[2].(string)
+			parentID, _ := values[3].(string)
+			pipe.ZAdd(rp.keys.postComments(postID), member)
+			if parentID != "" {
+				pipe.ZAdd(rp.keys.replies(parentID), member)
+			}
+
+			comment := &entity.Comment{ID: id, CreatedAt: createdAt}
+			if comment.Upvotes, err = parseNumber[int](fieldString(values[4])); err != nil {
+				return fmt.Errorf("failed to reindex %s: %w", keys[i], err)
+			}
+			if comment.Downvotes, err = parseNumber[int](fieldString(values[5])); err != nil {
+				return fmt.Errorf("failed to reindex %s: %w", keys[i], err)
+			}
+			database.RankComment(comment)
+			rp.setRanks(pipe, keys[i], comment.HotRank, comment.BestRank, rankMember(createdAt, id),
+				rp.keys.commentRanks(database.CommentSortHot, postID, parentID),
+				rp.keys.commentRanks(database.CommentSortBest, postID, parentID),
+				rp.keys.postCommentRanks(database.CommentSortHot, postID),
+				rp.keys.postCommentRanks(database.CommentSortBest, postID))
+			if fieldString(values[7]) != "1" {
+				rp.indexText(pipe, database.SearchComments, id, fieldString(values[6]))
+				if fieldString(values[8]) == string(entity.CommentPending) {
+					pipe.ZAdd(rp.keys.pendingComments(), member)
+					pipe.ZAdd(rp.keys.postPendingComments(postID), member)
+				}
+			}
+
+			sum := votes[postID]
+			votes[postID] = [2]int{sum[0] + comment.Upvotes, sum[1] + comment.Downvotes}
+			comments++
+		}
+		_, err := pipe.Exec()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reindex comments: %w", err)
+	}
+
+	posts := 0
+	err = rp.scan(rp.keys.post("*"), func(keys []string) error {
+		pipe := rp.db.Pipeline()
+		cmds := make([]*redis.SliceCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.HMGet(key, "id", "createdAt", "title", "content")
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return err
+		}
+
+		pipe = rp.db.Pipeline()
+		for i, cmd := range cmds {
+			values := cmd.Val()
+			id, createdAt, err := indexFields(values)
+			if err != nil {
+				return fmt.Errorf("failed to reindex %s: %w", keys[i], err)
+			}
+			pipe.ZAdd(rp.keys.posts(), redis.Z{Score: score(createdAt), Member: id})
+
+			post := &entity.Post{ID: id, Title: fieldString(values[2]), Content: fieldString(values[3]), CreatedAt: createdAt, Upvotes: votes[id][0], Downvotes: votes[id][1]}
+			database.RankPost(post)
+			pipe.HMSet(keys[i], map[string]interface{}{"upvotes": post.Upvotes, "downvotes": post.Downvotes})
+			rp.setRanks(pipe, keys[i], post.HotRank, post.BestRank, rankMember(createdAt, id),
+				rp.keys.postRanks(database.PostSortHot), rp.keys.postRanks(database.PostSortBest))
+			rp.indexText(pipe, database.SearchPosts, id, postText(post))
+			posts++
+		}
+		_, err := pipe.Exec()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reindex posts: %w", err)
+	}
+
+	logrus.Infof("reindexed %d posts and %d comments in %v", posts, comments, time.Since(start))
+	return rp.setSchemaVersion()
+}
+
+// setRanks queues writing the ranks to the hash at key and to the pairs of HOT and
+// BEST rank indexes.
+func (rp *Repo) setRanks(pipe redis.Pipeliner, key string, hot float64, best float64, member string, indexes ...string) {
+	pipe.HMSet(key, map[string]interface{}{"hotRank": formatRank(hot), "bestRank": formatRank(best)})
+	for i := 0; i+1 < len(indexes); i += 2 {
+		pipe.ZAdd(indexes[i], redis.Z{Score: hot, Member: member})
+		pipe.ZAdd(indexes[i+1], redis.Z{Score: best, Member: member})
+	}
+}
+
+// scan calls fn with every batch of keys matching the pattern, using SCAN instead of KEYS.
+func (rp *Repo) scan(pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := rp.db.Scan(cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return fmt.Errorf("failed to scan %s in Redis: %w", pattern, err)
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func deleteKeys(db *redis.Client) func(keys []string) error {
+	return func(keys []string) error {
+		return db.Del(keys...).Err()
+	}
+}
+
+func indexFields(values []interface{}) (string, time.Time, error) {
+	id, _ := values[0].(string)
+	if id == "" {
+		return "", time.Time{}, errors.New("missing id")
+	}
+
+	rawCreatedAt, _ := values[1].(string)
+	createdAt, err := parseTime(rawCreatedAt)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse createdAt: %w", err)
+	}
+
+	return id, createdAt, nil
+}
@@ -0,0 +1,163 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+// keyspace builds every key the repo touches, prefixed with the configured namespace,
+// so several deployments can share one Redis without seeing each other's data.
+//
+// posts is a sorted set of every post ID scored by creation time. Comments are indexed
+// per post (postComments) and per parent comment (replies) the same way, so no read
+// ever has to scan the keyspace. userNames is a hash from user name to user ID
+// that also keeps names unique. votes is a hash per comment from user ID to vote,
+// so a user has at most one vote on a comment.
+//
+// reactions is a hash per post or comment from emoji to the number of users who reacted
+// with it, and reactionUsers the set of "<user ID>:<emoji>" pairs behind those numbers.
+//
+// postRanks and commentRanks hold the HOT and BEST ranks, of every post and of the
+// comments under each parent (or of the root comments of a post) respectively,
+// so a page of ranked siblings is a single range read. postCommentRanks holds the
+// ranks of every comment of a post, for the flat list. See rankMember.
+//
+// searchTerms is the set of IDs of the posts or comments containing a word, and
+// searchDoc the set of words a post or comment is indexed under, so its entries
+// can be found again when it changes.
+//
+// report is a hash per report. commentReports is the set of every report ID on a
+// comment, so they can all be dropped with it, and openReports a hash per comment
+// from user ID to the ID of the user's open report, which keeps them to one each.
+// moderationQueue is the set of IDs of the comments with open reports, and
+// pendingComments the IDs of the comments waiting to be published, scored by
+// creation time. postPendingComments holds the same per post, so a listing only
+// reads the pending comments of its own post.
+//
+// spamTokens is a hash from word to the number of spam, or ham, comments it was in,
+// and spamTrainings the set of IDs of the comments trained as spam, or ham.
+type keyspace struct {
+	prefix string
+}
+
+func newKeyspace(namespace string) keyspace {
+	return keyspace{prefix: config.RedisConfig{Namespace: namespace}.KeyPrefix()}
+}
+
+func (k keyspace) all() string {
+	return k.prefix + "*"
+}
+
+func (k keyspace) schemaVersion() string {
+	return k.prefix + "schema_version"
+}
+
+func (k keyspace) posts() string {
+	return k.prefix + "posts"
+}
+
+func (k keyspace) post(id string) string {
+	return fmt.Sprintf("%spost:%s", k.prefix, id)
+}
+
+func (k keyspace) comment(id string) string {
+	return fmt.Sprintf("%scomment:%s", k.prefix, id)
+}
+
+func (k keyspace) revisions(commentID string) string {
+	return fmt.Sprintf("%scomment_revisions:%s", k.prefix, commentID)
+}
+
+func (k keyspace) votes(commentID string) string {
+	return fmt.Sprintf("%scomment_votes:%s", k.prefix, commentID)
+}
+
+// reactions and reactionUsers belong to the post itself when commentID is empty.
+func (k keyspace) reactions(target entity.ReactionTarget) string {
+	return fmt.Sprintf("%sreactions:%s:%s", k.prefix, target.PostID, target.CommentID)
+}
+
+func (k keyspace) reactionUsers(target entity.ReactionTarget) string {
+	return fmt.Sprintf("%sreaction_users:%s:%s", k.prefix, target.PostID, target.CommentID)
+}
+
+func (k keyspace) postRanks(order database.PostSort) string {
+	return fmt.Sprintf("%spost_ranks:%s", k.prefix, order)
+}
+
+// commentRanks indexes the comments of the post under parentID, or its root
+// comments when parentID is empty.
+func (k keyspace) commentRanks(order database.CommentSort, postID string, parentID string) string {
+	return fmt.Sprintf("%scomment_ranks:%s:%s:%s", k.prefix, order, postID, parentID)
+}
+
+// postCommentRanks indexes every comment of the post, whatever its parent.
+func (k keyspace) postCommentRanks(order database.CommentSort, postID string) string {
+	return fmt.Sprintf("%spost_comment_ranks:%s:%s", k.prefix, order, postID)
+}
+
+func (k keyspace) searchTerms(kind database.SearchType, term string) string {
+	return fmt.Sprintf("%ssearch_terms:%s:%s", k.prefix, kind, term)
+}
+
+func (k keyspace) searchDoc(kind database.SearchType, id string) string {
+	return fmt.Sprintf("%ssearch_doc:%s:%s", k.prefix, kind, id)
+}
+
+// report with an empty id is the prefix of every report key.
+func (k keyspace) report(id string) string {
+	return fmt.Sprintf("%sreport:%s", k.prefix, id)
+}
+
+func (k keyspace) commentReports(commentID string) string {
+	return fmt.Sprintf("%scomment_reports:%s", k.prefix, commentID)
+}
+
+func (k keyspace) openReports(commentID string) string {
+	return fmt.Sprintf("%sopen_reports:%s", k.prefix, commentID)
+}
+
+func (k keyspace) moderationQueue() string {
+	return k.prefix + "moderation_queue"
+}
+
+func (k keyspace) pendingComments() string {
+	return k.prefix + "pending_comments"
+}
+
+func (k keyspace) postPendingComments(postID string) string {
+	return k.prefix + "pending_comments:" + postID
+}
+
+func (k keyspace) spamTokens(spam bool) string {
+	if spam {
+		return k.prefix + "spam_tokens:spam"
+	}
+	return k.prefix + "spam_tokens:ham"
+}
+
+func (k keyspace) spamTrainings(spam bool) string {
+	if spam {
+		return k.prefix + "spam_trainings:spam"
+	}
+	return k.prefix + "spam_trainings:ham"
+}
+
+func (k keyspace) postComments(postID string) string {
+	return fmt.Sprintf("%spost_comments:%s", k.prefix, postID)
+}
+
+func (k keyspace) replies(parentID string) string {
+	return fmt.Sprintf("%scomment_replies:%s", k.prefix, parentID)
+}
+
+func (k keyspace) user(id string) string {
+	return fmt.Sprintf("%suser:%s", k.prefix, id)
+}
+
+func (k keyspace) userNames() string {
+	return k.prefix + "user_names"
+}
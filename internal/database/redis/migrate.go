@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// Migrate upgrades a namespace written with an older schema version: the time
+// fields of every post and comment hash are rewritten in the current encoding,
+// posts get a moderation mode from their commentsActive flag and the indexes are
+// rebuilt, which also stamps the current version.
+// Running it on an up-to-date namespace does nothing.
+func (rp *Repo) Migrate() error {
+	stored, err := rp.db.Get(rp.keys.schemaVersion()).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to get schema version from Redis: %w", err)
+	}
+	if version, err := strconv.Atoi(stored); err == nil && version >= schemaVersion {
+		logrus.Infof("redis namespace %q is already at schema version %d", rp.keys.prefix, version)
+		return nil
+	}
+
+	start := time.Now()
+	posts, err := rp.migrateTimes(rp.keys.post("*"), "createdAt", "updatedAt")
+	if err != nil {
+		return fmt.Errorf("failed to migrate posts: %w", err)
+	}
+	comments, err := rp.migrateTimes(rp.keys.comment("*"), "createdAt", "updatedAt", "editedAt")
+	if err != nil {
+		return fmt.Errorf("failed to migrate comments: %w", err)
+	}
+	if err := rp.migrateModerationMode(); err != nil {
+		return fmt.Errorf("failed to migrate moderation modes: %w", err)
+	}
+	logrus.Infof("migrated %d posts and %d comments in %v", posts, comments, time.Since(start))
+
+	return rp.Reindex()
+}
+
+// migrateTimes re-encodes the given time fields of every hash matching the pattern.
+// Empty fields, such as editedAt of a comment that was never edited, are kept.
+func (rp *Repo) migrateTimes(pattern string, fields ...string) (int, error) {
+	migrated := 0
+	err := rp.scan(pattern, func(keys []string) error {
+		pipe := rp.db.Pipeline()
+		cmds := make([]*redis.SliceCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.HMGet(key, fields...)
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return err
+		}
+
+		pipe = rp.db.Pipeline()
+		for i, cmd := range cmds {
+			values := make(map[string]interface{}, len(fields))
+			for j, value := range cmd.Val() {
+				raw, _ := value.(string)
+				if raw == "" {
+					continue
+				}
+				t, err := parseTime(raw)
+				if err != nil {
+					return fmt.Errorf("failed to parse %s of %s: %w", fields[j], keys[i], err)
+				}
+				values[fields[j]] = formatTime(t)
+			}
+			if len(values) > 0 {
+				pipe.HMSet(keys[i], values)
+				migrated++
+			}
+		}
+		_, err := pipe.Exec()
+		return err
+	})
+	return migrated, err
+}
+
+// migrateModerationMode closes the posts whose comments were turned off and opens
+// the rest, dropping the commentsActive flag. Posts that already have a mode keep it.
+func (rp *Repo) migrateModerationMode() error {
+	return rp.scan(rp.keys.post("*"), func(keys []string) error {
+		pipe := rp.db.Pipeline()
+		cmds := make([]*redis.SliceCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.HMGet(key, "commentsActive", "moderationMode")
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return err
+		}
+
+		pipe = rp.db.Pipeline()
+		for i, cmd := range cmds {
+			values := cmd.Val()
+			if fieldString(values[1]) == "" {
+				mode := entity.ModerationOpen
+				if fieldString(values[0]) == "0" {
+					mode = entity.ModerationClosed
+				}
+				pipe.HSet(keys[i], "moderationMode", string(mode))
+			}
+			pipe.HDel(keys[i], "commentsActive")
+		}
+		_, err := pipe.Exec()
+		return err
+	})
+}
@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/go-redis/redis"
+)
+
+func (rp *Repo) AddReaction(reaction *entity.Reaction) (bool, error) {
+	target := reaction.Target()
+	key, id, notFound, parentPostID := rp.keys.post(target.PostID), target.PostID, database.ErrPostNotFound, ""
+	if target.CommentID != "" {
+		key, id, notFound, parentPostID = rp.keys.comment(target.CommentID), target.CommentID, database.ErrCommentNotFound, target.PostID
+	}
+
+	keys := []string{key, rp.keys.reactions(target), rp.keys.reactionUsers(target)}
+	code, err := addReactionScript.Run(rp.db, keys, reaction.Emoji, reactionMember(reaction), parentPostID).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to add reaction in Redis: %w", err)
+	}
+
+	switch code {
+	case addReactionTargetNotFound:
+		return false, fmt.Errorf("%w: %s", notFound, id)
+	case addReactionExists:
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+func (rp *Repo) RemoveReaction(reaction *entity.Reaction) (bool, error) {
+	keys := []string{rp.keys.reactions(reaction.Target()), rp.keys.reactionUsers(reaction.Target())}
+	removed, err := removeReactionScript.Run(rp.db, keys, reaction.Emoji, reactionMember(reaction)).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove reaction in Redis: %w", err)
+	}
+
+	return removed == 1, nil
+}
+
+// GetReactions reads the counts of every target in one pipeline and then, for a
+// known user, checks the user's reactions in a second one.
+func (rp *Repo) GetReactions(userID string, targets []entity.ReactionTarget) (map[entity.ReactionTarget][]*entity.ReactionCount, error) {
+	result := make(map[entity.ReactionTarget][]*entity.ReactionCount)
+	if len(targets) == 0 {
+		return result, nil
+	}
+	targets = uniqueTargets(targets)
+
+	pipe := rp.db.Pipeline()
+	counts := make([]*redis.StringStringMapCmd, len(targets))
+	for i, target := range targets {
+		counts[i] = pipe.HGetAll(rp.keys.reactions(target))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to get reactions from Redis: %w", err)
+	}
+
+	pipe = rp.db.Pipeline()
+	var reacted []*redis.BoolCmd
+	for i, target := range targets {
+		for emoji, value := range counts[i].Val() {
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse reaction count: %w", err)
+			}
+			result[target] = append(result[target], &entity.ReactionCount{Emoji: emoji, Count: count})
+			if userID != "" {
+				member := reactionMember(&entity.Reaction{UserID: userID, Emoji: emoji})
+				reacted = append(reacted, pipe.SIsMember(rp.keys.reactionUsers(target), member))
+			}
+		}
+	}
+	if len(reacted) == 0 {
+		return result, nil
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to get reactions from Redis: %w", err)
+	}
+
+	// The second pipeline was queued in the same order the counts were appended in.
+	next := 0
+	for _, target := range targets {
+		for _, count := range result[target] {
+			count.ReactedByMe = reacted[next].Val()
+			next++
+		}
+	}
+	return result, nil
+}
+
+// reactionMember identifies a reaction within its target's reaction users set.
+// User IDs are UUIDs, so they never contain the separator.
+func reactionMember(reaction *entity.Reaction) string {
+	return reaction.UserID + ":" + reaction.Emoji
+}
+
+func uniqueTargets(targets []entity.ReactionTarget) []entity.ReactionTarget {
+	seen := make(map[entity.ReactionTarget]bool, len(targets))
+	unique := make([]entity.ReactionTarget, 0, len(targets))
+	for _, target := range targets {
+		if !seen[target] {
+			seen[target] = true
+			unique = append(unique, target)
+		}
+	}
+	return unique
+}
@@ -2,22 +2,50 @@ package redis
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/apartapatia/wall_of_comments/internal/config"
-	"github.com/go-playground/validator/v10"
 	"github.com/go-redis/redis"
 	"github.com/sirupsen/logrus"
 )
 
+// schemaVersion is the version of the key layout this package reads and writes.
+// Bump it whenever stored data has to be migrated before it can be read.
+// Version 2 stores timestamps with sub-second precision and scores the indexes
+// in microseconds. Version 3 adds the HOT and BEST rank indexes, and version 4
+// the full-text search index. Version 5 replaces the commentsActive flag of
+// posts with their moderation mode, and version 6 indexes pending comments per post.
+// Version 7 adds the HOT and BEST rank indexes of every comment of a post.
+const schemaVersion = 7
+
 var ErrRedisConnect = errors.New("redis connection error")
+var ErrSchemaVersion = errors.New("incompatible redis schema version")
 
+// GetRepo connects to Redis and verifies that the data under the configured namespace
+// uses the current key layout. Existing data is always kept.
 func GetRepo(cfg config.RedisConfig) (*Repo, error) {
+	repo, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repo.checkSchemaVersion(); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Connect returns a repo without verifying the stored schema version.
+// It is meant for maintenance commands that repair or reset the data.
+func Connect(cfg config.RedisConfig) (*Repo, error) {
 	rc, err := newClient(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Repo{db: rc, validate: validator.New()}, nil
+	return &Repo{db: rc, keys: newKeyspace(cfg.Namespace)}, nil
 }
 
 func newClient(cfg config.RedisConfig) (*redis.Client, error) {
@@ -34,6 +62,77 @@ func newClient(cfg config.RedisConfig) (*redis.Client, error) {
 		return nil, ErrRedisConnect
 	}
 
-	rc.FlushAll()
 	return rc, nil
 }
+
+// checkSchemaVersion stamps an empty namespace with the current version and refuses
+// to read a namespace written with any other layout.
+func (rp *Repo) checkSchemaVersion() error {
+	stored, err := rp.db.Get(rp.keys.schemaVersion()).Result()
+	if errors.Is(err, redis.Nil) {
+		empty, err := rp.isEmpty()
+		if err != nil {
+			return err
+		}
+		if !empty {
+			logrus.Errorf("redis namespace %q has data but no schema version, run the reindex command", rp.keys.prefix)
+			return ErrSchemaVersion
+		}
+		return rp.setSchemaVersion()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get schema version from Redis: %w", err)
+	}
+
+	version, err := strconv.Atoi(stored)
+	if err == nil && version < schemaVersion {
+		logrus.Errorf("redis namespace %q has schema version %d, run the migrate command to upgrade it to %d", rp.keys.prefix, version, schemaVersion)
+		return ErrSchemaVersion
+	}
+	if err != nil || version != schemaVersion {
+		logrus.Errorf("redis namespace %q has schema version %s, expected %d", rp.keys.prefix, stored, schemaVersion)
+		return ErrSchemaVersion
+	}
+
+	return nil
+}
+
+func (rp *Repo) setSchemaVersion() error {
+	if err := rp.db.Set(rp.keys.schemaVersion(), schemaVersion, 0).Err(); err != nil {
+		return fmt.Errorf("failed to set schema version in Redis: %w", err)
+	}
+	return nil
+}
+
+func (rp *Repo) isEmpty() (bool, error) {
+	var cursor uint64
+	for {
+		keys, next, err := rp.db.Scan(cursor, rp.keys.all(), scanBatchSize).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to scan Redis: %w", err)
+		}
+		if len(keys) > 0 {
+			return false, nil
+		}
+		if next == 0 {
+			return true, nil
+		}
+		cursor = next
+	}
+}
+
+// Reset deletes every key under the configured namespace and stamps it with the
+// current schema version. It replaces the flush that used to run on every start.
+func (rp *Repo) Reset() error {
+	deleted := 0
+	err := rp.scan(rp.keys.all(), func(keys []string) error {
+		deleted += len(keys)
+		return rp.db.Del(keys...).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset redis: %w", err)
+	}
+
+	logrus.Infof("deleted %d keys from redis namespace %q", deleted, rp.keys.prefix)
+	return rp.setSchemaVersion()
+}
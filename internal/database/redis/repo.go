@@ -2,77 +2,67 @@ package redis
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"sort"
+	"maps"
 	"time"
 
+	"github.com/apartapatia/wall_of_comments/internal/database"
 	"github.com/apartapatia/wall_of_comments/internal/entity"
-	"github.com/go-playground/validator/v10"
 	"github.com/go-redis/redis"
 )
 
-var ErrNotActive = errors.New("post comments are not active")
+var ErrNotActive = database.ErrCommentsNotActive
 
 type Repo struct {
-	db       *redis.Client
-	validate *validator.Validate
+	db   *redis.Client
+	keys keyspace
 }
 
-func (rp *Repo) GetPosts() ([]*entity.Post, error) {
-	keys, err := rp.db.Keys("post:*").Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get post keys from Redis: %w", err)
-	}
-
-	var posts []*entity.Post
-	for _, key := range keys {
-		data, err := rp.db.HGetAll(key).Result()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get post from Redis: %w", err)
-		}
-		post, err := mapToPost(data)
-		if err != nil {
-			return nil, fmt.Errorf("failed map to post: %w", err)
-		}
-
-		comments, err := rp.GetCommentsForPost(post.ID)
+func (rp *Repo) GetPosts(order database.PostSort) ([]*entity.Post, error) {
+	if order.ByRank() {
+		ids, err := rp.zrevrangeIDs(rp.keys.postRanks(order), 0, -1)
 		if err != nil {
-			return nil, fmt.Errorf("failed get comments for post: %w", err)
-		}
-
-		if comments == nil {
-			comments = []*entity.Comment{}
+			return nil, err
 		}
-
-		post.Comments = comments
-
-		posts = append(posts, post)
+		return rp.loadPosts(ids)
 	}
 
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].UpdatedAt.Before(posts[j].CreatedAt)
-	})
+	ids, err := rp.zrange(rp.keys.posts(), 0, -1, order == database.PostSortNewest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get post index from Redis: %w", err)
+	}
 
-	return posts, nil
+	return rp.loadPosts(ids)
 }
 
-func (rp *Repo) CreatePost(post *entity.Post) (*entity.Post, error) {
-	if err := rp.validate.Struct(post); err != nil {
-		return nil, fmt.Errorf("failed to validate post: %w", err)
+func (rp *Repo) GetPostsAfter(first int, after *database.Cursor) ([]*entity.Post, bool, error) {
+	ids, hasNext, err := rp.rangeAfter(rp.keys.posts(), first, after)
+	if err != nil {
+		return nil, false, err
 	}
 
-	redisID := fmt.Sprintf("post:%s", post.ID)
-	post.CreatedAt = time.Now()
-	post.UpdatedAt = post.CreatedAt
-
-	data, err := postToMap(post)
+	posts, err := rp.loadPosts(ids)
 	if err != nil {
-		return nil, fmt.Errorf("failed map to post: %w", err)
+		return nil, false, err
 	}
 
-	_, err = rp.db.HMSet(redisID, data).Result()
-	if err != nil {
+	return posts, hasNext, nil
+}
+
+func (rp *Repo) CreatePost(post *entity.Post) (*entity.Post, error) {
+	database.RankPost(post)
+	fields := postToMap(post)
+	fields["hotRank"] = formatRank(post.HotRank)
+	fields["bestRank"] = formatRank(post.BestRank)
+
+	member := rankMember(post.CreatedAt, post.ID)
+	pipe := rp.db.TxPipeline()
+	pipe.HMSet(rp.keys.post(post.ID), fields)
+	pipe.ZAdd(rp.keys.posts(), redis.Z{Score: score(post.CreatedAt), Member: post.ID})
+	pipe.ZAdd(rp.keys.postRanks(database.PostSortHot), redis.Z{Score: post.HotRank, Member: member})
+	pipe.ZAdd(rp.keys.postRanks(database.PostSortBest), redis.Z{Score: post.BestRank, Member: member})
+	rp.indexText(pipe, database.SearchPosts, post.ID, postText(post))
+	if _, err := pipe.Exec(); err != nil {
 		return nil, fmt.Errorf("failed set post to Redis: %w", err)
 	}
 
@@ -80,14 +70,13 @@ func (rp *Repo) CreatePost(post *entity.Post) (*entity.Post, error) {
 }
 
 func (rp *Repo) GetPostById(id string) (*entity.Post, error) {
-	key := fmt.Sprintf("post:%s", id)
-	data, err := rp.db.HGetAll(key).Result()
+	data, err := rp.db.HGetAll(rp.keys.post(id)).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get post from Redis: %w", err)
 	}
 
 	if len(data) == 0 {
-		return nil, fmt.Errorf("post with id %s not found", id)
+		return nil, fmt.Errorf("%w: %s", database.ErrPostNotFound, id)
 	}
 
 	post, err := mapToPost(data)
@@ -95,199 +84,618 @@ func (rp *Repo) GetPostById(id string) (*entity.Post, error) {
 		return nil, fmt.Errorf("failed to map post: %w", err)
 	}
 
-	comments, err := rp.GetCommentsForPost(post.ID)
+	return post, nil
+}
+
+func (rp *Repo) UpdatePost(post *entity.Post) (*entity.Post, error) {
+	exists, err := rp.db.Exists(rp.keys.post(post.ID)).Result()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comments for post: %w", err)
+		return nil, fmt.Errorf("failed to check post in Redis: %w", err)
 	}
-
-	if comments == nil {
-		comments = []*entity.Comment{}
+	if exists == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrPostNotFound, post.ID)
 	}
 
-	post.Comments = comments
+	pipe := rp.db.TxPipeline()
+	if err := rp.unindex(pipe, database.SearchPosts, post.ID); err != nil {
+		return nil, err
+	}
+	rp.indexText(pipe, database.SearchPosts, post.ID, postText(post))
+	pipe.HMSet(rp.keys.post(post.ID), map[string]interface{}{
+		"title":     post.Title,
+		"content":   post.Content,
+		"updatedAt": formatTime(post.UpdatedAt),
+	})
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to update post in Redis: %w", err)
+	}
 
 	return post, nil
 }
 
-func (rp *Repo) GetCommentsForPost(postID string) ([]*entity.Comment, error) {
-	keys, err := rp.db.Keys(fmt.Sprintf("comment:*")).Result()
+func (rp *Repo) DeletePost(id string) error {
+	post, err := rp.GetPostById(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comment keys from Redis: %w", err)
+		return err
 	}
 
-	var comments []*entity.Comment
-	for _, key := range keys {
-		data, err := rp.db.HGetAll(key).Result()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get comment from Redis: %w", err)
-		}
-		comment, err := mapToComment(data)
-		if err != nil {
-			return nil, fmt.Errorf("failed map to comment: %w", err)
-		}
+	commentIDs, err := rp.db.ZRange(rp.keys.postComments(id), 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get comment index from Redis: %w", err)
+	}
 
-		if comment.PostID == postID {
-			comments = append(comments, comment)
-		}
+	pipe := rp.db.TxPipeline()
+	if err := rp.unindex(pipe, database.SearchPosts, id); err != nil {
+		return err
+	}
+	if err := rp.unindex(pipe, database.SearchComments, commentIDs...); err != nil {
+		return err
 	}
+	if err := rp.deleteReports(pipe, commentIDs...); err != nil {
+		return err
+	}
+	for _, commentID := range commentIDs {
+		pipe.ZRem(rp.keys.pendingComments(), commentID)
+		pipe.Del(rp.keys.comment(commentID), rp.keys.revisions(commentID), rp.keys.replies(commentID), rp.keys.votes(commentID))
+		pipe.Del(rp.keys.commentRanks(database.CommentSortHot, id, commentID), rp.keys.commentRanks(database.CommentSortBest, id, commentID))
+		target := entity.ReactionTarget{PostID: id, CommentID: commentID}
+		pipe.Del(rp.keys.reactions(target), rp.keys.reactionUsers(target))
+	}
+	pipe.Del(rp.keys.post(id), rp.keys.postComments(id), rp.keys.postPendingComments(id))
+	target := entity.ReactionTarget{PostID: id}
+	pipe.Del(rp.keys.reactions(target), rp.keys.reactionUsers(target))
+	pipe.Del(rp.keys.commentRanks(database.CommentSortHot, id, ""), rp.keys.commentRanks(database.CommentSortBest, id, ""))
+	pipe.Del(rp.keys.postCommentRanks(database.CommentSortHot, id), rp.keys.postCommentRanks(database.CommentSortBest, id))
+	pipe.ZRem(rp.keys.posts(), id)
+	member := rankMember(post.CreatedAt, id)
+	pipe.ZRem(rp.keys.postRanks(database.PostSortHot), member)
+	pipe.ZRem(rp.keys.postRanks(database.PostSortBest), member)
 
-	return comments, nil
+	if _, err := pipe.Exec(); err != nil {
+		return fmt.Errorf("failed to delete post from Redis: %w", err)
+	}
+
+	return nil
+}
+
+func (rp *Repo) SetPostModerationMode(id string, mode entity.ModerationMode) (*entity.Post, error) {
+	post, err := rp.GetPostById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	post.ModerationMode = mode
+	post.UpdatedAt = database.Now()
+	_, err = rp.db.HMSet(rp.keys.post(id), map[string]interface{}{
+		"moderationMode": string(post.ModerationMode),
+		"updatedAt":      formatTime(post.UpdatedAt),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update post in Redis: %w", err)
+	}
+
+	return post, nil
+}
+
+func (rp *Repo) GetCommentsForPost(postID string) ([]*entity.Comment, error) {
+	ids, err := rp.db.ZRange(rp.keys.postComments(postID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment index from Redis: %w", err)
+	}
+
+	return rp.loadComments(ids)
 }
 
 func (rp *Repo) CreateComment(comment *entity.Comment) (*entity.Comment, error) {
-	if err := rp.validate.Struct(comment); err != nil {
-		return nil, fmt.Errorf("failed to validate comment: %w", err)
+	database.RankComment(comment)
+	parentID := ""
+	if comment.ParentID != nil {
+		parentID = *comment.ParentID
+	}
+
+	keys := []string{
+		rp.keys.post(comment.PostID),
+		rp.keys.comment(comment.ID),
+		rp.keys.postComments(comment.PostID),
+		rp.keys.commentRanks(database.CommentSortHot, comment.PostID, parentID),
+		rp.keys.commentRanks(database.CommentSortBest, comment.PostID, parentID),
+		rp.keys.pendingComments(),
+		rp.keys.postPendingComments(comment.PostID),
+		rp.keys.postCommentRanks(database.CommentSortHot, comment.PostID),
+		rp.keys.postCommentRanks(database.CommentSortBest, comment.PostID),
 	}
+	if parentID != "" {
+		keys = append(keys, rp.keys.comment(parentID), rp.keys.replies(parentID))
+	}
+
+	hotRank, bestRank := formatRank(comment.HotRank), formatRank(comment.BestRank)
+	held := "0"
+	if comment.Status == entity.CommentPending {
+		held = "1"
+	}
+	args := []interface{}{score(comment.CreatedAt), comment.ID, comment.PostID, hotRank, bestRank, rankMember(comment.CreatedAt, comment.ID), held}
+	for field, value := range commentToMap(comment) {
+		args = append(args, field, value)
+	}
+	args = append(args, "hotRank", hotRank, "bestRank", bestRank)
 
-	post, err := rp.GetPostById(comment.PostID)
+	result, err := createCommentScript.Run(rp.db, keys, args...).Int()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to set comment to Redis: %w", err)
 	}
 
-	if !post.CommentsActive {
+	switch result {
+	case createCommentOK, createCommentPending:
+		comment.Status = entity.CommentPublished
+		if result == createCommentPending {
+			comment.Status = entity.CommentPending
+		}
+		// The script only checks the rules and writes the comment itself; the words are
+		// indexed right after it, and a comment missed here is indexed again by Reindex.
+		pipe := rp.db.TxPipeline()
+		rp.indexText(pipe, database.SearchComments, comment.ID, comment.Content)
+		if _, err := pipe.Exec(); err != nil {
+			return nil, fmt.Errorf("failed to index comment in Redis: %w", err)
+		}
+		return comment, nil
+	case createCommentPostNotFound:
+		return nil, fmt.Errorf("%w: %s", database.ErrPostNotFound, comment.PostID)
+	case createCommentNotActive:
 		return nil, ErrNotActive
+	case createCommentParentNotFound:
+		return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, *comment.ParentID)
+	case createCommentParentOnOtherPost:
+		return nil, database.ErrParentOnOtherPost
+	default:
+		return nil, fmt.Errorf("unexpected create comment result %d", result)
 	}
+}
 
-	comment.CreatedAt = time.Now()
-	comment.UpdatedAt = comment.CreatedAt
-	comment.PostID = post.ID
-	redisID := fmt.Sprintf("comment:%s", comment.ID)
+func (rp *Repo) GetCommentById(id string) (*entity.Comment, error) {
+	data, err := rp.db.HGetAll(rp.keys.comment(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment key from Redis: %w", err)
+	}
 
-	data, err := commentToMap(comment)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, id)
+	}
+
+	comment, err := mapToComment(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed comment to map: %w", err)
+		return nil, fmt.Errorf("failed map to comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+func (rp *Repo) GetCommentsForPostWithLimitAndOffset(postID string, limit *int, offset *int, order database.CommentSort, viewer database.Viewer) ([]*entity.Comment, error) {
+	start, stop := int64(0), int64(-1)
+	if limit != nil && offset != nil {
+		if *limit <= 0 {
+			return []*entity.Comment{}, nil
+		}
+		start = int64(*offset)
+		stop = start + int64(*limit) - 1
 	}
 
-	_, err = rp.db.HMSet(redisID, data).Result()
+	hidden, err := rp.hiddenFrom(postID, viewer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to set comment to Redis: %w", err)
+		return nil, err
 	}
 
-	if comment.ParentID != nil {
-		parentComment, err := rp.GetCommentById(*comment.ParentID)
+	// No index keeps the orders by replies, so those are sorted here.
+	if order.ByReplies() {
+		all, err := rp.GetCommentsForPost(postID)
 		if err != nil {
-			return nil, fmt.Errorf("failed get comment by id: %w", err)
+			return nil, err
 		}
-		parentComment.Replies = append(parentComment.Replies, comment)
-		data, err := commentToMap(parentComment)
+		counts, err := rp.replyCounts(all, hidden)
 		if err != nil {
-			return nil, fmt.Errorf("failed comment to map: %w", err)
+			return nil, err
+		}
+		comments := make([]*entity.Comment, 0, len(all))
+		for _, comment := range all {
+			if _, ok := hidden[comment.ID]; !ok {
+				comments = append(comments, comment)
+			}
+		}
+		database.SortComments(comments, order, counts)
+
+		if stop < 0 || stop >= int64(len(comments)) {
+			stop = int64(len(comments)) - 1
 		}
-		_, err = rp.db.HMSet(parentComment.ID, data).Result()
+		if start > stop {
+			return []*entity.Comment{}, nil
+		}
+		return comments[start : stop+1], nil
+	}
+
+	// The flat list mixes every level, so ranked orders read the rank index of
+	// the whole post rather than the ones of the siblings.
+	read := func(start int64, stop int64) ([]string, error) {
+		if !order.ByRank() {
+			ids, err := rp.zrange(rp.keys.postComments(postID), start, stop, order == database.CommentSortNewest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get comment index from Redis: %w", err)
+			}
+			return ids, nil
+		}
+
+		members, err := rp.db.ZRevRange(rp.keys.postCommentRanks(order, postID), start, stop).Result()
 		if err != nil {
-			return nil, fmt.Errorf("failed to set comment to Redis: %w", err)
+			return nil, fmt.Errorf("failed to read rank index from Redis: %w", err)
 		}
+		ids := make([]string, len(members))
+		for i, member := range members {
+			ids[i] = rankMemberID(member)
+		}
+		return ids, nil
 	}
 
-	post.Comments = append(post.Comments, comment)
-	data, err = postToMap(post)
-	if err != nil {
-		return nil, fmt.Errorf("failed post to map: %w", err)
+	if len(hidden) == 0 {
+		ids, err := read(start, stop)
+		if err != nil {
+			return nil, err
+		}
+		return rp.loadComments(ids)
 	}
-	_, err = rp.db.HMSet(post.ID, data).Result()
+
+	// Every hidden comment may come before the page, so the index is read from
+	// the top far enough to still fill it once they are left out.
+	last := int64(-1)
+	if stop >= 0 {
+		last = stop + int64(len(hidden))
+	}
+	ids, err := read(0, last)
 	if err != nil {
-		return nil, fmt.Errorf("failed to set post to Redis: %w", err)
+		return nil, err
 	}
+	ids = withoutHidden(ids, hidden)
 
-	return comment, nil
+	if stop < 0 || stop >= int64(len(ids)) {
+		stop = int64(len(ids)) - 1
+	}
+	if start > stop {
+		return []*entity.Comment{}, nil
+	}
+	return rp.loadComments(ids[start : stop+1])
 }
 
-func (rp *Repo) GetCommentById(id string) (*entity.Comment, error) {
-	key := fmt.Sprintf("comment:%s", id)
-	data, err := rp.db.HGetAll(key).Result()
+func (rp *Repo) GetCommentsForPostAfter(postID string, first int, after *database.Cursor, viewer database.Viewer) ([]*entity.Comment, bool, error) {
+	hidden, err := rp.hiddenFrom(postID, viewer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comment key from Redis: %w", err)
+		return nil, false, err
 	}
 
-	if len(data) == 0 {
-		return nil, fmt.Errorf("comment with id %s not found", id)
+	// Reading as many extra IDs as there are hidden comments still fills the page
+	// once they are left out, and more IDs past them mean more visible comments.
+	ids, hasNext, err := rp.rangeAfter(rp.keys.postComments(postID), first+len(hidden), after)
+	if err != nil {
+		return nil, false, err
+	}
+	if ids = withoutHidden(ids, hidden); len(ids) > first {
+		ids, hasNext = ids[:first], true
 	}
 
-	comment, err := mapToComment(data)
+	comments, err := rp.loadComments(ids)
 	if err != nil {
-		return nil, fmt.Errorf("failed map to comment: %w", err)
+		return nil, false, err
 	}
 
-	return comment, nil
+	return comments, hasNext, nil
 }
 
-func (rp *Repo) GetCommentsForPostWithLimitAndOffset(postID string, limit *int, offset *int) ([]*entity.Comment, error) {
-	keys, err := rp.db.Keys("comment:*").Result()
+// hiddenFrom returns the post's pending comments the viewer cannot see, by ID.
+func (rp *Repo) hiddenFrom(postID string, viewer database.Viewer) (map[string]*entity.Comment, error) {
+	if viewer.Moderator {
+		return nil, nil
+	}
+
+	ids, err := rp.db.ZRange(rp.keys.postPendingComments(postID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending comments from Redis: %w", err)
+	}
+	pending, err := rp.loadComments(ids)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comment keys from Redis: %w", err)
+		return nil, err
 	}
 
-	var comments []*entity.Comment
+	hidden := make(map[string]*entity.Comment)
+	for _, comment := range pending {
+		if !viewer.CanSee(comment) {
+			hidden[comment.ID] = comment
+		}
+	}
+	return hidden, nil
+}
 
-	var startIndex, endIndex int
+// withoutHidden filters the IDs in place, leaving out the hidden ones.
+func withoutHidden(ids []string, hidden map[string]*entity.Comment) []string {
+	visible := ids[:0]
+	for _, id := range ids {
+		if _, ok := hidden[id]; !ok {
+			visible = append(visible, id)
+		}
+	}
+	return visible
+}
 
-	if limit != nil && offset != nil {
-		startIndex = *offset
-		endIndex = *offset + *limit
-		if endIndex > len(keys) {
-			endIndex = len(keys)
+func (rp *Repo) GetCommentTrees(roots []database.TreeRoot, opts database.TreeOptions) (map[database.TreeRoot][]*entity.Comment, error) {
+	trees := make(map[database.TreeRoot][]*entity.Comment, len(roots))
+	for _, root := range roots {
+		trees[root] = []*entity.Comment{}
+	}
+	if len(roots) == 0 || opts.First <= 0 || opts.MaxDepth <= 0 {
+		return trees, nil
+	}
+
+	// The indexes are ordered by creation time, so ranking by replies has to
+	// look at every sibling before it can pick the first ones. The rank indexes
+	// already hold the siblings in order, so ranked pages are read directly.
+	offset := max(opts.Offset, 0)
+	rootCandidates, candidates := offset+opts.First, opts.First
+	if opts.Order.ByReplies() {
+		rootCandidates, candidates = -1, -1
+	}
+	reverse := opts.Order == database.CommentSortNewest
+	ranked := opts.Order.ByRank()
+
+	// The comments the viewer cannot see are left out before paging, so they
+	// neither shorten a page nor count as replies.
+	hidden := make(map[string]*entity.Comment)
+	posts := make(map[string]struct{})
+	for root := range trees {
+		if _, read := posts[root.PostID]; read {
+			continue
 		}
-	} else {
-		startIndex = 0
-		endIndex = len(keys)
+		posts[root.PostID] = struct{}{}
+		postHidden, err := rp.hiddenFrom(root.PostID, opts.Viewer)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(hidden, postHidden)
 	}
 
-	for _, key := range keys {
-		data, err := rp.db.HGetAll(key).Result()
+	var ids []string
+	if ranked {
+		unique := make([]database.TreeRoot, 0, len(trees))
+		for root := range trees {
+			unique = append(unique, root)
+		}
+		rootIDs, err := rp.rankedIDs(opts.Order, unique, offset, opts.First, hidden)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get comment from Redis: %w", err)
+			return nil, err
+		}
+		ids = rootIDs
+	} else {
+		var parentIDs []string
+		for root := range trees {
+			if root.ParentID != "" {
+				parentIDs = append(parentIDs, root.ParentID)
+				continue
+			}
+			rootIDs, err := rp.rootCommentIDs(root.PostID, rootCandidates, reverse, hidden)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, rootIDs...)
 		}
-		comment, err := mapToComment(data)
+		if len(parentIDs) > 0 {
+			replyIDs, err := rp.replyIDs(parentIDs, rootCandidates, reverse, hidden)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, replyIDs...)
+		}
+	}
+
+	// owners maps every comment on the previous level to the trees it is part of,
+	// which can be more than one when the roots overlap.
+	var owners map[string][]database.TreeRoot
+	for depth := 1; len(ids) > 0; depth++ {
+		level, err := rp.loadComments(ids)
 		if err != nil {
-			return nil, fmt.Errorf("failed to map to comment: %w", err)
+			return nil, err
 		}
 
-		if comment.PostID == postID {
-			comments = append(comments, comment)
+		var counts map[string]int
+		if opts.Order.ByReplies() {
+			if counts, err = rp.replyCounts(level, hidden); err != nil {
+				return nil, err
+			}
+		}
+		database.SortComments(level, opts.Order, counts)
+		if depth == 1 && !ranked {
+			level = pagePerParent(level, offset, opts.First)
+		} else {
+			level = pagePerParent(level, 0, opts.First)
+		}
+
+		next := make(map[string][]database.TreeRoot, len(level))
+		for _, comment := range level {
+			var in []database.TreeRoot
+			if depth == 1 {
+				root := database.TreeRoot{PostID: comment.PostID}
+				if comment.ParentID != nil {
+					root.ParentID = *comment.ParentID
+				}
+				if _, requested := trees[root]; !requested {
+					continue
+				}
+				in = []database.TreeRoot{root}
+			} else {
+				in = owners[*comment.ParentID]
+			}
+
+			for _, root := range in {
+				trees[root] = append(trees[root], comment)
+			}
+			next[comment.ID] = in
+		}
+		owners = next
+
+		if depth == opts.MaxDepth {
+			break
+		}
+
+		if ranked {
+			parents := make([]database.TreeRoot, 0, len(level))
+			for _, comment := range level {
+				if _, kept := owners[comment.ID]; kept {
+					parents = append(parents, database.TreeRoot{PostID: comment.PostID, ParentID: comment.ID})
+				}
+			}
+			if ids, err = rp.rankedIDs(opts.Order, parents, 0, opts.First, hidden); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		ids = ids[:0]
+		for id := range owners {
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if ids, err = rp.replyIDs(ids, candidates, reverse, hidden); err != nil {
+			return nil, err
 		}
 	}
 
-	if startIndex >= len(comments) {
-		return []*entity.Comment{}, nil
+	return trees, nil
+}
+
+func (rp *Repo) UpdateComment(comment *entity.Comment) (*entity.Comment, error) {
+	stored, err := rp.GetCommentById(comment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	writtenAt := stored.CreatedAt
+	if stored.EditedAt != nil {
+		writtenAt = *stored.EditedAt
+	}
+
+	revision, err := json.Marshal(&entity.CommentRevision{CommentID: stored.ID, Content: stored.Content, CreatedAt: writtenAt})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal revision: %w", err)
+	}
+
+	pipe := rp.db.TxPipeline()
+	if err := rp.unindex(pipe, database.SearchComments, comment.ID); err != nil {
+		return nil, err
+	}
+	rp.indexText(pipe, database.SearchComments, comment.ID, comment.Content)
+	pipe.RPush(rp.keys.revisions(comment.ID), revision)
+	pipe.HMSet(rp.keys.comment(comment.ID), commentToMap(comment))
+	if comment.Status == entity.CommentPending {
+		pipe.HSet(rp.keys.comment(comment.ID), "status", string(entity.CommentPending))
+		pending := redis.Z{Score: score(comment.CreatedAt), Member: comment.ID}
+		pipe.ZAdd(rp.keys.pendingComments(), pending)
+		pipe.ZAdd(rp.keys.postPendingComments(comment.PostID), pending)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to update comment in Redis: %w", err)
+	}
+
+	return comment, nil
+}
+
+func (rp *Repo) DeleteComment(id string) error {
+	comment, err := rp.GetCommentById(id)
+	if err != nil {
+		return err
+	}
+
+	replies, err := rp.db.ZCard(rp.keys.replies(id)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get reply index from Redis: %w", err)
+	}
+
+	pipe := rp.db.TxPipeline()
+	if err := rp.unindex(pipe, database.SearchComments, id); err != nil {
+		return err
 	}
-	if endIndex > len(comments) {
-		endIndex = len(comments)
+	if err := rp.deleteReports(pipe, id); err != nil {
+		return err
+	}
+	pipe.Del(rp.keys.revisions(id))
+	pipe.ZRem(rp.keys.pendingComments(), id)
+	pipe.ZRem(rp.keys.postPendingComments(comment.PostID), id)
+	if replies > 0 {
+		comment.Content = entity.DeletedCommentContent
+		comment.Deleted = true
+		comment.UpdatedAt = database.Now()
+		pipe.HMSet(rp.keys.comment(id), commentToMap(comment))
+	} else {
+		target := entity.ReactionTarget{PostID: comment.PostID, CommentID: id}
+		pipe.Del(rp.keys.comment(id), rp.keys.votes(id), rp.keys.reactions(target), rp.keys.reactionUsers(target))
+		pipe.ZRem(rp.keys.postComments(comment.PostID), id)
+		parentID := ""
+		if comment.ParentID != nil {
+			parentID = *comment.ParentID
+			pipe.ZRem(rp.keys.replies(parentID), id)
+		}
+		member := rankMember(comment.CreatedAt, id)
+		pipe.ZRem(rp.keys.commentRanks(database.CommentSortHot, comment.PostID, parentID), member)
+		pipe.ZRem(rp.keys.commentRanks(database.CommentSortBest, comment.PostID, parentID), member)
+		pipe.ZRem(rp.keys.postCommentRanks(database.CommentSortHot, comment.PostID), member)
+		pipe.ZRem(rp.keys.postCommentRanks(database.CommentSortBest, comment.PostID), member)
 	}
-	comments = comments[startIndex:endIndex]
 
-	return comments, nil
+	if _, err := pipe.Exec(); err != nil {
+		return fmt.Errorf("failed to delete comment from Redis: %w", err)
+	}
+
+	return nil
 }
 
-func postToMap(post *entity.Post) (map[string]interface{}, error) {
-	comments, err := json.Marshal(post.Comments)
+func (rp *Repo) GetCommentRevisions(commentID string) ([]*entity.CommentRevision, error) {
+	values, err := rp.db.LRange(rp.keys.revisions(commentID), 0, -1).Result()
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal comments: %w", err)
+		return nil, fmt.Errorf("failed to get revisions from Redis: %w", err)
+	}
+
+	revisions := make([]*entity.CommentRevision, 0, len(values))
+	for _, value := range values {
+		var revision entity.CommentRevision
+		if err := json.Unmarshal([]byte(value), &revision); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal revision: %w", err)
+		}
+		revisions = append(revisions, &revision)
 	}
 
+	return revisions, nil
+}
+
+func postToMap(post *entity.Post) map[string]interface{} {
 	return map[string]interface{}{
 		"id":             post.ID,
 		"title":          post.Title,
 		"content":        post.Content,
-		"commentsActive": post.CommentsActive,
-		"createdAt":      post.CreatedAt.Format(time.RFC3339),
-		"updatedAt":      post.UpdatedAt.Format(time.RFC3339),
-		"comments":       string(comments),
-	}, nil
-}
-
-func commentToMap(comment *entity.Comment) (map[string]interface{}, error) {
-	replies, err := json.Marshal(comment.Replies)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal replies: %w", err)
+		"moderationMode": string(post.ModerationMode),
+		"authorId":       post.AuthorID,
+		"createdAt":      formatTime(post.CreatedAt),
+		"updatedAt":      formatTime(post.UpdatedAt),
 	}
+}
 
+// commentToMap leaves out the vote counters, ranks, hidden flag and status. They are
+// only ever changed by voteCommentScript, setRanksScript, createCommentScript and
+// moderateCommentScript, so writing a comment back cannot undo a concurrent vote
+// or moderation.
+func commentToMap(comment *entity.Comment) map[string]interface{} {
 	result := map[string]interface{}{
 		"id":        comment.ID,
 		"postId":    comment.PostID,
+		"authorId":  comment.AuthorID,
 		"content":   comment.Content,
-		"createdAt": comment.CreatedAt.Format(time.RFC3339),
-		"updatedAt": comment.UpdatedAt.Format(time.RFC3339),
-		"replies":   string(replies),
+		"deleted":   comment.Deleted,
+		"createdAt": formatTime(comment.CreatedAt),
+		"updatedAt": formatTime(comment.UpdatedAt),
+		"tags":      formatTags(comment.Tags),
 	}
 
 	if comment.ParentID != nil {
@@ -296,65 +704,132 @@ func commentToMap(comment *entity.Comment) (map[string]interface{}, error) {
 		result["parentId"] = ""
 	}
 
-	return result, nil
+	if comment.EditedAt != nil {
+		result["editedAt"] = formatTime(*comment.EditedAt)
+	} else {
+		result["editedAt"] = ""
+	}
+
+	return result
+}
+
+// formatTags stores no tags as an empty string, like the other optional fields.
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(tags)
+	return string(data)
 }
 
 func mapToPost(data map[string]string) (*entity.Post, error) {
-	createdAt, err := time.Parse(time.RFC3339, data["createdAt"])
+	createdAt, err := parseTime(data["createdAt"])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse createdAt: %w", err)
 	}
 
-	updatedAt, err := time.Parse(time.RFC3339, data["updatedAt"])
+	updatedAt, err := parseTime(data["updatedAt"])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse updatedAt: %w", err)
 	}
 
-	var comments []*entity.Comment
-	if err := json.Unmarshal([]byte(data["comments"]), &comments); err != nil {
-		comments = []*entity.Comment{}
+	upvotes, downvotes, hotRank, bestRank, err := parseVotes(data)
+	if err != nil {
+		return nil, err
 	}
 
 	return &entity.Post{
 		ID:             data["id"],
 		Title:          data["title"],
 		Content:        data["content"],
-		CommentsActive: data["commentsActive"] == "1",
+		ModerationMode: entity.ModerationMode(data["moderationMode"]),
+		AuthorID:       data["authorId"],
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
-		Comments:       comments,
+		Upvotes:        upvotes,
+		Downvotes:      downvotes,
+		HotRank:        hotRank,
+		BestRank:       bestRank,
 	}, nil
 }
 
 func mapToComment(data map[string]string) (*entity.Comment, error) {
-	createdAt, err := time.Parse(time.RFC3339, data["createdAt"])
+	createdAt, err := parseTime(data["createdAt"])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse createdAt: %w", err)
 	}
 
-	updatedAt, err := time.Parse(time.RFC3339, data["updatedAt"])
+	updatedAt, err := parseTime(data["updatedAt"])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse updatedAt: %w", err)
 	}
 
-	var replies []*entity.Comment
-	if err := json.Unmarshal([]byte(data["replies"]), &replies); err != nil {
-		replies = []*entity.Comment{}
-	}
-
 	var parentID *string
 	if data["parentId"] != "" {
 		parentIDValue := data["parentId"]
 		parentID = &parentIDValue
 	}
 
+	var editedAt *time.Time
+	if data["editedAt"] != "" {
+		editedAtValue, err := parseTime(data["editedAt"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse editedAt: %w", err)
+		}
+		editedAt = &editedAtValue
+	}
+
+	upvotes, downvotes, hotRank, bestRank, err := parseVotes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	if data["tags"] != "" {
+		if err := json.Unmarshal([]byte(data["tags"]), &tags); err != nil {
+			return nil, fmt.Errorf("failed to parse tags: %w", err)
+		}
+	}
+
+	// Comments written before premoderation have no status and were all published.
+	status := entity.CommentStatus(data["status"])
+	if status == "" {
+		status = entity.CommentPublished
+	}
+
 	return &entity.Comment{
 		ID:        data["id"],
 		PostID:    data["postId"],
 		ParentID:  parentID,
+		AuthorID:  data["authorId"],
 		Content:   data["content"],
+		Deleted:   data["deleted"] == "1",
+		Hidden:    data["hidden"] == "1",
+		Status:    status,
+		Tags:      tags,
 		CreatedAt: createdAt,
 		UpdatedAt: updatedAt,
-		Replies:   replies,
+		EditedAt:  editedAt,
+		Upvotes:   upvotes,
+		Downvotes: downvotes,
+		HotRank:   hotRank,
+		BestRank:  bestRank,
 	}, nil
 }
+
+// parseVotes reads the vote counters and ranks of a post or comment hash.
+func parseVotes(data map[string]string) (upvotes int, downvotes int, hotRank float64, bestRank float64, err error) {
+	if upvotes, err = parseNumber[int](data["upvotes"]); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("failed to parse upvotes: %w", err)
+	}
+	if downvotes, err = parseNumber[int](data["downvotes"]); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("failed to parse downvotes: %w", err)
+	}
+	if hotRank, err = parseNumber[float64](data["hotRank"]); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("failed to parse hotRank: %w", err)
+	}
+	if bestRank, err = parseNumber[float64](data["bestRank"]); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("failed to parse bestRank: %w", err)
+	}
+	return upvotes, downvotes, hotRank, bestRank, nil
+}
@@ -2,11 +2,14 @@ package redis
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
-	"github.com/go-playground/validator/v10"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/ranking"
 	"github.com/go-redis/redis"
 	"github.com/stretchr/testify/assert"
 )
@@ -21,37 +24,50 @@ func setupTestDB() (*Repo, *miniredis.Miniredis) {
 		Addr: s.Addr(),
 	})
 
-	validate := validator.New()
-
 	repo := &Repo{
-		db:       client,
-		validate: validate,
+		db: client,
 	}
 
 	return repo, s
 }
 
+func editComment(t *testing.T, repo *Repo, id string, content string) (*entity.Comment, error) {
+	comment, err := repo.GetCommentById(id)
+	if err != nil {
+		t.Fatalf("failed to get comment: %v", err)
+	}
+
+	now := time.Now()
+	comment.Content = content
+	comment.EditedAt = &now
+	comment.UpdatedAt = now
+
+	return repo.UpdateComment(comment)
+}
+
 func TestRepo_GetPosts(t *testing.T) {
 	repo, s := setupTestDB()
 	defer s.Close()
 
 	s.HSet("post:1", "id", "1", "title", "Post 1", "content", "Content 1",
-		"commentsActive", "1", "createdAt", time.Now().Format(time.RFC3339),
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
 		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
 
 	s.HSet("post:2", "id", "2", "title", "Post 2", "content", "Content 2",
-		"commentsActive", "1", "createdAt", time.Now().Format(time.RFC3339),
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
 		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
 
 	s.HSet("post:3", "id", "3", "title", "Post 3", "content", "Content 3",
-		"commentsActive", "1", "createdAt", time.Now().Format(time.RFC3339),
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
 		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
 
 	s.HSet("post:4", "id", "4", "title", "Post 4", "content", "Content 4",
-		"commentsActive", "1", "createdAt", time.Now().Format(time.RFC3339),
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
 		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
 
-	posts, err := repo.GetPosts()
+	assert.NoError(t, repo.Reindex())
+
+	posts, err := repo.GetPosts(database.PostSortOldest)
 
 	assert.NoError(t, err)
 	assert.Len(t, posts, 4)
@@ -67,7 +83,7 @@ func TestRepo_GetPostByID(t *testing.T) {
 	defer s.Close()
 
 	s.HSet("post:1", "id", "1", "title", "Post 1", "content", "Content 1",
-		"commentsActive", "1", "createdAt", time.Now().Format(time.RFC3339),
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
 		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
 
 	post, err := repo.GetPostById("1")
@@ -82,7 +98,7 @@ func TestRepo_GetCommentsForPost(t *testing.T) {
 	defer s.Close()
 
 	s.HSet("post:1", "id", "1", "title", "Post 1", "content", "Content 1",
-		"commentsActive", "1", "createdAt", time.Now().Format(time.RFC3339),
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
 		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
 
 	s.HSet("comment:1", "id", "1", "postId", "1", "content", "Content comment 1",
@@ -90,6 +106,8 @@ func TestRepo_GetCommentsForPost(t *testing.T) {
 	s.HSet("comment:2", "id", "2", "postId", "1", "content", "Content comment 2",
 		"createdAt", time.Now().Format(time.RFC3339), "updatedAt", time.Now().Format(time.RFC3339), "replies", "[]", "parentId", "")
 
+	assert.NoError(t, repo.Reindex())
+
 	comments, err := repo.GetCommentsForPost("1")
 
 	assert.NoError(t, err)
@@ -103,7 +121,7 @@ func TestRepo_GetCommentsForPostWithLimitAndOffset(t *testing.T) {
 	defer s.Close()
 
 	s.HSet("post:1", "id", "1", "title", "Post 1", "content", "Content 1",
-		"commentsActive", "1", "createdAt", time.Now().Format(time.RFC3339),
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
 		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
 
 	s.HSet("comment:1", "id", "1", "postId", "1", "content", "Content comment 1",
@@ -123,9 +141,11 @@ func TestRepo_GetCommentsForPostWithLimitAndOffset(t *testing.T) {
 	s.HSet("comment:8", "id", "8", "postId", "1", "content", "Content comment 8",
 		"createdAt", time.Now().Format(time.RFC3339), "updatedAt", time.Now().Format(time.RFC3339), "replies", "[]", "parentId", "")
 
+	assert.NoError(t, repo.Reindex())
+
 	limit := 5
 	offset := 1
-	comments, err := repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset)
+	comments, err := repo.GetCommentsForPostWithLimitAndOffset("1", &limit, &offset, database.CommentSortOldest, database.Viewer{})
 	assert.NoError(t, err)
 	assert.Len(t, comments, limit)
 
@@ -139,7 +159,7 @@ func TestRepo_GetCommentById(t *testing.T) {
 	defer s.Close()
 
 	s.HSet("post:1", "id", "1", "title", "Post 1", "content", "Content 1",
-		"commentsActive", "1", "createdAt", time.Now().Format(time.RFC3339),
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
 		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
 
 	s.HSet("comment:1", "id", "1", "postId", "1", "content", "Content comment 1",
@@ -163,3 +183,445 @@ func TestRepo_GetCommentById(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, comment.Content, "Content comment 4")
 }
+
+func TestRepo_UpdateComment(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	s.HSet("comment:1", "id", "1", "postId", "1", "content", "Content comment 1",
+		"createdAt", time.Now().Format(time.RFC3339), "updatedAt", time.Now().Format(time.RFC3339), "replies", "[]", "parentId", "")
+
+	_, err := editComment(t, repo, "1", "Content comment 2")
+	assert.NoError(t, err)
+	updated, err := editComment(t, repo, "1", "Content comment 3")
+	assert.NoError(t, err)
+	assert.Equal(t, "Content comment 3", updated.Content)
+	assert.NotNil(t, updated.EditedAt)
+
+	comment, err := repo.GetCommentById("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Content comment 3", comment.Content)
+	assert.NotNil(t, comment.EditedAt)
+
+	revisions, err := repo.GetCommentRevisions("1")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, "Content comment 1", revisions[0].Content)
+	assert.Equal(t, "Content comment 2", revisions[1].Content)
+}
+
+func TestRepo_DeleteComment(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	s.HSet("comment:1", "id", "1", "postId", "1", "content", "Content comment 1",
+		"createdAt", time.Now().Format(time.RFC3339), "updatedAt", time.Now().Format(time.RFC3339), "replies", "[]", "parentId", "")
+	s.HSet("comment:2", "id", "2", "postId", "1", "content", "Content comment 2",
+		"createdAt", time.Now().Format(time.RFC3339), "updatedAt", time.Now().Format(time.RFC3339), "replies", "[]", "parentId", "1")
+
+	assert.NoError(t, repo.Reindex())
+
+	assert.NoError(t, repo.DeleteComment("1"))
+
+	tombstone, err := repo.GetCommentById("1")
+	assert.NoError(t, err)
+	assert.True(t, tombstone.Deleted)
+	assert.Equal(t, entity.DeletedCommentContent, tombstone.Content)
+
+	assert.NoError(t, repo.DeleteComment("2"))
+
+	_, err = repo.GetCommentById("2")
+	assert.Error(t, err)
+}
+
+func TestRepo_UpdatePost(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	s.HSet("post:1", "id", "1", "title", "Post 1", "content", "Content 1",
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
+		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
+
+	post, err := repo.GetPostById("1")
+	assert.NoError(t, err)
+
+	post.Title = "Post 1 edited"
+	_, err = repo.UpdatePost(post)
+	assert.NoError(t, err)
+
+	retPost, err := repo.GetPostById("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Post 1 edited", retPost.Title)
+	assert.Equal(t, "Content 1", retPost.Content)
+	assert.Equal(t, entity.ModerationOpen, retPost.ModerationMode)
+
+	_, err = repo.UpdatePost(&entity.Post{ID: "2", Title: "Post 2", Content: "Content 2"})
+	assert.Error(t, err)
+}
+
+func TestRepo_SetPostModerationMode(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	s.HSet("post:1", "id", "1", "title", "Post 1", "content", "Content 1",
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
+		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
+
+	_, err := repo.SetPostModerationMode("1", entity.ModerationClosed)
+	assert.NoError(t, err)
+
+	post, err := repo.GetPostById("1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.ModerationClosed, post.ModerationMode)
+
+	_, err = repo.CreateComment(&entity.Comment{ID: "1", PostID: "1", Content: "Content comment 1"})
+	assert.ErrorIs(t, err, ErrNotActive)
+}
+
+func TestRepo_DeletePost(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	s.HSet("post:1", "id", "1", "title", "Post 1", "content", "Content 1",
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
+		"updatedAt", time.Now().Format(time.RFC3339), "comments", "[]")
+	s.HSet("comment:1", "id", "1", "postId", "1", "content", "Content comment 1",
+		"createdAt", time.Now().Format(time.RFC3339), "updatedAt", time.Now().Format(time.RFC3339), "replies", "[]", "parentId", "")
+
+	assert.NoError(t, repo.Reindex())
+
+	assert.NoError(t, repo.DeletePost("1"))
+
+	_, err := repo.GetPostById("1")
+	assert.Error(t, err)
+	_, err = repo.GetCommentById("1")
+	assert.Error(t, err)
+}
+
+func TestRepo_GetPostsAfter(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	createdAt := time.Now()
+	for i := 1; i <= 5; i++ {
+		s.HSet(fmt.Sprintf("post:%d", i), "id", fmt.Sprintf("%d", i), "title", fmt.Sprintf("Post %d", i), "content", "Content",
+			"moderationMode", "open", "createdAt", createdAt.Format(time.RFC3339),
+			"updatedAt", createdAt.Format(time.RFC3339), "comments", "[]")
+	}
+
+	assert.NoError(t, repo.Reindex())
+
+	page, hasNext, err := repo.GetPostsAfter(3, nil)
+	assert.NoError(t, err)
+	assert.True(t, hasNext)
+	assert.Len(t, page, 3)
+	assert.Equal(t, "Post 1", page[0].Title)
+
+	last := page[len(page)-1]
+	page, hasNext, err = repo.GetPostsAfter(3, &database.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "Post 4", page[0].Title)
+	assert.Equal(t, "Post 5", page[1].Title)
+}
+
+func TestRepo_GetCommentsForPostAfter(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	createdAt := time.Now()
+	for i := 1; i <= 4; i++ {
+		s.HSet(fmt.Sprintf("comment:%d", i), "id", fmt.Sprintf("%d", i), "postId", "1", "content", fmt.Sprintf("Content comment %d", i),
+			"createdAt", createdAt.Format(time.RFC3339), "updatedAt", createdAt.Format(time.RFC3339), "replies", "[]", "parentId", "")
+	}
+
+	assert.NoError(t, repo.Reindex())
+
+	page, hasNext, err := repo.GetCommentsForPostAfter("1", 2, nil, database.Viewer{})
+	assert.NoError(t, err)
+	assert.True(t, hasNext)
+	assert.Len(t, page, 2)
+
+	last := page[len(page)-1]
+	page, hasNext, err = repo.GetCommentsForPostAfter("1", 10, &database.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, database.Viewer{})
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "Content comment 3", page[0].Content)
+	assert.Equal(t, "Content comment 4", page[1].Content)
+}
+
+func TestRepo_CreateComment(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	assert.NoError(t, err)
+
+	parentID := "1"
+	_, err = repo.CreateComment(&entity.Comment{ID: parentID, PostID: "1", Content: "Content comment 1"})
+	assert.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "2", PostID: "1", ParentID: &parentID, Content: "Content comment 2"})
+	assert.NoError(t, err)
+
+	missingID := "3"
+	_, err = repo.CreateComment(&entity.Comment{ID: "4", PostID: "1", ParentID: &missingID, Content: "Content comment 4"})
+	assert.ErrorIs(t, err, database.ErrCommentNotFound)
+	assert.False(t, s.Exists("comment:4"))
+
+	_, err = repo.CreateComment(&entity.Comment{ID: "5", PostID: "2", Content: "Content comment 5"})
+	assert.ErrorIs(t, err, database.ErrPostNotFound)
+	assert.False(t, s.Exists("comment:5"))
+
+	_, err = repo.CreatePost(&entity.Post{ID: "2", Title: "Post 2", Content: "Content 2", ModerationMode: entity.ModerationOpen})
+	assert.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "6", PostID: "2", ParentID: &parentID, Content: "Content comment 6"})
+	assert.ErrorIs(t, err, database.ErrParentOnOtherPost)
+	assert.False(t, s.Exists("comment:6"))
+
+	comments, err := repo.GetCommentsForPost("1")
+	assert.NoError(t, err)
+	assert.Len(t, comments, 2)
+
+	replies, err := s.ZMembers("comment_replies:1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, replies)
+}
+
+func TestRepo_Reindex(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	for i := 1; i <= 3; i++ {
+		_, err := repo.CreatePost(&entity.Post{ID: fmt.Sprintf("%d", i), Title: fmt.Sprintf("Post %d", i), Content: "Content", ModerationMode: entity.ModerationOpen})
+		assert.NoError(t, err)
+	}
+	parentID := "1"
+	_, err := repo.CreateComment(&entity.Comment{ID: parentID, PostID: "1", Content: "Content comment 1"})
+	assert.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "2", PostID: "1", ParentID: &parentID, Content: "Content comment 2"})
+	assert.NoError(t, err)
+
+	s.Del("posts")
+	s.Del("post_comments:1")
+	s.Del("comment_replies:1")
+	s.ZAdd("post_comments:1", 0, "stale")
+
+	assert.NoError(t, repo.Reindex())
+
+	posts, err := repo.GetPosts(database.PostSortOldest)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 3)
+
+	comments, err := repo.GetCommentsForPost("1")
+	assert.NoError(t, err)
+	assert.Len(t, comments, 2)
+
+	members, err := s.ZMembers("post_comments:1")
+	assert.NoError(t, err)
+	assert.NotContains(t, members, "stale")
+
+	replies, err := s.ZMembers("comment_replies:1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, replies)
+}
+
+func TestRepo_ReindexRanks(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	// Schema version 2 counted votes on comments only and kept no ranks.
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"1", "2"} {
+		s.HSet("post:"+id, "id", id, "title", "Post "+id, "content", "Content "+id,
+			"moderationMode", "open", "createdAt", formatTime(createdAt), "updatedAt", formatTime(createdAt))
+	}
+	s.HSet("comment:1", "id", "1", "postId", "1", "content", "Content comment 1", "parentId", "",
+		"createdAt", formatTime(createdAt), "updatedAt", formatTime(createdAt), "upvotes", "1")
+	s.HSet("comment:2", "id", "2", "postId", "2", "content", "Content comment 2", "parentId", "",
+		"createdAt", formatTime(createdAt), "updatedAt", formatTime(createdAt), "upvotes", "5", "downvotes", "1")
+
+	assert.NoError(t, repo.Reindex())
+
+	post, err := repo.GetPostById("2")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, post.Upvotes)
+	assert.Equal(t, 1, post.Downvotes)
+	assert.InDelta(t, ranking.Best(5, 1), post.BestRank, 1e-9)
+
+	posts, err := repo.GetPosts(database.PostSortBest)
+	assert.NoError(t, err)
+	if assert.Len(t, posts, 2) {
+		assert.Equal(t, "2", posts[0].ID)
+	}
+
+	comment, err := repo.GetCommentById("1")
+	assert.NoError(t, err)
+	assert.InDelta(t, ranking.Hot(1, 0, createdAt), comment.HotRank, 1e-9)
+	members, err := s.ZMembers("comment_ranks:HOT:1:")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{rankMember(createdAt, "1")}, members)
+}
+
+func TestRepo_ReindexSearch(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	// Schema version 3 kept no search index.
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.HSet("post:1", "id", "1", "title", "Redis guide", "content", "Content 1",
+		"moderationMode", "open", "createdAt", formatTime(createdAt), "updatedAt", formatTime(createdAt))
+	s.HSet("comment:1", "id", "1", "postId", "1", "content", "Indexed comment", "parentId", "", "deleted", "0",
+		"createdAt", formatTime(createdAt), "updatedAt", formatTime(createdAt))
+	s.HSet("comment:2", "id", "2", "postId", "1", "content", entity.DeletedCommentContent, "parentId", "", "deleted", "1",
+		"createdAt", formatTime(createdAt), "updatedAt", formatTime(createdAt))
+	s.SAdd("search_terms:COMMENT:stale", "1")
+
+	assert.NoError(t, repo.Reindex())
+
+	hits, _, err := repo.Search(database.SearchQuery{Text: "redis", Type: database.SearchPosts, First: 10})
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+	hits, _, err = repo.Search(database.SearchQuery{Text: "comment", Type: database.SearchComments, First: 10})
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+
+	terms, err := s.SMembers("search_doc:COMMENT:1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"comment", "indexed"}, terms)
+	assert.False(t, s.Exists("search_doc:COMMENT:2"), "deleted comments are not indexed")
+	assert.False(t, s.Exists("search_terms:COMMENT:stale"))
+}
+
+func TestRepo_CheckSchemaVersion(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+	repo.keys = newKeyspace("wall")
+
+	assert.NoError(t, repo.checkSchemaVersion())
+	version, err := s.Get("wall:schema_version")
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%d", schemaVersion), version)
+
+	s.Set("wall:schema_version", "0")
+	assert.ErrorIs(t, repo.checkSchemaVersion(), ErrSchemaVersion)
+
+	s.Del("wall:schema_version")
+	s.HSet("wall:post:1", "id", "1", "title", "Post 1", "content", "Content 1",
+		"moderationMode", "open", "createdAt", time.Now().Format(time.RFC3339),
+		"updatedAt", time.Now().Format(time.RFC3339))
+	assert.ErrorIs(t, repo.checkSchemaVersion(), ErrSchemaVersion)
+
+	assert.NoError(t, repo.Reindex())
+	assert.NoError(t, repo.checkSchemaVersion())
+
+	posts, err := repo.GetPosts(database.PostSortOldest)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+}
+
+func TestRepo_Reset(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+	repo.keys = newKeyspace("first")
+	other := &Repo{db: repo.db, keys: newKeyspace("second")}
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	assert.NoError(t, err)
+	_, err = other.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.Reset())
+
+	posts, err := repo.GetPosts(database.PostSortOldest)
+	assert.NoError(t, err)
+	assert.Empty(t, posts)
+	assert.NoError(t, repo.checkSchemaVersion())
+
+	posts, err = other.GetPosts(database.PostSortOldest)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+}
+
+func TestRepo_CreateCommentConcurrentReplies(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	assert.NoError(t, err)
+
+	parentID := "parent"
+	_, err = repo.CreateComment(&entity.Comment{ID: parentID, PostID: "1", Content: "Content parent"})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.CreateComment(&entity.Comment{ID: fmt.Sprintf("%d", i), PostID: "1", ParentID: &parentID, Content: "Content reply"})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	replies, err := s.ZMembers("comment_replies:parent")
+	assert.NoError(t, err)
+	assert.Len(t, replies, 20)
+
+	comments, err := repo.GetCommentsForPost("1")
+	assert.NoError(t, err)
+	assert.Len(t, comments, 21)
+}
+
+func TestRepo_Migrate(t *testing.T) {
+	repo, s := setupTestDB()
+	defer s.Close()
+	repo.keys = newKeyspace("wall")
+
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	s.Set("wall:schema_version", "1")
+	s.HSet("wall:post:1", "id", "1", "title", "Post 1", "content", "Content 1",
+		"commentsActive", "1", "createdAt", createdAt.Format(time.RFC3339), "updatedAt", createdAt.Format(time.RFC3339))
+	s.HSet("wall:post:2", "id", "2", "title", "Post 2", "content", "Content 2",
+		"commentsActive", "0", "createdAt", createdAt.Format(time.RFC3339), "updatedAt", createdAt.Format(time.RFC3339))
+	s.HSet("wall:comment:1", "id", "1", "postId", "1", "content", "Content comment 1", "parentId", "",
+		"createdAt", createdAt.Format(time.RFC3339), "updatedAt", createdAt.Format(time.RFC3339), "editedAt", "")
+	s.ZAdd("wall:posts", float64(createdAt.Unix()), "1")
+	s.ZAdd("wall:posts", float64(createdAt.Unix()), "2")
+	s.ZAdd("wall:post_comments:1", float64(createdAt.Unix()), "1")
+	s.HSet("wall:comment:2", "id", "2", "postId", "1", "content", "Content comment 2", "parentId", "", "status", "pending",
+		"createdAt", createdAt.Format(time.RFC3339), "updatedAt", createdAt.Format(time.RFC3339), "editedAt", "")
+	s.ZAdd("wall:pending_comments", float64(createdAt.Unix()), "2")
+	assert.ErrorIs(t, repo.checkSchemaVersion(), ErrSchemaVersion)
+
+	assert.NoError(t, repo.Migrate())
+	assert.NoError(t, repo.checkSchemaVersion())
+
+	assert.Equal(t, "2024-05-01T09:00:00Z", s.HGet("wall:post:1", "createdAt"))
+	assert.Equal(t, "", s.HGet("wall:comment:1", "editedAt"))
+	postScore, err := s.ZScore("wall:posts", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(createdAt.UnixMicro()), postScore)
+
+	for id, mode := range map[string]entity.ModerationMode{"1": entity.ModerationOpen, "2": entity.ModerationClosed} {
+		post, err := repo.GetPostById(id)
+		assert.NoError(t, err)
+		assert.Equal(t, mode, post.ModerationMode, id)
+		assert.Empty(t, s.HGet("wall:post:"+id, "commentsActive"), id)
+	}
+
+	comment, err := repo.GetCommentById("1")
+	assert.NoError(t, err)
+	assert.True(t, createdAt.Equal(comment.CreatedAt))
+	assert.Equal(t, entity.CommentPublished, comment.Status, "comments written before premoderation are published")
+	pending, err := s.ZMembers("wall:pending_comments:1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, pending, "pending comments are indexed per post")
+	ranked, err := s.ZMembers("wall:post_comment_ranks:BEST:1")
+	assert.NoError(t, err)
+	assert.Len(t, ranked, 2, "every comment of the post is ranked")
+
+	assert.NoError(t, repo.Migrate(), "migrating a current namespace is a no-op")
+}
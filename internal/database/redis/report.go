@@ -0,0 +1,210 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/go-redis/redis"
+)
+
+func (rp *Repo) CreateReport(report *entity.Report) (bool, error) {
+	report.Status = entity.ReportOpen
+	keys := []string{
+		rp.keys.comment(report.CommentID),
+		rp.keys.report(report.ID),
+		rp.keys.commentReports(report.CommentID),
+		rp.keys.openReports(report.CommentID),
+		rp.keys.moderationQueue(),
+	}
+	args := []interface{}{report.UserID, report.ID, report.CommentID}
+	for field, value := range reportToMap(report) {
+		args = append(args, field, value)
+	}
+
+	code, err := createReportScript.Run(rp.db, keys, args...).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to create report in Redis: %w", err)
+	}
+
+	switch code {
+	case createReportCommentNotFound:
+		return false, fmt.Errorf("%w: %s", database.ErrCommentNotFound, report.CommentID)
+	case createReportExists:
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+// GetModerationQueue reads the whole queue and sorts it in Go. Only the comments
+// waiting for a moderator are in it, so it stays small.
+func (rp *Repo) GetModerationQueue(limit int, offset int) ([]*database.ModerationItem, error) {
+	commentIDs, err := rp.db.SMembers(rp.keys.moderationQueue()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation queue from Redis: %w", err)
+	}
+
+	comments, err := rp.loadComments(commentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(comments))
+	for i, comment := range comments {
+		cmds[i] = pipe.HVals(rp.keys.openReports(comment.ID))
+	}
+	if len(comments) > 0 {
+		if _, err := pipe.Exec(); err != nil {
+			return nil, fmt.Errorf("failed to get open reports from Redis: %w", err)
+		}
+	}
+
+	items := make([]*database.ModerationItem, 0, len(comments))
+	for i, comment := range comments {
+		reports, err := rp.loadReports(cmds[i].Val())
+		if err != nil {
+			return nil, err
+		}
+		if len(reports) > 0 {
+			items = append(items, &database.ModerationItem{Comment: comment, Reports: reports})
+		}
+	}
+
+	database.SortModerationQueue(items)
+	if offset >= len(items) {
+		return []*database.ModerationItem{}, nil
+	}
+	return items[offset:min(len(items), offset+limit)], nil
+}
+
+func (rp *Repo) ModerateComment(id string, hidden bool, status entity.ReportStatus) (*entity.Comment, error) {
+	flag := "0"
+	if hidden {
+		flag = "1"
+	}
+
+	keys := []string{rp.keys.comment(id), rp.keys.openReports(id), rp.keys.moderationQueue(), rp.keys.pendingComments()}
+	moderated, err := moderateCommentScript.Run(rp.db, keys, flag, string(status), rp.keys.report(""), id, rp.keys.postPendingComments("")).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate comment in Redis: %w", err)
+	}
+	if moderated == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, id)
+	}
+
+	return rp.GetCommentById(id)
+}
+
+func (rp *Repo) GetPendingComments(limit int, offset int) ([]*entity.Comment, error) {
+	if limit <= 0 {
+		return []*entity.Comment{}, nil
+	}
+
+	// A negative index counts from the end of a sorted set, so it is not passed on.
+	start := int64(max(offset, 0))
+	ids, err := rp.db.ZRange(rp.keys.pendingComments(), start, start+int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending comments from Redis: %w", err)
+	}
+
+	return rp.loadComments(ids)
+}
+
+func (rp *Repo) DismissReport(id string) (*entity.Report, error) {
+	reports, err := rp.loadReports([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrReportNotFound, id)
+	}
+	report := reports[0]
+
+	keys := []string{rp.keys.report(id), rp.keys.openReports(report.CommentID), rp.keys.moderationQueue()}
+	dismissed, err := dismissReportScript.Run(rp.db, keys,
+		report.UserID, report.CommentID, string(entity.ReportOpen), string(entity.ReportDismissed)).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dismiss report in Redis: %w", err)
+	}
+	if dismissed == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrReportNotFound, id)
+	}
+
+	report.Status = entity.ReportDismissed
+	return report, nil
+}
+
+// deleteReports queues dropping every report on the comments and taking them out
+// of the moderation queue. The report IDs are read right away, outside of pipe.
+func (rp *Repo) deleteReports(pipe redis.Pipeliner, commentIDs ...string) error {
+	read := rp.db.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(commentIDs))
+	for i, commentID := range commentIDs {
+		cmds[i] = read.SMembers(rp.keys.commentReports(commentID))
+	}
+	if len(commentIDs) > 0 {
+		if _, err := read.Exec(); err != nil {
+			return fmt.Errorf("failed to get reports from Redis: %w", err)
+		}
+	}
+
+	for i, cmd := range cmds {
+		for _, reportID := range cmd.Val() {
+			pipe.Del(rp.keys.report(reportID))
+		}
+		pipe.Del(rp.keys.commentReports(commentIDs[i]), rp.keys.openReports(commentIDs[i]))
+		pipe.SRem(rp.keys.moderationQueue(), commentIDs[i])
+	}
+	return nil
+}
+
+// loadReports reads the reports in one pipeline, skipping the ones that are gone.
+// They come back in no particular order.
+func (rp *Repo) loadReports(ids []string) ([]*entity.Report, error) {
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(rp.keys.report(id))
+	}
+	if len(ids) > 0 {
+		if _, err := pipe.Exec(); err != nil {
+			return nil, fmt.Errorf("failed to get reports from Redis: %w", err)
+		}
+	}
+
+	reports := make([]*entity.Report, 0, len(ids))
+	for _, cmd := range cmds {
+		data := cmd.Val()
+		if len(data) == 0 {
+			continue
+		}
+		createdAt, err := parseTime(data["createdAt"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse createdAt: %w", err)
+		}
+		reports = append(reports, &entity.Report{
+			ID:        data["id"],
+			PostID:    data["postId"],
+			CommentID: data["commentId"],
+			UserID:    data["userId"],
+			Reason:    data["reason"],
+			Status:    entity.ReportStatus(data["status"]),
+			CreatedAt: createdAt,
+		})
+	}
+	return reports, nil
+}
+
+func reportToMap(report *entity.Report) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        report.ID,
+		"postId":    report.PostID,
+		"commentId": report.CommentID,
+		"userId":    report.UserID,
+		"reason":    report.Reason,
+		"status":    string(report.Status),
+		"createdAt": formatTime(report.CreatedAt),
+	}
+}
@@ -0,0 +1,257 @@
+package redis
+
+import (
+	"github.com/go-redis/redis"
+)
+
+const (
+	createCommentOK = iota
+	createCommentPostNotFound
+	createCommentNotActive
+	createCommentParentNotFound
+	createCommentParentOnOtherPost
+	createCommentPending
+)
+
+// createCommentScript checks the post and the parent comment and writes the comment
+// hash together with every index entry in one atomic step, so a crash or a concurrent
+// write can never leave a half-linked comment behind. The comment is published
+// unless the post is premoderated or the comment is held, in which case it waits
+// in the pending comments.
+//
+// KEYS: post, comment, post comments index, HOT ranks, BEST ranks of the siblings,
+// pending comments, pending comments of the post, HOT ranks, BEST ranks of the post,
+// [parent comment, parent replies index]
+// ARGV: score, comment ID, post ID, HOT rank, BEST rank, rank member, held ("1" or "0"),
+// hash field/value pairs...
+// It returns one of the createComment* codes above.
+var createCommentScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 1
+end
+local mode = redis.call('HGET', KEYS[1], 'moderationMode')
+if mode == 'closed' then
+	return 2
+end
+if KEYS[10] then
+	local parentPostID = redis.call('HGET', KEYS[10], 'postId')
+	if not parentPostID then
+		return 3
+	end
+	if parentPostID ~= ARGV[3] then
+		return 4
+	end
+end
+
+redis.call('HSET', KEYS[2], unpack(ARGV, 8))
+redis.call('ZADD', KEYS[3], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[4], ARGV[4], ARGV[6])
+redis.call('ZADD', KEYS[5], ARGV[5], ARGV[6])
+redis.call('ZADD', KEYS[8], ARGV[4], ARGV[6])
+redis.call('ZADD', KEYS[9], ARGV[5], ARGV[6])
+if KEYS[11] then
+	redis.call('ZADD', KEYS[11], ARGV[1], ARGV[2])
+end
+if mode == 'premoderated' or ARGV[7] == '1' then
+	redis.call('HSET', KEYS[2], 'status', 'pending')
+	redis.call('ZADD', KEYS[6], ARGV[1], ARGV[2])
+	redis.call('ZADD', KEYS[7], ARGV[1], ARGV[2])
+	return 5
+end
+redis.call('HSET', KEYS[2], 'status', 'published')
+return 0
+`)
+
+const (
+	voteCommentOK = iota
+	voteCommentNotFound
+)
+
+// voteCommentScript replaces the vote of a user and moves the counters on the
+// comment and post hashes by the difference in one atomic step, so concurrent
+// votes can never leave the counters out of step with the votes hash.
+//
+// KEYS: comment, comment votes, post
+// ARGV: user ID, vote (-1, 0 or 1)
+// It returns one of the voteComment* codes above.
+var voteCommentScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 1
+end
+
+local previous = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '0')
+local value = tonumber(ARGV[2])
+if value == 0 then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+else
+	redis.call('HSET', KEYS[2], ARGV[1], value)
+end
+
+local function counted(vote, side)
+	if vote == side then
+		return 1
+	end
+	return 0
+end
+local up = counted(value, 1) - counted(previous, 1)
+local down = counted(value, -1) - counted(previous, -1)
+redis.call('HINCRBY', KEYS[1], 'upvotes', up)
+redis.call('HINCRBY', KEYS[1], 'downvotes', down)
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	redis.call('HINCRBY', KEYS[3], 'upvotes', up)
+	redis.call('HINCRBY', KEYS[3], 'downvotes', down)
+end
+return 0
+`)
+
+// setRanksScript stores ranks computed from the given counters, unless the counters
+// have changed since they were read. Whoever changed them stores newer ranks in
+// turn, so the ranks always end up matching the latest counters.
+//
+// KEYS: post or comment, then pairs of HOT ranks and BEST ranks indexes
+// ARGV: upvotes, downvotes, HOT rank, BEST rank, rank member
+// It returns 1 when the ranks were stored and 0 when they were stale.
+var setRanksScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local counters = redis.call('HMGET', KEYS[1], 'upvotes', 'downvotes')
+if tonumber(counters[1] or '0') ~= tonumber(ARGV[1]) or tonumber(counters[2] or '0') ~= tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('HSET', KEYS[1], 'hotRank', ARGV[3], 'bestRank', ARGV[4])
+for i = 2, #KEYS, 2 do
+	redis.call('ZADD', KEYS[i], ARGV[3], ARGV[5])
+	redis.call('ZADD', KEYS[i + 1], ARGV[4], ARGV[5])
+end
+return 1
+`)
+
+const (
+	addReactionAdded = iota
+	addReactionTargetNotFound
+	addReactionExists
+)
+
+// addReactionScript adds a user's emoji to a post or comment and counts it, unless the
+// target is gone or the user already reacted with that emoji.
+//
+// KEYS: post or comment, reaction counts, reaction users
+// ARGV: emoji, "<user ID>:<emoji>", post ID of the comment (empty for a post)
+// It returns one of the addReaction* codes above.
+var addReactionScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 1
+end
+if ARGV[3] ~= '' and redis.call('HGET', KEYS[1], 'postId') ~= ARGV[3] then
+	return 1
+end
+if redis.call('SADD', KEYS[3], ARGV[2]) == 0 then
+	return 2
+end
+redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+return 0
+`)
+
+// removeReactionScript takes a user's emoji back and drops the count once nobody is left.
+//
+// KEYS: reaction counts, reaction users
+// ARGV: emoji, "<user ID>:<emoji>"
+// It returns 1 when the reaction was removed and 0 when there was none.
+var removeReactionScript = redis.NewScript(`
+if redis.call('SREM', KEYS[2], ARGV[2]) == 0 then
+	return 0
+end
+if redis.call('HINCRBY', KEYS[1], ARGV[1], -1) <= 0 then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+const (
+	createReportCreated = iota
+	createReportCommentNotFound
+	createReportExists
+)
+
+// createReportScript stores a report and puts its comment in the moderation queue,
+// unless the comment is gone or the user already has an open report on it.
+//
+// KEYS: comment, report, comment reports, open reports, moderation queue
+// ARGV: user ID, report ID, comment ID, hash field/value pairs...
+// It returns one of the createReport* codes above.
+var createReportScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 1
+end
+if redis.call('HSETNX', KEYS[4], ARGV[1], ARGV[2]) == 0 then
+	return 2
+end
+redis.call('HSET', KEYS[2], unpack(ARGV, 4))
+redis.call('SADD', KEYS[3], ARGV[2])
+redis.call('SADD', KEYS[5], ARGV[3])
+return 0
+`)
+
+// moderateCommentScript sets the hidden flag of a comment, closes its open reports
+// and takes it out of the moderation queue in one atomic step. The report keys are
+// only known once the open reports are read, so they are built from their prefix,
+// like the pending comments of the post. Showing the comment also publishes it if
+// it was pending.
+//
+// KEYS: comment, open reports, moderation queue, pending comments
+// ARGV: hidden ("1" or "0"), report status, report key prefix, comment ID,
+// post pending comments key prefix
+// It returns 1 when the comment was moderated and 0 when it is gone.
+var moderateCommentScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'hidden', ARGV[1])
+if ARGV[1] == '0' then
+	redis.call('HSET', KEYS[1], 'status', 'published')
+	redis.call('ZREM', KEYS[4], ARGV[4])
+	redis.call('ZREM', ARGV[5] .. redis.call('HGET', KEYS[1], 'postId'), ARGV[4])
+end
+for _, id in ipairs(redis.call('HVALS', KEYS[2])) do
+	redis.call('HSET', ARGV[3] .. id, 'status', ARGV[2])
+end
+redis.call('DEL', KEYS[2])
+redis.call('SREM', KEYS[3], ARGV[4])
+return 1
+`)
+
+// dismissReportScript closes an open report and takes its comment out of the
+// moderation queue once no open report is left on it.
+//
+// KEYS: report, open reports, moderation queue
+// ARGV: user ID, comment ID, open status, dismissed status
+// It returns 1 when the report was dismissed and 0 when it was not open.
+var dismissReportScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'status') ~= ARGV[3] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'status', ARGV[4])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if redis.call('HLEN', KEYS[2]) == 0 then
+	redis.call('SREM', KEYS[3], ARGV[2])
+end
+return 1
+`)
+
+// trainSpamFilterScript adds one to the count of every token unless the comment
+// was already trained with the same verdict.
+//
+// KEYS: spam trainings, spam tokens
+// ARGV: comment ID, tokens...
+// It returns 1 when the counts changed and 0 when the comment was trained before.
+var trainSpamFilterScript = redis.NewScript(`
+if redis.call('SADD', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+for i = 2, #ARGV do
+	redis.call('HINCRBY', KEYS[2], ARGV[i], 1)
+end
+return 1
+`)
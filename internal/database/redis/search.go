@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/search"
+	"github.com/go-redis/redis"
+)
+
+// Search intersects the word index to find the candidates, then ranks and
+// highlights them in Go. A candidate is checked against its current text again,
+// so an index entry left behind by concurrent edits never yields a wrong hit.
+func (rp *Repo) Search(query database.SearchQuery) ([]*database.SearchHit, bool, error) {
+	terms := search.Terms(query.Text)
+	if len(terms) == 0 {
+		return nil, false, nil
+	}
+
+	keys := make([]string, len(terms))
+	for i, term := range terms {
+		keys[i] = rp.keys.searchTerms(query.Type, term)
+	}
+	ids, err := rp.db.SInter(keys...).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read search index from Redis: %w", err)
+	}
+
+	var hits []*database.SearchHit
+	if query.Type == database.SearchPosts {
+		posts, err := rp.loadPosts(ids)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, post := range posts {
+			if hit, ok := database.MatchPost(terms, post); ok {
+				hits = append(hits, hit)
+			}
+		}
+	} else {
+		comments, err := rp.loadComments(ids)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, comment := range comments {
+			if hit, ok := database.MatchComment(terms, comment); ok {
+				hits = append(hits, hit)
+			}
+		}
+	}
+
+	page, hasNext := database.PageHits(terms, hits, query.First, query.After)
+	return page, hasNext, nil
+}
+
+func postText(post *entity.Post) string {
+	return post.Title + "\n" + post.Content
+}
+
+// indexText queues adding the words of text to the index under the item's ID.
+func (rp *Repo) indexText(pipe redis.Pipeliner, kind database.SearchType, id string, text string) {
+	terms := search.Terms(text)
+	if len(terms) == 0 {
+		return
+	}
+
+	members := make([]interface{}, len(terms))
+	for i, term := range terms {
+		pipe.SAdd(rp.keys.searchTerms(kind, term), id)
+		members[i] = term
+	}
+	pipe.SAdd(rp.keys.searchDoc(kind, id), members...)
+}
+
+// unindex queues removing the items from the index. The words each of them was
+// indexed under are read right away, outside of pipe.
+func (rp *Repo) unindex(pipe redis.Pipeliner, kind database.SearchType, ids ...string) error {
+	read := rp.db.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = read.SMembers(rp.keys.searchDoc(kind, id))
+	}
+	if len(ids) > 0 {
+		if _, err := read.Exec(); err != nil {
+			return fmt.Errorf("failed to read search index from Redis: %w", err)
+		}
+	}
+
+	for i, cmd := range cmds {
+		for _, term := range cmd.Val() {
+			pipe.SRem(rp.keys.searchTerms(kind, term), ids[i])
+		}
+		pipe.Del(rp.keys.searchDoc(kind, ids[i]))
+	}
+	return nil
+}
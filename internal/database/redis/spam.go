@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+func (rp *Repo) TrainSpamFilter(commentID string, tokens []string, spam bool) (bool, error) {
+	args := make([]interface{}, 0, len(tokens)+1)
+	args = append(args, commentID)
+	for _, token := range tokens {
+		args = append(args, token)
+	}
+
+	keys := []string{rp.keys.spamTrainings(spam), rp.keys.spamTokens(spam)}
+	trained, err := trainSpamFilterScript.Run(rp.db, keys, args...).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to train spam filter in Redis: %w", err)
+	}
+	return trained == 1, nil
+}
+
+func (rp *Repo) GetSpamTokens(tokens []string) (map[string]*entity.SpamToken, error) {
+	result := make(map[string]*entity.SpamToken, len(tokens))
+	if len(tokens) == 0 {
+		return result, nil
+	}
+
+	pipe := rp.db.Pipeline()
+	spamCmd := pipe.HMGet(rp.keys.spamTokens(true), tokens...)
+	hamCmd := pipe.HMGet(rp.keys.spamTokens(false), tokens...)
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to get spam tokens from Redis: %w", err)
+	}
+
+	spamCounts, hamCounts := spamCmd.Val(), hamCmd.Val()
+	for i, token := range tokens {
+		spamCount, _ := spamCounts[i].(string)
+		hamCount, _ := hamCounts[i].(string)
+		if spamCount == "" && hamCount == "" {
+			continue
+		}
+
+		counts := &entity.SpamToken{Token: token}
+		var err error
+		if counts.Spam, err = parseNumber[int](spamCount); err != nil {
+			return nil, fmt.Errorf("failed to parse spam count: %w", err)
+		}
+		if counts.Ham, err = parseNumber[int](hamCount); err != nil {
+			return nil, fmt.Errorf("failed to parse ham count: %w", err)
+		}
+		result[token] = counts
+	}
+	return result, nil
+}
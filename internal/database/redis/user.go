@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/go-redis/redis"
+)
+
+// CreateUser claims the name with HSETNX first, so two registrations of the
+// same name can never both succeed.
+func (rp *Repo) CreateUser(user *entity.User) (*entity.User, error) {
+	claimed, err := rp.db.HSetNX(rp.keys.userNames(), user.Name, user.ID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve user name in Redis: %w", err)
+	}
+	if !claimed {
+		return nil, fmt.Errorf("%w: %s", database.ErrUserExists, user.Name)
+	}
+
+	if err := rp.db.HMSet(rp.keys.user(user.ID), userToMap(user)).Err(); err != nil {
+		rp.db.HDel(rp.keys.userNames(), user.Name)
+		return nil, fmt.Errorf("failed to create user in Redis: %w", err)
+	}
+
+	return user, nil
+}
+
+func (rp *Repo) GetUserByName(name string) (*entity.User, error) {
+	id, err := rp.db.HGet(rp.keys.userNames(), name).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: %s", database.ErrUserNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user from Redis: %w", err)
+	}
+
+	users, err := rp.GetUsers([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrUserNotFound, name)
+	}
+	return users[0], nil
+}
+
+// GetUsers fetches user hashes in one pipeline, skipping IDs whose hash does not exist.
+func (rp *Repo) GetUsers(ids []string) ([]*entity.User, error) {
+	users := make([]*entity.User, 0, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(rp.keys.user(id))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, fmt.Errorf("failed to get users from Redis: %w", err)
+	}
+
+	for _, cmd := range cmds {
+		data := cmd.Val()
+		if len(data) == 0 {
+			continue
+		}
+		user, err := mapToUser(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// SetUserRole only writes the role field, so it is safe to run while the user logs in.
+func (rp *Repo) SetUserRole(id string, role entity.Role) (*entity.User, error) {
+	exists, err := rp.db.Exists(rp.keys.user(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user from Redis: %w", err)
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrUserNotFound, id)
+	}
+
+	if err := rp.db.HSet(rp.keys.user(id), "role", string(role)).Err(); err != nil {
+		return nil, fmt.Errorf("failed to update user in Redis: %w", err)
+	}
+
+	users, err := rp.GetUsers([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrUserNotFound, id)
+	}
+	return users[0], nil
+}
+
+func userToMap(user *entity.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           user.ID,
+		"name":         user.Name,
+		"passwordHash": user.PasswordHash,
+		"role":         string(user.Role),
+		"createdAt":    formatTime(user.CreatedAt),
+	}
+}
+
+func mapToUser(data map[string]string) (*entity.User, error) {
+	createdAt, err := parseTime(data["createdAt"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse createdAt: %w", err)
+	}
+
+	return &entity.User{
+		ID:           data["id"],
+		Name:         data["name"],
+		PasswordHash: data["passwordHash"],
+		Role:         entity.Role(data["role"]),
+		CreatedAt:    createdAt,
+	}, nil
+}
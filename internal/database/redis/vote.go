@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/ranking"
+	"github.com/go-redis/redis"
+)
+
+func (rp *Repo) VoteComment(commentID string, userID string, value entity.Vote) (*entity.Comment, error) {
+	comment, err := rp.GetCommentById(commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{rp.keys.comment(commentID), rp.keys.votes(commentID), rp.keys.post(comment.PostID)}
+	code, err := voteCommentScript.Run(rp.db, keys, userID, int(value)).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to vote on comment in Redis: %w", err)
+	}
+	if code == voteCommentNotFound {
+		return nil, fmt.Errorf("%w: %s", database.ErrCommentNotFound, commentID)
+	}
+
+	parentID := ""
+	if comment.ParentID != nil {
+		parentID = *comment.ParentID
+	}
+	err = rp.rerank(keys[0], comment.CreatedAt, comment.ID,
+		rp.keys.commentRanks(database.CommentSortHot, comment.PostID, parentID),
+		rp.keys.commentRanks(database.CommentSortBest, comment.PostID, parentID),
+		rp.keys.postCommentRanks(database.CommentSortHot, comment.PostID),
+		rp.keys.postCommentRanks(database.CommentSortBest, comment.PostID))
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := rp.GetPostById(comment.PostID)
+	if errors.Is(err, database.ErrPostNotFound) {
+		return rp.GetCommentById(commentID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = rp.rerank(keys[2], post.CreatedAt, post.ID,
+		rp.keys.postRanks(database.PostSortHot), rp.keys.postRanks(database.PostSortBest))
+	if err != nil {
+		return nil, err
+	}
+
+	return rp.GetCommentById(commentID)
+}
+
+// rerank recomputes the ranks of the post or comment hash at key from its current
+// counters and stores them with setRanksScript in the pairs of HOT and BEST rank
+// indexes. When the counters change in between, the script refuses the stale ranks
+// and rerank reads the counters again.
+func (rp *Repo) rerank(key string, createdAt time.Time, id string, indexes ...string) error {
+	member := rankMember(createdAt, id)
+	for {
+		values, err := rp.db.HMGet(key, "upvotes", "downvotes").Result()
+		if err != nil {
+			return fmt.Errorf("failed to read votes from Redis: %w", err)
+		}
+		up, err := parseNumber[int](fieldString(values[0]))
+		if err != nil {
+			return fmt.Errorf("failed to parse upvotes: %w", err)
+		}
+		down, err := parseNumber[int](fieldString(values[1]))
+		if err != nil {
+			return fmt.Errorf("failed to parse downvotes: %w", err)
+		}
+
+		hot, best := ranking.Hot(up, down, createdAt), ranking.Best(up, down)
+		stored, err := setRanksScript.Run(rp.db, append([]string{key}, indexes...),
+			up, down, formatRank(hot), formatRank(best), member).Int()
+		if err != nil {
+			return fmt.Errorf("failed to store ranks in Redis: %w", err)
+		}
+		if stored == 1 {
+			return nil
+		}
+		if exists, err := rp.db.Exists(key).Result(); err != nil || exists == 0 {
+			return err
+		}
+	}
+}
+
+func fieldString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// GetCommentVotes reads the vote of the user from every comment's votes hash in one pipeline.
+func (rp *Repo) GetCommentVotes(userID string, commentIDs []string) (map[string]entity.Vote, error) {
+	result := make(map[string]entity.Vote)
+	if len(commentIDs) == 0 {
+		return result, nil
+	}
+
+	pipe := rp.db.Pipeline()
+	cmds := make([]*redis.StringCmd, len(commentIDs))
+	for i, commentID := range commentIDs {
+		cmds[i] = pipe.HGet(rp.keys.votes(commentID), userID)
+	}
+	if _, err := pipe.Exec(); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get votes from Redis: %w", err)
+	}
+
+	for i, cmd := range cmds {
+		value, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get vote from Redis: %w", err)
+		}
+
+		vote, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse vote: %w", err)
+		}
+		result[commentIDs[i]] = entity.Vote(vote)
+	}
+	return result, nil
+}
@@ -5,11 +5,74 @@ import (
 )
 
 type Repo interface {
-	GetPosts() ([]*entity.Post, error)
+	GetPosts(order PostSort) ([]*entity.Post, error)
+	GetPostsAfter(first int, after *Cursor) ([]*entity.Post, bool, error)
 	CreatePost(post *entity.Post) (*entity.Post, error)
 	GetPostById(id string) (*entity.Post, error)
+	UpdatePost(post *entity.Post) (*entity.Post, error)
+	DeletePost(id string) error
+	SetPostModerationMode(id string, mode entity.ModerationMode) (*entity.Post, error)
+	// CreateComment fails with ErrCommentsNotActive when the post is closed, and
+	// stores the comment as pending when the post is premoderated or its Status
+	// already asks for it.
 	CreateComment(comment *entity.Comment) (*entity.Comment, error)
 	GetCommentById(id string) (*entity.Comment, error)
 	GetCommentsForPost(postID string) ([]*entity.Comment, error)
-	GetCommentsForPostWithLimitAndOffset(postID string, limit *int, offset *int) ([]*entity.Comment, error)
+	// GetCommentsForPostWithLimitAndOffset and GetCommentsForPostAfter leave out the
+	// comments the viewer cannot see before they page, so pages are never short.
+	GetCommentsForPostWithLimitAndOffset(postID string, limit *int, offset *int, order CommentSort, viewer Viewer) ([]*entity.Comment, error)
+	GetCommentsForPostAfter(postID string, first int, after *Cursor, viewer Viewer) ([]*entity.Comment, bool, error)
+	// GetCommentTrees returns the subtree under each of the roots, down to opts.MaxDepth levels.
+	// Every subtree is flat and ordered by level, then by opts.Order.
+	GetCommentTrees(roots []TreeRoot, opts TreeOptions) (map[TreeRoot][]*entity.Comment, error)
+	// UpdateComment writes the content and tags, and holds the comment for a
+	// moderator in the same atomic step when its Status is CommentPending.
+	UpdateComment(comment *entity.Comment) (*entity.Comment, error)
+	DeleteComment(id string) error
+	GetCommentRevisions(commentID string) ([]*entity.CommentRevision, error)
+	// VoteComment replaces the vote of the user on the comment, VoteNone taking it back,
+	// and returns the comment with its counters updated in the same atomic step.
+	VoteComment(commentID string, userID string, value entity.Vote) (*entity.Comment, error)
+	// GetCommentVotes returns the votes of the user on the given comments, skipping
+	// the comments the user has not voted on.
+	GetCommentVotes(userID string, commentIDs []string) (map[string]entity.Vote, error)
+	// AddReaction fails with ErrPostNotFound or ErrCommentNotFound when the target is gone,
+	// and returns false when the user already put the emoji on the target.
+	AddReaction(reaction *entity.Reaction) (bool, error)
+	// RemoveReaction returns false when the user had not put the emoji on the target.
+	RemoveReaction(reaction *entity.Reaction) (bool, error)
+	// GetReactions returns the emojis on each of the targets, in no particular order,
+	// marking the ones userID reacted with. Targets without reactions are left out.
+	GetReactions(userID string, targets []entity.ReactionTarget) (map[entity.ReactionTarget][]*entity.ReactionCount, error)
+	// Search returns the first items matching every word of the query, split as
+	// search.Terms does, best match first, and whether more follow.
+	Search(query SearchQuery) ([]*SearchHit, bool, error)
+	// CreateReport fails with ErrCommentNotFound when the comment is gone, and returns
+	// false when the user already has an open report on it.
+	CreateReport(report *entity.Report) (bool, error)
+	// GetModerationQueue returns the comments with open reports in the order of
+	// SortModerationQueue, skipping offset of them and returning at most limit.
+	GetModerationQueue(limit int, offset int) ([]*ModerationItem, error)
+	// ModerateComment sets whether the comment is hidden and closes all of its open
+	// reports with the status in the same atomic step. Showing a pending comment
+	// also publishes it.
+	ModerateComment(id string, hidden bool, status entity.ReportStatus) (*entity.Comment, error)
+	// GetPendingComments returns the comments waiting for a moderator, oldest first,
+	// skipping offset of them and returning at most limit.
+	GetPendingComments(limit int, offset int) ([]*entity.Comment, error)
+	// DismissReport fails with ErrReportNotFound unless the report is open.
+	DismissReport(id string) (*entity.Report, error)
+	// TrainSpamFilter adds one to the spam or ham count of every token of the comment
+	// in one atomic step, unless the comment was already trained with the same
+	// verdict. It reports whether the counts changed. The tokens must be distinct.
+	TrainSpamFilter(commentID string, tokens []string, spam bool) (bool, error)
+	// GetSpamTokens returns the counts of the tokens, skipping the ones never trained.
+	GetSpamTokens(tokens []string) (map[string]*entity.SpamToken, error)
+	// CreateUser fails with ErrUserExists when the name is already taken.
+	CreateUser(user *entity.User) (*entity.User, error)
+	GetUserByName(name string) (*entity.User, error)
+	// GetUsers returns the users with the given IDs, skipping the ones that do not exist.
+	GetUsers(ids []string) ([]*entity.User, error)
+	// SetUserRole fails with ErrUserNotFound when there is no user with the ID.
+	SetUserRole(id string, role entity.Role) (*entity.User, error)
 }
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/search"
+)
+
+// SearchType is the kind of item a search looks for.
+type SearchType string
+
+const (
+	SearchPosts    SearchType = "POST"
+	SearchComments SearchType = "COMMENT"
+)
+
+// SearchQuery asks for the first items of the type containing every word of Text,
+// best match first. Deleted, hidden and pending comments never match.
+type SearchQuery struct {
+	Text  string
+	Type  SearchType
+	First int
+	After *SearchCursor
+}
+
+// SearchHit is a post or a comment, depending on the type searched for, with
+// how well it matched and a fragment of its content with the matches highlighted.
+// Ranks are only comparable within one search.
+type SearchHit struct {
+	Post    *entity.Post
+	Comment *entity.Comment
+	Rank    float64
+	Snippet string
+}
+
+func (h *SearchHit) ID() string {
+	if h.Post != nil {
+		return h.Post.ID
+	}
+	return h.Comment.ID
+}
+
+func (h *SearchHit) Cursor() SearchCursor {
+	return SearchCursor{Rank: h.Rank, ID: h.ID()}
+}
+
+// SearchCursor is a keyset position in search results, which are ordered by rank,
+// highest first, and then by ID.
+type SearchCursor struct {
+	Rank float64
+	ID   string
+}
+
+func (c SearchCursor) Encode() string {
+	raw := strconv.FormatFloat(c.Rank, 'g', -1, 64) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeSearchCursor(encoded string) (*SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	rank, id, found := strings.Cut(string(raw), ":")
+	if !found || id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	value, err := strconv.ParseFloat(rank, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &SearchCursor{Rank: value, ID: id}, nil
+}
+
+// Precedes reports whether the hit identified by rank and id comes after the cursor.
+func (c SearchCursor) Precedes(rank float64, id string) bool {
+	if rank != c.Rank {
+		return rank < c.Rank
+	}
+	return id > c.ID
+}
+
+// MatchPost ranks the post against the terms of a query for backends that search
+// in Go, reporting false when it lacks one of them. The title counts as content.
+func MatchPost(terms []string, post *entity.Post) (*SearchHit, bool) {
+	rank, ok := search.Rank(terms, post.Title+"\n"+post.Content)
+	if !ok {
+		return nil, false
+	}
+	return &SearchHit{Post: post, Rank: rank}, true
+}
+
+// MatchComment is MatchPost for comments.
+func MatchComment(terms []string, comment *entity.Comment) (*SearchHit, bool) {
+	if comment.Deleted || comment.Hidden || comment.Status == entity.CommentPending {
+		return nil, false
+	}
+	rank, ok := search.Rank(terms, comment.Content)
+	if !ok {
+		return nil, false
+	}
+	return &SearchHit{Comment: comment, Rank: rank}, true
+}
+
+// PageHits orders the hits of a search done in Go and returns the first ones after
+// the cursor, with their snippets cut, and whether more follow.
+func PageHits(terms []string, hits []*SearchHit, first int, after *SearchCursor) ([]*SearchHit, bool) {
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Cursor().Precedes(hits[j].Rank, hits[j].ID())
+	})
+
+	page := make([]*SearchHit, 0, first)
+	for _, hit := range hits {
+		if after != nil && !after.Precedes(hit.Rank, hit.ID()) {
+			continue
+		}
+		if len(page) == first {
+			return page, true
+		}
+		if hit.Post != nil {
+			hit.Snippet = search.Snippet(terms, hit.Post.Content)
+		} else {
+			hit.Snippet = search.Snippet(terms, hit.Comment.Content)
+		}
+		page = append(page, hit)
+	}
+	return page, false
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+// PostSort orders posts. HOT and BEST sort by the precomputed ranks of the
+// same name, highest first; ties fall back to NEWEST.
+type PostSort string
+
+const (
+	PostSortOldest PostSort = "OLDEST"
+	PostSortNewest PostSort = "NEWEST"
+	PostSortHot    PostSort = "HOT"
+	PostSortBest   PostSort = "BEST"
+)
+
+// ByRank reports whether the order is by a precomputed rank.
+func (s PostSort) ByRank() bool {
+	return s == PostSortHot || s == PostSortBest
+}
+
+// Rank returns the rank of the post the order sorts by. Only meaningful when ByRank.
+func (s PostSort) Rank(post *entity.Post) float64 {
+	if s == PostSortHot {
+		return post.HotRank
+	}
+	return post.BestRank
+}
+
+// CommentSort orders comments among their siblings.
+// TOP ranks by the number of direct replies only, ignoring votes, and
+// CONTROVERSIAL by Controversy; ties fall back to OLDEST.
+// HOT and BEST sort by the precomputed ranks of the same name, highest first;
+// ties fall back to NEWEST.
+type CommentSort string
+
+const (
+	CommentSortOldest        CommentSort = "OLDEST"
+	CommentSortNewest        CommentSort = "NEWEST"
+	CommentSortTop           CommentSort = "TOP"
+	CommentSortControversial CommentSort = "CONTROVERSIAL"
+	CommentSortHot           CommentSort = "HOT"
+	CommentSortBest          CommentSort = "BEST"
+)
+
+// ByReplies reports whether the order depends on reply counts.
+func (s CommentSort) ByReplies() bool {
+	return s == CommentSortTop || s == CommentSortControversial
+}
+
+// ByRank reports whether the order is by a precomputed rank.
+func (s CommentSort) ByRank() bool {
+	return s == CommentSortHot || s == CommentSortBest
+}
+
+// Controversy scores how divisive a comment is: its votes and direct replies,
+// weighted by how evenly the votes are split. A comment without both upvotes and
+// downvotes scores 0. The single division keeps equal scores equal in every backend.
+func Controversy(comment *entity.Comment, replies int) float64 {
+	low, high := min(comment.Upvotes, comment.Downvotes), max(comment.Upvotes, comment.Downvotes)
+	if low == 0 {
+		return 0
+	}
+	return float64((comment.Upvotes+comment.Downvotes+replies)*low) / float64(high)
+}
+
+// replyScore is what an order by replies ranks the comment by, highest first.
+func (s CommentSort) replyScore(comment *entity.Comment, replies int) float64 {
+	if s == CommentSortControversial {
+		return Controversy(comment, replies)
+	}
+	return float64(replies)
+}
+
+// Rank returns the rank of the comment the order sorts by. Only meaningful when ByRank.
+func (s CommentSort) Rank(comment *entity.Comment) float64 {
+	if s == CommentSortHot {
+		return comment.HotRank
+	}
+	return comment.BestRank
+}
+
+// SortPosts orders posts in place for backends that cannot sort natively.
+func SortPosts(posts []*entity.Post, order PostSort) {
+	sort.Slice(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		if order.ByRank() && order.Rank(a) != order.Rank(b) {
+			return order.Rank(a) > order.Rank(b)
+		}
+		if order == PostSortNewest || order.ByRank() {
+			a, b = b, a
+		}
+		return Cursor{CreatedAt: a.CreatedAt, ID: a.ID}.Precedes(b.CreatedAt, b.ID)
+	})
+}
+
+// SortComments orders comments in place for backends that cannot sort natively.
+// replies holds the number of direct replies per comment ID and is only read
+// when the order depends on it.
+func SortComments(comments []*entity.Comment, order CommentSort, replies map[string]int) {
+	sort.Slice(comments, func(i, j int) bool {
+		a, b := comments[i], comments[j]
+		if order.ByReplies() {
+			if x, y := order.replyScore(a, replies[a.ID]), order.replyScore(b, replies[b.ID]); x != y {
+				return x > y
+			}
+		}
+		if order.ByRank() && order.Rank(a) != order.Rank(b) {
+			return order.Rank(a) > order.Rank(b)
+		}
+		if order == CommentSortNewest || order.ByRank() {
+			a, b = b, a
+		}
+		return Cursor{CreatedAt: a.CreatedAt, ID: a.ID}.Precedes(b.CreatedAt, b.ID)
+	})
+}
@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/apartapatia/wall_of_comments/internal/database/pq"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var ErrSQLiteConnect = errors.New("sqlite connection error")
+
+// Repo stores the wall in a single SQLite file. It shares its queries and
+// migrations with the Postgres repo, so both backends behave the same.
+type Repo struct {
+	pq.Repo
+	db *gorm.DB
+}
+
+func GetRepo(cfg config.SQLiteConfig) (*Repo, error) {
+	db, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pq.Migrate(db); err != nil {
+		return nil, err
+	}
+
+	return &Repo{Repo: pq.NewRepo(db), db: db}, nil
+}
+
+// newClient opens the database in WAL mode, so readers are not blocked by a writer.
+// Write transactions take the lock up front and wait for it instead of failing
+// with "database is locked" when they overlap.
+func newClient(cfg config.SQLiteConfig) (*gorm.DB, error) {
+	logrus.Infof("opening sqlite database %s", cfg.Path)
+
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate&_foreign_keys=on", cfg.Path)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		logrus.Errorf("%s: %v", ErrSQLiteConnect.Error(), err)
+		return nil, ErrSQLiteConnect
+	}
+
+	return db, nil
+}
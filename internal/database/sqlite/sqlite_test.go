@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/database/databasetest"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestRepo(t *testing.T, path string) *Repo {
+	repo, err := GetRepo(config.SQLiteConfig{Path: path})
+	require.NoError(t, err)
+
+	db, err := repo.db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return repo
+}
+
+func TestRepo_Conformance(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Repo {
+		return setupTestRepo(t, filepath.Join(t.TempDir(), "wall.db"))
+	})
+}
+
+func TestGetRepo_WALMode(t *testing.T) {
+	repo := setupTestRepo(t, filepath.Join(t.TempDir(), "wall.db"))
+
+	var mode string
+	require.NoError(t, repo.db.Raw("PRAGMA journal_mode").Scan(&mode).Error)
+	assert.Equal(t, "wal", mode)
+}
+
+func TestGetRepo_KeepsData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wall.db")
+
+	repo := setupTestRepo(t, path)
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1"})
+	require.NoError(t, err)
+
+	reopened := setupTestRepo(t, path)
+	post, err := reopened.GetPostById("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Post 1", post.Title)
+}
+
+func TestGetRepo_IndexesExistingPosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wall.db")
+
+	// Databases created before search existed have neither the FTS table nor the triggers.
+	repo := setupTestRepo(t, path)
+	for _, statement := range []string{"DROP TABLE post_search", "DROP TRIGGER post_search_ai"} {
+		require.NoError(t, repo.db.Exec(statement).Error)
+	}
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Written before search"})
+	require.NoError(t, err)
+
+	reopened := setupTestRepo(t, path)
+	hits, _, err := reopened.Search(database.SearchQuery{Text: "search", Type: database.SearchPosts, First: 10})
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+}
@@ -0,0 +1,12 @@
+package database
+
+import "time"
+
+// TimePrecision is the finest precision every backend stores; PostgreSQL keeps microseconds.
+const TimePrecision = time.Microsecond
+
+// Now returns the current time truncated to TimePrecision, so a timestamp reads
+// back from any backend exactly as it was written and orders the same way.
+func Now() time.Time {
+	return time.Now().Truncate(TimePrecision)
+}
@@ -0,0 +1,20 @@
+package database
+
+// TreeRoot identifies where a comment subtree starts: the root comments of
+// the post when ParentID is empty, otherwise the replies to that comment.
+type TreeRoot struct {
+	PostID   string
+	ParentID string
+}
+
+// TreeOptions limits the size of a comment subtree.
+type TreeOptions struct {
+	// First is the number of comments kept per parent on every level.
+	First int
+	// Offset is the number of comments skipped on the first level.
+	Offset   int
+	MaxDepth int
+	Order    CommentSort
+	// Viewer decides which pending comments are part of the subtree.
+	Viewer Viewer
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+// VoteDelta is how the upvote and downvote counters of a comment change when
+// a user's vote goes from previous to next.
+func VoteDelta(previous entity.Vote, next entity.Vote) (up int, down int) {
+	return votes(next, entity.VoteUp) - votes(previous, entity.VoteUp),
+		votes(next, entity.VoteDown) - votes(previous, entity.VoteDown)
+}
+
+func votes(value entity.Vote, counted entity.Vote) int {
+	if value == counted {
+		return 1
+	}
+	return 0
+}
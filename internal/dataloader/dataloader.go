@@ -0,0 +1,76 @@
+package dataloader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Loader collects the keys requested within a short window and fetches them
+// with a single call. Results, errors included, are kept for the lifetime of
+// the loader, so a loader should not outlive the request it serves.
+type Loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+	wait  time.Duration
+
+	mu      sync.Mutex
+	batches map[K]*batch[K, V]
+	pending *batch[K, V]
+}
+
+type batch[K comparable, V any] struct {
+	keys   []K
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+// New returns a loader that waits for wait after the first key of a batch
+// before calling fetch. Keys missing from the fetched map load the zero value.
+func New[K comparable, V any](wait time.Duration, fetch func(keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch:   fetch,
+		wait:    wait,
+		batches: make(map[K]*batch[K, V]),
+	}
+}
+
+// Load returns the value for the key, fetching it together with the other
+// keys requested in the same window.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	b, requested := l.batches[key]
+	if !requested {
+		if l.pending == nil {
+			l.pending = &batch[K, V]{done: make(chan struct{})}
+			time.AfterFunc(l.wait, l.dispatch)
+		}
+		b = l.pending
+		b.keys = append(b.keys, key)
+		l.batches[key] = b
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+
+	if b.err != nil {
+		var zero V
+		return zero, b.err
+	}
+	return b.values[key], nil
+}
+
+func (l *Loader[K, V]) dispatch() {
+	l.mu.Lock()
+	b := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	b.values, b.err = l.fetch(b.keys)
+	close(b.done)
+}
@@ -0,0 +1,67 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader_BatchesConcurrentLoads(t *testing.T) {
+	var calls atomic.Int32
+	var fetched []int
+	loader := New(10*time.Millisecond, func(keys []int) (map[int]string, error) {
+		calls.Add(1)
+		fetched = append(fetched, keys...)
+		values := make(map[int]string, len(keys))
+		for _, key := range keys {
+			values[key] = string(rune('a' + key))
+		}
+		return values, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]string, 6)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := loader.Load(context.Background(), i%3)
+			assert.NoError(t, err)
+			results[i] = value
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.ElementsMatch(t, []int{0, 1, 2}, fetched)
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, results)
+
+	value, err := loader.Load(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "b", value)
+	assert.Equal(t, int32(1), calls.Load(), "loaded keys are cached")
+}
+
+func TestLoader_Errors(t *testing.T) {
+	errFetch := errors.New("fetch failed")
+	loader := New(time.Millisecond, func(keys []int) (map[int]string, error) {
+		return nil, errFetch
+	})
+
+	_, err := loader.Load(context.Background(), 1)
+	assert.ErrorIs(t, err, errFetch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := New(time.Second, func(keys []int) (map[int]string, error) {
+		return map[int]string{}, nil
+	})
+	_, err = slow.Load(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -4,12 +4,43 @@ import (
 	"time"
 )
 
+// DeletedCommentContent replaces the content of a deleted comment that still has replies.
+const DeletedCommentContent = "[deleted]"
+
+// HiddenCommentContent is shown instead of a comment hidden by a moderator to
+// everyone below the moderator role.
+const HiddenCommentContent = "[hidden]"
+
+// CommentStatus tells whether a comment is out for everyone or still waits for a
+// moderator on a premoderated post. Pending comments are seen only by their
+// author and the moderators.
+type CommentStatus string
+
+const (
+	CommentPublished CommentStatus = "published"
+	CommentPending   CommentStatus = "pending"
+)
+
 type Comment struct {
-	ID        string     `gorm:"primaryKey;autoIncrement" json:"id"`
-	PostID    string     `gorm:"not null" json:"postId" validate:"required"`
-	ParentID  *string    `gorm:"index" json:"parentId,omitempty"`
-	Content   string     `gorm:"not null;size:2000" json:"content" validate:"required,max=2000"`
-	CreatedAt time.Time  `gorm:"index" json:"createdAt"`
-	UpdatedAt time.Time  `gorm:"index" json:"updatedAt"`
-	Replies   []*Comment `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE" json:"replies,omitempty"`
+	ID        string        `gorm:"primaryKey;autoIncrement" json:"id"`
+	PostID    string        `gorm:"not null" json:"postId" validate:"required"`
+	ParentID  *string       `gorm:"index" json:"parentId,omitempty"`
+	AuthorID  string        `gorm:"not null;default:'';index" json:"authorId,omitempty"`
+	Content   string        `gorm:"not null;size:2000" json:"content" validate:"required,max=2000"`
+	Deleted   bool          `gorm:"not null;default:false" json:"deleted"`
+	Hidden    bool          `gorm:"not null;default:false" json:"hidden"`
+	Status    CommentStatus `gorm:"not null;default:published;size:16;index" json:"status"`
+	Tags      []string      `gorm:"serializer:json;type:text" json:"tags,omitempty"`
+	CreatedAt time.Time     `gorm:"index" json:"createdAt"`
+	UpdatedAt time.Time     `gorm:"index" json:"updatedAt"`
+	EditedAt  *time.Time    `json:"editedAt,omitempty"`
+	Upvotes   int           `gorm:"not null;default:0" json:"upvotes"`
+	Downvotes int           `gorm:"not null;default:0" json:"downvotes"`
+	HotRank   float64       `gorm:"not null;default:0;index" json:"hotRank"`
+	BestRank  float64       `gorm:"not null;default:0;index" json:"bestRank"`
+	Replies   []*Comment    `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE" json:"replies,omitempty"`
+}
+
+func (c *Comment) Score() int {
+	return c.Upvotes - c.Downvotes
 }
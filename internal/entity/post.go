@@ -4,12 +4,41 @@ import (
 	"time"
 )
 
+// ModerationMode decides who may comment on a post and whether the comments
+// wait for a moderator before they are published.
+type ModerationMode string
+
+const (
+	ModerationOpen         ModerationMode = "open"
+	ModerationPremoderated ModerationMode = "premoderated"
+	ModerationClosed       ModerationMode = "closed"
+)
+
+func (m ModerationMode) Valid() bool {
+	switch m {
+	case ModerationOpen, ModerationPremoderated, ModerationClosed:
+		return true
+	default:
+		return false
+	}
+}
+
 type Post struct {
-	ID             string     `gorm:"primaryKey" json:"id"`
-	Title          string     `gorm:"not null" json:"title" validate:"required"`
-	Content        string     `gorm:"not null" json:"content" validate:"required"`
-	CommentsActive bool       `gorm:"not null" json:"commentsActive" validate:"required"`
-	CreatedAt      time.Time  `gorm:"index" json:"createdAt"`
-	UpdatedAt      time.Time  `gorm:"index" json:"updatedAt"`
-	Comments       []*Comment `gorm:"foreignKey:PostID" json:"comments,omitempty"`
+	ID             string         `gorm:"primaryKey" json:"id"`
+	Title          string         `gorm:"not null" json:"title" validate:"required,max=255"`
+	Content        string         `gorm:"not null" json:"content" validate:"required,max=20000"`
+	ModerationMode ModerationMode `gorm:"not null;default:open;size:16" json:"moderationMode"`
+	AuthorID       string         `gorm:"not null;default:'';index" json:"authorId,omitempty"`
+	CreatedAt      time.Time      `gorm:"index" json:"createdAt"`
+	UpdatedAt      time.Time      `gorm:"index" json:"updatedAt"`
+	// Posts are not voted on themselves; they collect the votes of their comments.
+	Upvotes   int        `gorm:"not null;default:0" json:"upvotes"`
+	Downvotes int        `gorm:"not null;default:0" json:"downvotes"`
+	HotRank   float64    `gorm:"not null;default:0;index" json:"hotRank"`
+	BestRank  float64    `gorm:"not null;default:0;index" json:"bestRank"`
+	Comments  []*Comment `gorm:"foreignKey:PostID" json:"comments,omitempty"`
+}
+
+func (p *Post) Score() int {
+	return p.Upvotes - p.Downvotes
 }
@@ -0,0 +1,30 @@
+package entity
+
+// ReactionTarget is what a reaction is put on: a post, or one of its comments when
+// CommentID is set. Keeping the post ID on comment reactions lets every change be
+// announced to the subscribers of the post.
+type ReactionTarget struct {
+	PostID    string `json:"postId"`
+	CommentID string `json:"commentId,omitempty"`
+}
+
+// Reaction is one emoji one user put on a post or comment. A user may put several
+// different emojis on the same target, but every emoji only once.
+type Reaction struct {
+	PostID    string `gorm:"primaryKey" json:"postId"`
+	CommentID string `gorm:"primaryKey;index" json:"commentId"`
+	UserID    string `gorm:"primaryKey;index" json:"userId"`
+	Emoji     string `gorm:"primaryKey;size:32" json:"emoji"`
+}
+
+func (r *Reaction) Target() ReactionTarget {
+	return ReactionTarget{PostID: r.PostID, CommentID: r.CommentID}
+}
+
+// ReactionCount is how many users put an emoji on a target and whether the
+// user the counts were read for is one of them.
+type ReactionCount struct {
+	Emoji       string
+	Count       int
+	ReactedByMe bool
+}
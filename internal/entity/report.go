@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"time"
+)
+
+// ReportStatus is where a report is in the moderation workflow. Only open
+// reports put a comment in the moderation queue.
+type ReportStatus string
+
+const (
+	ReportOpen ReportStatus = "open"
+	// ReportResolved reports led a moderator to hide the comment.
+	ReportResolved ReportStatus = "resolved"
+	// ReportDismissed reports were rejected, one by one or by approving the comment.
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// Report flags a comment for the moderators. A user has at most one open
+// report per comment, but may report it again once that one is closed.
+type Report struct {
+	ID        string       `gorm:"primaryKey" json:"id"`
+	PostID    string       `gorm:"not null;index" json:"postId"`
+	CommentID string       `gorm:"not null;index;uniqueIndex:idx_reports_open,where:status = 'open'" json:"commentId"`
+	UserID    string       `gorm:"not null;uniqueIndex:idx_reports_open,where:status = 'open'" json:"userId"`
+	Reason    string       `gorm:"not null" json:"reason" validate:"required,max=500"`
+	Status    ReportStatus `gorm:"not null;default:open;index" json:"status"`
+	CreatedAt time.Time    `gorm:"index" json:"createdAt"`
+}
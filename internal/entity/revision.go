@@ -0,0 +1,14 @@
+package entity
+
+import (
+	"time"
+)
+
+// CommentRevision is a previous version of an edited comment.
+// CreatedAt is the moment that version was written, not the moment it was replaced.
+type CommentRevision struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CommentID string    `gorm:"not null;index" json:"commentId"`
+	Content   string    `gorm:"not null;size:2000" json:"content"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+}
@@ -0,0 +1,16 @@
+package entity
+
+// SpamToken counts the comments containing a word that moderators hid as spam
+// or approved as ham. The content filter's classifier learns from these counts.
+type SpamToken struct {
+	Token string `gorm:"primaryKey;size:2000" json:"token"`
+	Spam  int    `gorm:"not null;default:0" json:"spam"`
+	Ham   int    `gorm:"not null;default:0" json:"ham"`
+}
+
+// SpamTraining records that the classifier learned a comment as spam, or as ham,
+// so a moderator repeating a decision cannot skew the counts.
+type SpamTraining struct {
+	CommentID string `gorm:"primaryKey" json:"commentId"`
+	Spam      bool   `gorm:"primaryKey" json:"spam"`
+}
@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"time"
+)
+
+// Role is what a user may do. Every role may do everything the roles before it may.
+type Role string
+
+const (
+	RoleReader    Role = "reader"
+	RoleCommenter Role = "commenter"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleReader:    1,
+	RoleCommenter: 2,
+	RoleModerator: 3,
+	RoleAdmin:     4,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// AtLeast reports whether r grants everything required grants. Unknown roles grant nothing.
+func (r Role) AtLeast(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
+
+type User struct {
+	ID           string    `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"not null;uniqueIndex;size:50" json:"name" validate:"required,min=3,max=50"`
+	PasswordHash string    `gorm:"not null" json:"passwordHash"`
+	Role         Role      `gorm:"not null;default:commenter" json:"role"`
+	CreatedAt    time.Time `gorm:"index" json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package entity
+
+// Vote is the value of a user's vote on a comment.
+type Vote int
+
+const (
+	VoteDown Vote = -1
+	VoteNone Vote = 0
+	VoteUp   Vote = 1
+)
+
+func (v Vote) Valid() bool {
+	return v >= VoteDown && v <= VoteUp
+}
+
+// CommentVote is the vote of one user on one comment. A user has at most one
+// vote per comment; taking a vote back deletes it instead of storing VoteNone.
+type CommentVote struct {
+	CommentID string `gorm:"primaryKey" json:"commentId"`
+	UserID    string `gorm:"primaryKey;index" json:"userId"`
+	Value     Vote   `gorm:"not null" json:"value"`
+}
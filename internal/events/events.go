@@ -0,0 +1,25 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrPublish = errors.New("failed to publish event")
+var ErrSubscribe = errors.New("failed to subscribe to events")
+
+// Bus delivers every payload published on a topic to all active subscribers of that topic.
+// Subscriptions end when the passed context is cancelled, after which the channel is closed.
+type Bus interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+}
+
+func CommentAddedTopic(postID string) string {
+	return fmt.Sprintf("comment_added:%s", postID)
+}
+
+func ReactionsChangedTopic(postID string) string {
+	return fmt.Sprintf("reactions_changed:%s", postID)
+}
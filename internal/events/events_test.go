@@ -0,0 +1,89 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, ch <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case payload, ok := <-ch:
+		require.True(t, ok, "channel closed")
+		return payload
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return nil
+	}
+}
+
+func testBus(t *testing.T, bus Bus) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	first, err := bus.Subscribe(ctx, CommentAddedTopic("1"))
+	require.NoError(t, err)
+	second, err := bus.Subscribe(ctx, CommentAddedTopic("1"))
+	require.NoError(t, err)
+	other, err := bus.Subscribe(ctx, CommentAddedTopic("2"))
+	require.NoError(t, err)
+
+	assert.NoError(t, bus.Publish(CommentAddedTopic("1"), []byte("hello")))
+
+	assert.Equal(t, "hello", string(receive(t, first)))
+	assert.Equal(t, "hello", string(receive(t, second)))
+
+	select {
+	case payload := <-other:
+		t.Fatalf("unexpected event on other topic: %s", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-first:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not closed after cancel")
+	}
+}
+
+func TestMemoryBus(t *testing.T) {
+	testBus(t, NewMemoryBus())
+}
+
+func TestRedisBus(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	testBus(t, &RedisBus{client: redis.NewClient(&redis.Options{Addr: s.Addr()})})
+}
+
+func TestRedisBus_Namespaces(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	first, err := NewRedisBus(config.RedisConfig{Address: s.Addr(), Namespace: "first"})
+	require.NoError(t, err)
+	second, err := NewRedisBus(config.RedisConfig{Address: s.Addr(), Namespace: "second"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := first.Subscribe(ctx, CommentAddedTopic("1"))
+	require.NoError(t, err)
+
+	assert.NoError(t, second.Publish(CommentAddedTopic("1"), []byte("other")))
+	assert.NoError(t, first.Publish(CommentAddedTopic("1"), []byte("own")))
+	assert.Equal(t, "own", string(receive(t, events)), "events of another namespace are not delivered")
+	assert.Equal(t, []string{"first:comment_added:1"}, s.PubSubChannels(""))
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const subscriberBufferSize = 16
+
+// MemoryBus is an in-process Bus for single-node runs.
+type MemoryBus struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subscribers: make(map[string]map[chan []byte]struct{})}
+}
+
+func (b *MemoryBus) Publish(topic string, payload []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[topic] {
+		select {
+		case ch <- payload:
+		default:
+			logrus.Warnf("dropping event on topic %s: subscriber is too slow", topic)
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	ch := make(chan []byte, subscriberBufferSize)
+
+	b.mu.Lock()
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[chan []byte]struct{})
+	}
+	b.subscribers[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		delete(b.subscribers[topic], ch)
+		if len(b.subscribers[topic]) == 0 {
+			delete(b.subscribers, topic)
+		}
+		b.mu.Unlock()
+
+		close(ch)
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// RedisBus fans events out through Redis pub/sub, so every replica connected
+// to the same Redis receives events published by any other replica. Topics are
+// prefixed with the namespace like the keys of the repo.
+type RedisBus struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisBus(cfg config.RedisConfig) (*RedisBus, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	if _, err := client.Ping().Result(); err != nil {
+		return nil, fmt.Errorf("failed to connect event bus to redis: %w", err)
+	}
+
+	return &RedisBus{client: client, prefix: cfg.KeyPrefix()}, nil
+}
+
+func (b *RedisBus) Publish(topic string, payload []byte) error {
+	if err := b.client.Publish(b.prefix+topic, payload).Err(); err != nil {
+		logrus.Errorf("failed to publish to redis channel %s: %v", topic, err)
+		return ErrPublish
+	}
+	return nil
+}
+
+func (b *RedisBus) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	ps := b.client.Subscribe(b.prefix + topic)
+	if _, err := ps.Receive(); err != nil {
+		_ = ps.Close()
+		logrus.Errorf("failed to subscribe to redis channel %s: %v", topic, err)
+		return nil, ErrSubscribe
+	}
+
+	ch := make(chan []byte, subscriberBufferSize)
+	messages := ps.Channel()
+
+	go func() {
+		defer close(ch)
+		defer ps.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case ch <- []byte(msg.Payload):
+				default:
+					logrus.Warnf("dropping event on topic %s: subscriber is too slow", topic)
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/search"
+)
+
+// totalsToken counts the trained comments themselves. search.Terms never
+// returns it, so it cannot clash with a word.
+const totalsToken = "*"
+
+// TokenStore keeps the classifier's word counts. database.Repo implements it,
+// so every server instance learns from the same moderator decisions.
+type TokenStore interface {
+	// TrainSpamFilter adds one to the spam or ham count of every token of the comment
+	// in one atomic step, unless the comment was already trained with the same
+	// verdict. It reports whether the counts changed. The tokens must be distinct.
+	TrainSpamFilter(commentID string, tokens []string, spam bool) (bool, error)
+	// GetSpamTokens returns the counts of the tokens, skipping the ones never trained.
+	GetSpamTokens(tokens []string) (map[string]*entity.SpamToken, error)
+}
+
+// Classifier is a naive Bayes spam classifier over the words of a comment. It
+// learns from moderators: a hidden comment is spam, an approved one is ham.
+type Classifier struct {
+	store       TokenStore
+	threshold   float64
+	minTraining int
+	action      Action
+}
+
+// NewClassifier returns a classifier that flags comments whose spam probability
+// reaches threshold. It stays quiet until it has seen at least minTraining
+// spam and minTraining ham comments.
+func NewClassifier(store TokenStore, threshold float64, minTraining int, action Action) *Classifier {
+	return &Classifier{store: store, threshold: threshold, minTraining: minTraining, action: action}
+}
+
+// Train learns the comment as spam or ham. Training a comment again with the
+// same verdict changes nothing.
+func (c *Classifier) Train(commentID string, text string, spam bool) error {
+	tokens := append(search.Terms(text), totalsToken)
+	if _, err := c.store.TrainSpamFilter(commentID, tokens, spam); err != nil {
+		return fmt.Errorf("failed to train spam filter: %w", err)
+	}
+	return nil
+}
+
+// SpamProbability also reports whether the classifier is trained enough to tell.
+// Words it has never seen are left out rather than guessed at.
+func (c *Classifier) SpamProbability(text string) (float64, bool, error) {
+	tokens := search.Terms(text)
+	counts, err := c.store.GetSpamTokens(append(tokens, totalsToken))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get spam filter tokens: %w", err)
+	}
+
+	totals, ok := counts[totalsToken]
+	if !ok || totals.Spam < c.minTraining || totals.Ham < c.minTraining {
+		return 0, false, nil
+	}
+
+	// The log odds of spam: the prior plus the Laplace-smoothed likelihood ratio of every known word.
+	spamDocs, hamDocs := float64(totals.Spam), float64(totals.Ham)
+	logOdds := math.Log(spamDocs / hamDocs)
+	for _, token := range tokens {
+		count, ok := counts[token]
+		if !ok {
+			continue
+		}
+		logOdds += math.Log((float64(count.Spam)+1)/(spamDocs+2)) - math.Log((float64(count.Ham)+1)/(hamDocs+2))
+	}
+	return 1 / (1 + math.Exp(-logOdds)), true, nil
+}
+
+func (c *Classifier) Check(content Content) (Decision, error) {
+	probability, trained, err := c.SpamProbability(content.Text)
+	if err != nil {
+		return Decision{}, err
+	}
+	if trained && probability >= c.threshold {
+		return Decision{Action: c.action, Tag: "spam", Reason: "looks like spam"}, nil
+	}
+	return Decision{}, nil
+}
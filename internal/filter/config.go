@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/config"
+)
+
+var ErrInvalidConfig = errors.New("invalid filter config")
+
+// FromConfig builds the pipeline the configuration asks for, leaving out the
+// filters set to allow. The classifier is returned even when it is left out,
+// so it keeps learning from the moderators until it is turned on.
+func FromConfig(cfg config.FilterConfig, store TokenStore) (*Pipeline, *Classifier, error) {
+	var bannedWords, links, repeatedChars, caps, duplicates, spam Action
+	for _, setting := range []struct {
+		name   string
+		value  string
+		action *Action
+	}{
+		{"FILTER_BANNED_WORDS_ACTION", cfg.BannedWordsAction, &bannedWords},
+		{"FILTER_LINKS_ACTION", cfg.LinksAction, &links},
+		{"FILTER_REPEATED_CHARS_ACTION", cfg.RepeatedCharsAction, &repeatedChars},
+		{"FILTER_CAPS_ACTION", cfg.CapsAction, &caps},
+		{"FILTER_DUPLICATE_ACTION", cfg.DuplicateAction, &duplicates},
+		{"FILTER_SPAM_ACTION", cfg.SpamAction, &spam},
+	} {
+		action, err := ParseAction(setting.value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, setting.name, err)
+		}
+		*setting.action = action
+	}
+
+	switch {
+	case cfg.MaxLinks < 0:
+		return nil, nil, fmt.Errorf("%w: FILTER_MAX_LINKS must not be negative", ErrInvalidConfig)
+	case cfg.MaxRepeatedChars < 1:
+		return nil, nil, fmt.Errorf("%w: FILTER_MAX_REPEATED_CHARS must be at least 1", ErrInvalidConfig)
+	case cfg.CapsRatio <= 0 || cfg.CapsRatio > 1:
+		return nil, nil, fmt.Errorf("%w: FILTER_CAPS_RATIO must be in (0, 1]", ErrInvalidConfig)
+	case cfg.DuplicateWindow <= 0:
+		return nil, nil, fmt.Errorf("%w: FILTER_DUPLICATE_WINDOW must be positive", ErrInvalidConfig)
+	case cfg.SpamThreshold <= 0 || cfg.SpamThreshold > 1:
+		return nil, nil, fmt.Errorf("%w: FILTER_SPAM_THRESHOLD must be in (0, 1]", ErrInvalidConfig)
+	case cfg.SpamMinTraining < 1:
+		return nil, nil, fmt.Errorf("%w: FILTER_SPAM_MIN_TRAINING must be at least 1", ErrInvalidConfig)
+	}
+
+	classifier := NewClassifier(store, cfg.SpamThreshold, cfg.SpamMinTraining, spam)
+	candidates := []struct {
+		action Action
+		filter Filter
+	}{
+		{bannedWords, NewBannedWords(cfg.BannedWords, bannedWords)},
+		{links, NewLinks(cfg.MaxLinks, links)},
+		{repeatedChars, NewRepeatedChars(cfg.MaxRepeatedChars, repeatedChars)},
+		{caps, NewCaps(cfg.CapsRatio, caps)},
+		{duplicates, NewDuplicates(cfg.DuplicateWindow, duplicates)},
+		{spam, classifier},
+	}
+
+	var filters []Filter
+	for _, candidate := range candidates {
+		if candidate.action != Allow {
+			filters = append(filters, candidate.filter)
+		}
+	}
+	return NewPipeline(filters...), classifier, nil
+}
@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// Duplicates catches a user posting the same text again within the window,
+// ignoring case and spacing. It remembers texts in process memory only, so a
+// restart or another server instance starts with a clean slate.
+type Duplicates struct {
+	window time.Duration
+	action Action
+	now    func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]map[[sha256.Size]byte]sighting // user ID -> text hash -> last sighting
+	lastSweep time.Time
+}
+
+type sighting struct {
+	commentID string
+	at        time.Time
+}
+
+func NewDuplicates(window time.Duration, action Action) *Duplicates {
+	return &Duplicates{window: window, action: action, now: time.Now, seen: make(map[string]map[[sha256.Size]byte]sighting)}
+}
+
+// Check compares the text with the ones recorded. Editing a comment without
+// changing its text does not count as a duplicate of itself.
+func (f *Duplicates) Check(content Content) (Decision, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	last, ok := f.seen[content.UserID][sha256.Sum256([]byte(normalize(content.Text)))]
+	if ok && last.commentID != content.CommentID && f.now().Sub(last.at) <= f.window {
+		return Decision{Action: f.action, Tag: "duplicate", Reason: "repeats a recent comment"}, nil
+	}
+	return Decision{}, nil
+}
+
+// Record remembers the text of a saved comment.
+func (f *Duplicates) Record(content Content) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if now.Sub(f.lastSweep) > f.window {
+		f.sweep(now)
+	}
+
+	texts := f.seen[content.UserID]
+	if texts == nil {
+		texts = make(map[[sha256.Size]byte]sighting)
+		f.seen[content.UserID] = texts
+	}
+	texts[sha256.Sum256([]byte(normalize(content.Text)))] = sighting{commentID: content.CommentID, at: now}
+}
+
+// sweep forgets the texts seen longer than the window ago.
+func (f *Duplicates) sweep(now time.Time) {
+	for userID, texts := range f.seen {
+		for hash, last := range texts {
+			if now.Sub(last.at) > f.window {
+				delete(texts, hash)
+			}
+		}
+		if len(texts) == 0 {
+			delete(f.seen, userID)
+		}
+	}
+	f.lastSweep = now
+}
@@ -0,0 +1,123 @@
+// Package filter checks the content of new and edited comments for spam and
+// banned words. Every filter of a Pipeline looks at the comment on its own and
+// asks for an Action; the strictest one wins.
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is what a filter wants done with a comment, from the mildest to the strictest.
+type Action int
+
+const (
+	// Allow lets the comment through untouched.
+	Allow Action = iota
+	// Tag lets the comment through and marks it for the moderators.
+	Tag
+	// Hold stores the comment as pending until a moderator approves it.
+	Hold
+	// Reject refuses the comment.
+	Reject
+)
+
+var actionNames = []string{"allow", "tag", "hold", "reject"}
+
+func (a Action) String() string {
+	if a < Allow || a > Reject {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+	return actionNames[a]
+}
+
+// ParseAction reads an action by its name, ignoring case.
+func ParseAction(name string) (Action, error) {
+	for action, known := range actionNames {
+		if strings.EqualFold(strings.TrimSpace(name), known) {
+			return Action(action), nil
+		}
+	}
+	return Allow, fmt.Errorf("unknown filter action %q", name)
+}
+
+// Content is a comment as the filters see it.
+type Content struct {
+	UserID    string
+	CommentID string
+	Text      string
+}
+
+// Decision is the verdict of a single filter. Tag names the filter's finding
+// on the comment and Reason explains it to the author.
+type Decision struct {
+	Action Action
+	Tag    string
+	Reason string
+}
+
+type Filter interface {
+	Check(content Content) (Decision, error)
+}
+
+// Recorder is a filter that remembers the comments it has let through. Check
+// only looks, so a rejected comment leaves no trace; Record is called once the
+// comment is saved.
+type Recorder interface {
+	Record(content Content)
+}
+
+// Result is the verdict of a whole pipeline: the strictest action with its
+// reason, and the tags of every filter that did not allow the comment.
+type Result struct {
+	Action Action
+	Tags   []string
+	Reason string
+}
+
+// Pipeline runs its filters in order. A nil pipeline allows everything.
+type Pipeline struct {
+	filters []Filter
+}
+
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// Check runs every filter, even after one rejected the comment, so the result
+// carries all the tags.
+func (p *Pipeline) Check(content Content) (Result, error) {
+	result := Result{Action: Allow, Tags: []string{}}
+	if p == nil {
+		return result, nil
+	}
+
+	for _, filter := range p.filters {
+		decision, err := filter.Check(content)
+		if err != nil {
+			return Result{}, err
+		}
+		if decision.Action == Allow {
+			continue
+		}
+		result.Tags = append(result.Tags, decision.Tag)
+		if decision.Action > result.Action {
+			result.Action = decision.Action
+			result.Reason = decision.Reason
+		}
+	}
+	return result, nil
+}
+
+// Record hands a saved comment to the filters that remember comments.
+func (p *Pipeline) Record(content Content) {
+	if p == nil {
+		return
+	}
+
+	for _, filter := range p.filters {
+		if recorder, ok := filter.(Recorder); ok {
+			recorder.Record(content)
+		}
+	}
+}
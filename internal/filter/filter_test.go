@@ -0,0 +1,161 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/apartapatia/wall_of_comments/internal/database/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func check(t *testing.T, filter Filter, text string) Action {
+	t.Helper()
+	decision, err := filter.Check(Content{UserID: "u1", CommentID: "c1", Text: text})
+	require.NoError(t, err)
+	return decision.Action
+}
+
+func TestParseAction(t *testing.T) {
+	action, err := ParseAction(" Hold ")
+	require.NoError(t, err)
+	assert.Equal(t, Hold, action)
+	assert.Equal(t, "reject", Reject.String())
+	_, err = ParseAction("drop")
+	assert.Error(t, err)
+}
+
+func TestPipeline(t *testing.T) {
+	result, err := (*Pipeline)(nil).Check(Content{Text: "anything"})
+	require.NoError(t, err)
+	assert.Equal(t, Allow, result.Action)
+
+	pipeline := NewPipeline(NewCaps(0.8, Tag), NewBannedWords([]string{"viagra"}, Reject), NewLinks(0, Hold))
+	result, err = pipeline.Check(Content{Text: "BUY VIAGRA AT HTTP://EXAMPLE.COM TODAY"})
+	require.NoError(t, err)
+	assert.Equal(t, Reject, result.Action, "the strictest action wins")
+	assert.Equal(t, "contains a banned word", result.Reason)
+	assert.Equal(t, []string{"all_caps", "banned_word", "too_many_links"}, result.Tags)
+
+	result, err = pipeline.Check(Content{Text: "Nothing to see here"})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Action: Allow, Tags: []string{}}, result)
+
+	duplicates := NewDuplicates(time.Minute, Reject)
+	pipeline = NewPipeline(NewBannedWords([]string{"viagra"}, Reject), duplicates)
+	(*Pipeline)(nil).Record(Content{Text: "anything"})
+	pipeline.Record(Content{UserID: "u1", CommentID: "c1", Text: "Hello"})
+	assert.Len(t, duplicates.seen["u1"], 1, "the pipeline records through the filters that remember")
+}
+
+func TestHeuristics(t *testing.T) {
+	banned := NewBannedWords([]string{"Casino", " scam "}, Reject)
+	assert.Equal(t, Reject, check(t, banned, "Best casino in town!"))
+	assert.Equal(t, Reject, check(t, banned, "what a SCAM."))
+	assert.Equal(t, Allow, check(t, banned, "casinos and scammers"), "only whole words count")
+
+	links := NewLinks(2, Hold)
+	assert.Equal(t, Allow, check(t, links, "see https://a.example and www.b.example"))
+	assert.Equal(t, Hold, check(t, links, "https://a.example http://b.example www.c.example"))
+
+	repeated := NewRepeatedChars(5, Tag)
+	assert.Equal(t, Allow, check(t, repeated, "wow!!!!! ok"+strings.Repeat(" ", 10)))
+	assert.Equal(t, Tag, check(t, repeated, "wow!!!!!!"))
+	assert.Equal(t, Tag, check(t, repeated, "нууууууу"))
+
+	caps := NewCaps(0.8, Tag)
+	assert.Equal(t, Allow, check(t, caps, "LOL OK"), "short comments are left alone")
+	assert.Equal(t, Tag, check(t, caps, "THIS IS THE BEST POST EVER, ok"))
+	assert.Equal(t, Allow, check(t, caps, "This Is The Best Post Ever, Ok"))
+}
+
+func TestDuplicates(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	duplicates := NewDuplicates(10*time.Minute, Reject)
+	duplicates.now = func() time.Time { return now }
+
+	decide := func(userID string, commentID string, text string) Action {
+		t.Helper()
+		content := Content{UserID: userID, CommentID: commentID, Text: text}
+		decision, err := duplicates.Check(content)
+		require.NoError(t, err)
+		if decision.Action == Allow {
+			duplicates.Record(content)
+		}
+		return decision.Action
+	}
+
+	assert.Equal(t, Allow, decide("u1", "c1", "Great post"))
+	assert.Equal(t, Reject, decide("u1", "c2", "  great   POST "), "case and spacing do not matter")
+	assert.Equal(t, Allow, decide("u2", "c3", "Great post"), "other users may say the same")
+	assert.Equal(t, Allow, decide("u1", "c1", "Great post"), "editing a comment is not a duplicate of itself")
+
+	_, err := duplicates.Check(Content{UserID: "u1", CommentID: "c5", Text: "Buy now"})
+	require.NoError(t, err)
+	assert.Equal(t, Allow, decide("u1", "c6", "Buy now"), "texts are only remembered once recorded")
+
+	now = now.Add(11 * time.Minute)
+	assert.Equal(t, Allow, decide("u1", "c4", "Great post"), "the window has passed")
+	assert.Len(t, duplicates.seen, 1, "old texts are swept")
+}
+
+func TestClassifier(t *testing.T) {
+	classifier := NewClassifier(memory.NewRepo(), 0.9, 2, Hold)
+
+	_, trained, err := classifier.SpamProbability("cheap pills")
+	require.NoError(t, err)
+	assert.False(t, trained)
+	assert.Equal(t, Allow, check(t, classifier, "cheap pills"), "an untrained classifier stays quiet")
+
+	for i, text := range []string{"cheap pills online", "buy cheap pills now", "cheap watches online"} {
+		require.NoError(t, classifier.Train(fmt.Sprintf("s%d", i), text, true))
+	}
+	for i, text := range []string{"great post about redis", "thanks for the post", "redis streams are great"} {
+		require.NoError(t, classifier.Train(fmt.Sprintf("h%d", i), text, false))
+	}
+
+	spam, trained, err := classifier.SpamProbability("cheap pills here")
+	require.NoError(t, err)
+	assert.True(t, trained)
+	ham, _, err := classifier.SpamProbability("great redis post")
+	require.NoError(t, err)
+	assert.Greater(t, spam, 0.9)
+	assert.Less(t, ham, 0.1)
+
+	assert.Equal(t, Hold, check(t, classifier, "cheap pills here"))
+	assert.Equal(t, Allow, check(t, classifier, "great redis post"))
+}
+
+func TestFromConfig(t *testing.T) {
+	cfg := config.FilterConfig{
+		BannedWords:         []string{"casino"},
+		BannedWordsAction:   "reject",
+		MaxLinks:            3,
+		LinksAction:         "hold",
+		MaxRepeatedChars:    10,
+		RepeatedCharsAction: "tag",
+		CapsRatio:           0.8,
+		CapsAction:          "allow",
+		DuplicateWindow:     time.Minute,
+		DuplicateAction:     "reject",
+		SpamThreshold:       0.95,
+		SpamMinTraining:     20,
+		SpamAction:          "allow",
+	}
+	pipeline, classifier, err := FromConfig(cfg, memory.NewRepo())
+	require.NoError(t, err)
+	assert.Len(t, pipeline.filters, 4, "filters set to allow are left out")
+	assert.NotNil(t, classifier, "the classifier learns even when it is off")
+
+	bad := cfg
+	bad.LinksAction = "drop"
+	_, _, err = FromConfig(bad, memory.NewRepo())
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	bad = cfg
+	bad.CapsRatio = 1.5
+	_, _, err = FromConfig(bad, memory.NewRepo())
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
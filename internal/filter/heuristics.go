@@ -0,0 +1,116 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/apartapatia/wall_of_comments/internal/search"
+)
+
+// BannedWords matches whole words, split and lowercased as search.Terms does,
+// so a banned word inside a longer one does not count.
+type BannedWords struct {
+	words  map[string]struct{}
+	action Action
+}
+
+func NewBannedWords(words []string, action Action) *BannedWords {
+	set := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		for _, term := range search.Terms(word) {
+			set[term] = struct{}{}
+		}
+	}
+	return &BannedWords{words: set, action: action}
+}
+
+func (f *BannedWords) Check(content Content) (Decision, error) {
+	for _, term := range search.Terms(content.Text) {
+		if _, ok := f.words[term]; ok {
+			return Decision{Action: f.action, Tag: "banned_word", Reason: "contains a banned word"}, nil
+		}
+	}
+	return Decision{}, nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://\S+|\bwww\.\S+`)
+
+// Links counts the web addresses in the comment, with or without a scheme.
+type Links struct {
+	limit  int
+	action Action
+}
+
+func NewLinks(limit int, action Action) *Links {
+	return &Links{limit: limit, action: action}
+}
+
+func (f *Links) Check(content Content) (Decision, error) {
+	if len(linkPattern.FindAllStringIndex(content.Text, f.limit+1)) > f.limit {
+		return Decision{Action: f.action, Tag: "too_many_links", Reason: "contains too many links"}, nil
+	}
+	return Decision{}, nil
+}
+
+// RepeatedChars catches runs of one character, like "!!!!!!!!!!!!" or "loooooooool".
+// Whitespace does not count.
+type RepeatedChars struct {
+	limit  int
+	action Action
+}
+
+func NewRepeatedChars(limit int, action Action) *RepeatedChars {
+	return &RepeatedChars{limit: limit, action: action}
+}
+
+func (f *RepeatedChars) Check(content Content) (Decision, error) {
+	var last rune
+	run := 0
+	for _, r := range content.Text {
+		if r == last && !unicode.IsSpace(r) {
+			run++
+		} else {
+			last, run = r, 1
+		}
+		if run > f.limit {
+			return Decision{Action: f.action, Tag: "repeated_chars", Reason: "repeats a character too many times"}, nil
+		}
+	}
+	return Decision{}, nil
+}
+
+// capsMinLetters keeps short comments like "OK" or "LOL" clear of the caps filter.
+const capsMinLetters = 20
+
+// Caps catches comments written mostly in capital letters.
+type Caps struct {
+	ratio  float64
+	action Action
+}
+
+func NewCaps(ratio float64, action Action) *Caps {
+	return &Caps{ratio: ratio, action: action}
+}
+
+func (f *Caps) Check(content Content) (Decision, error) {
+	letters, upper := 0, 0
+	for _, r := range content.Text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	if letters >= capsMinLetters && float64(upper) >= f.ratio*float64(letters) {
+		return Decision{Action: f.action, Tag: "all_caps", Reason: "is written in capital letters"}, nil
+	}
+	return Decision{}, nil
+}
+
+// normalize makes texts that differ only in case or spacing equal.
+func normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
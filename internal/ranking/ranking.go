@@ -0,0 +1,50 @@
+// Package ranking scores posts and comments for the HOT and BEST orders. Both
+// scores only change when votes do, so they are computed when content is written
+// and stored next to it instead of being recomputed on every read.
+package ranking
+
+import (
+	"math"
+	"time"
+)
+
+// hotEpoch and hotHalfLife come from Reddit's hot ranking: content created
+// hotHalfLife later needs ten times the score to rank the same.
+var hotEpoch = time.Unix(1134028003, 0)
+
+const hotHalfLife = 45000 * time.Second
+
+// wilsonZ is the z-score of an 80% confidence level, as used by Reddit's best ranking.
+const wilsonZ = 1.281551565545
+
+// Hot ranks by score, discounted logarithmically, plus time since hotEpoch, so
+// newer content rises above older content with a comparable score.
+func Hot(upvotes int, downvotes int, createdAt time.Time) float64 {
+	score := float64(upvotes - downvotes)
+	order := math.Log10(math.Max(math.Abs(score), 1))
+
+	sign := 0.0
+	switch {
+	case score > 0:
+		sign = 1
+	case score < 0:
+		sign = -1
+	}
+
+	seconds := createdAt.Sub(hotEpoch).Seconds()
+	return sign*order + seconds/hotHalfLife.Seconds()
+}
+
+// Best is the lower bound of the Wilson score interval for the share of upvotes:
+// the share the content can be trusted to reach given how many votes it has.
+// It is 0 without votes, so a single upvote does not outrank a hundred of a thousand.
+func Best(upvotes int, downvotes int) float64 {
+	n := float64(upvotes + downvotes)
+	if n == 0 {
+		return 0
+	}
+
+	p := float64(upvotes) / n
+	z2 := wilsonZ * wilsonZ
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
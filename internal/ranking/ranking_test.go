@@ -0,0 +1,38 @@
+package ranking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHot(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.InDelta(t, createdAt.Sub(hotEpoch).Seconds()/45000, Hot(0, 0, createdAt), 1e-9)
+	assert.InDelta(t, Hot(0, 0, createdAt)+1, Hot(10, 0, createdAt), 1e-9, "ten upvotes add one")
+	assert.InDelta(t, Hot(0, 0, createdAt)-2, Hot(0, 100, createdAt), 1e-9)
+	assert.Equal(t, Hot(0, 0, createdAt), Hot(1, 0, createdAt), "a single vote is worth nothing over none")
+	assert.Greater(t, Hot(2, 0, createdAt), Hot(1, 0, createdAt))
+
+	later := createdAt.Add(45000 * time.Second)
+	assert.InDelta(t, Hot(10, 0, createdAt), Hot(0, 0, later), 1e-9, "time makes up for a tenfold score")
+	assert.Greater(t, Hot(0, 0, later.Add(time.Microsecond)), Hot(0, 0, later))
+}
+
+func TestBest(t *testing.T) {
+	assert.Zero(t, Best(0, 0))
+	assert.Zero(t, Best(0, 10))
+	assert.InDelta(t, 0.3784, Best(1, 0), 1e-4)
+	assert.InDelta(t, 0.9984, Best(1000, 0), 1e-4)
+	assert.Greater(t, Best(100, 1), Best(1, 0), "many votes beat one")
+	assert.Greater(t, Best(60, 40), Best(6, 4), "more votes at the same share are more certain")
+	assert.Greater(t, Best(90, 10), Best(50, 50))
+
+	for _, votes := range [][2]int{{1, 0}, {5, 5}, {3, 100}, {1000, 1}} {
+		best := Best(votes[0], votes[1])
+		share := float64(votes[0]) / float64(votes[0]+votes[1])
+		assert.True(t, best >= 0 && best <= share, "the lower bound stays within [0, share] for %v", votes)
+	}
+}
@@ -0,0 +1,140 @@
+// Package search matches and ranks text for the backends that have no full-text
+// search of their own. Words are split and lowercased the way the "simple" text
+// search configuration of Postgres does it, without stemming or stop words, so
+// every backend finds the same posts and comments for a query.
+package search
+
+import (
+	"html"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// SnippetWords is the length of a snippet, and snippetLead the number of words
+// it shows before the first match.
+const SnippetWords = 20
+const snippetLead = 5
+
+// StartSel and StopSel wrap every matched word in a snippet.
+const StartSel = "<b>"
+const StopSel = "</b>"
+
+type word struct {
+	text  string
+	start int
+	end   int
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// split returns the lowercased words of text with their byte offsets.
+func split(text string) []word {
+	var words []word
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			words = append(words, word{text: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{text: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return words
+}
+
+// Terms returns the distinct words of the query in the order they first appear.
+// A query without words matches nothing.
+func Terms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, w := range split(query) {
+		if !seen[w.text] {
+			seen[w.text] = true
+			terms = append(terms, w.text)
+		}
+	}
+	return terms
+}
+
+// Rank reports whether text contains every term and how well it matches: each
+// term adds more the more often it occurs, and long texts are scaled down, close
+// to ts_rank with length normalization in Postgres.
+func Rank(terms []string, text string) (float64, bool) {
+	words := split(text)
+	counts := make(map[string]int, len(terms))
+	for _, term := range terms {
+		counts[term] = 0
+	}
+	for _, w := range words {
+		if _, ok := counts[w.text]; ok {
+			counts[w.text]++
+		}
+	}
+
+	rank := 0.0
+	for _, term := range terms {
+		if counts[term] == 0 {
+			return 0, false
+		}
+		rank += 1 + math.Log(float64(counts[term]))
+	}
+	return rank / (1 + math.Log(float64(len(words)))), len(terms) > 0
+}
+
+// Snippet cuts up to SnippetWords words out of text, starting shortly before the
+// first term, or at the start when no term occurs. Matched words are wrapped in
+// StartSel and StopSel and everything else is HTML-escaped, so the snippet can be
+// rendered as HTML as it is.
+func Snippet(terms []string, text string) string {
+	words := split(text)
+	if len(words) == 0 {
+		return ""
+	}
+
+	matches := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		matches[term] = true
+	}
+
+	first := 0
+	for i, w := range words {
+		if matches[w.text] {
+			first = i
+			break
+		}
+	}
+	start := max(0, first-snippetLead)
+	end := min(len(words), start+SnippetWords)
+
+	// A snippet reaching the start or the end of text keeps the punctuation there.
+	pos, last := words[start].start, words[end-1].end
+	if start == 0 {
+		pos = 0
+	}
+	if end == len(words) {
+		last = len(text)
+	}
+
+	var b strings.Builder
+	for _, w := range words[start:end] {
+		b.WriteString(html.EscapeString(text[pos:w.start]))
+		if matches[w.text] {
+			b.WriteString(StartSel + html.EscapeString(text[w.start:w.end]) + StopSel)
+		} else {
+			b.WriteString(html.EscapeString(text[w.start:w.end]))
+		}
+		pos = w.end
+	}
+	b.WriteString(html.EscapeString(text[pos:last]))
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"привет", "мир", "go2"}, Terms("  Привет, МИР! привет go2..."))
+	assert.Empty(t, Terms(" ,.!? "))
+}
+
+func TestRank(t *testing.T) {
+	terms := Terms("redis index")
+
+	_, ok := Rank(terms, "Redis is fast")
+	assert.False(t, ok, "every term has to occur")
+	_, ok = Rank(nil, "Redis is fast")
+	assert.False(t, ok, "no terms match nothing")
+
+	once, ok := Rank(terms, "redis keeps an index")
+	assert.True(t, ok)
+	twice, _ := Rank(terms, "redis keeps an index, a REDIS index")
+	assert.Greater(t, twice, once, "repeated terms rank higher")
+	long, _ := Rank(terms, "redis keeps an index"+strings.Repeat(" and more", 20))
+	assert.Greater(t, once, long, "longer texts rank lower")
+}
+
+func TestSnippet(t *testing.T) {
+	terms := Terms("index")
+
+	assert.Equal(t, "a <b>Index</b> &amp; <b>index</b>", Snippet(terms, "a Index & index"))
+	assert.Equal(t, "", Snippet(terms, "?!"))
+	assert.Equal(t, "&lt;no&gt; &lt;match&gt; here!", Snippet(terms, "<no> <match> here!"))
+
+	text := strings.Repeat("word ", 30) + "index" + strings.Repeat(" tail", 30)
+	assert.Equal(t, "word word word word word <b>index</b>"+strings.Repeat(" tail", SnippetWords-snippetLead-1), Snippet(terms, text))
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/filter"
+	"github.com/google/uuid"
+)
+
+type CommentService struct {
+	repo    database.Repo
+	filters *filter.Pipeline
+}
+
+// NewCommentService runs every new or edited comment through filters; nil filters
+// let everything through.
+func NewCommentService(repo database.Repo, filters *filter.Pipeline) *CommentService {
+	return &CommentService{repo: repo, filters: filters}
+}
+
+// CreateComment checks that the post accepts comments and that the parent, if any,
+// belongs to the same post before anything is persisted. On a premoderated post,
+// or when the content filter holds it, the comment is saved as pending.
+func (s *CommentService) CreateComment(actor *entity.User, postID string, parentID *string, content string) (*entity.Comment, error) {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return nil, err
+	}
+
+	now := database.Now()
+	comment := &entity.Comment{
+		ID:        uuid.New().String(),
+		PostID:    postID,
+		ParentID:  parentID,
+		AuthorID:  actor.ID,
+		Content:   content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := validateStruct(comment); err != nil {
+		return nil, err
+	}
+
+	post, err := s.repo.GetPostById(postID)
+	if err != nil {
+		return nil, translate(err, database.ErrPostNotFound, ErrPostNotFound)
+	}
+
+	if post.ModerationMode == entity.ModerationClosed {
+		return nil, ErrCommentsDisabled
+	}
+
+	if parentID != nil {
+		parent, err := s.repo.GetCommentById(*parentID)
+		if err != nil {
+			return nil, translate(err, database.ErrCommentNotFound, ErrParentNotFound)
+		}
+		if !CanSee(actor, parent) {
+			return nil, ErrParentNotFound
+		}
+
+		if parent.PostID != post.ID {
+			return nil, ErrParentOnOtherPost
+		}
+	}
+
+	if err := s.filter(comment); err != nil {
+		return nil, err
+	}
+
+	savedComment, err := s.repo.CreateComment(comment)
+	if err != nil {
+		return nil, translateCreateError(err)
+	}
+	s.filters.Record(filterContent(savedComment))
+
+	return savedComment, nil
+}
+
+func (s *CommentService) GetComment(id string) (*entity.Comment, error) {
+	comment, err := s.repo.GetCommentById(id)
+	if err != nil {
+		return nil, translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+	return comment, nil
+}
+
+func (s *CommentService) GetCommentsForPost(postID string) ([]*entity.Comment, error) {
+	comments, err := s.repo.GetCommentsForPost(postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments for post with ID %s: %w", postID, err)
+	}
+	return comments, nil
+}
+
+// GetCommentsForPostWithLimitAndOffset pages through the comments the actor can see.
+func (s *CommentService) GetCommentsForPostWithLimitAndOffset(actor *entity.User, postID string, limit *int, offset *int, order database.CommentSort) ([]*entity.Comment, error) {
+	comments, err := s.repo.GetCommentsForPostWithLimitAndOffset(postID, limit, offset, order, ViewerOf(actor))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments for post with ID %s: %w", postID, err)
+	}
+	return comments, nil
+}
+
+// GetCommentsForPostAfter pages through the comments the actor can see.
+func (s *CommentService) GetCommentsForPostAfter(actor *entity.User, postID string, first int, after *database.Cursor) ([]*entity.Comment, bool, error) {
+	comments, hasNext, err := s.repo.GetCommentsForPostAfter(postID, first, after, ViewerOf(actor))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get comments for post with ID %s: %w", postID, err)
+	}
+	return comments, hasNext, nil
+}
+
+// GetCommentTrees returns the subtrees under the roots, see database.Repo.GetCommentTrees.
+func (s *CommentService) GetCommentTrees(roots []database.TreeRoot, opts database.TreeOptions) (map[database.TreeRoot][]*entity.Comment, error) {
+	trees, err := s.repo.GetCommentTrees(roots, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment trees: %w", err)
+	}
+	return trees, nil
+}
+
+// UpdateComment replaces the content and keeps the previous version in the revision
+// history. The new content goes through the content filter like a new comment.
+func (s *CommentService) UpdateComment(actor *entity.User, id string, content string) (*entity.Comment, error) {
+	comment, err := s.authorizedComment(actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.Deleted {
+		return nil, ErrCommentDeleted
+	}
+
+	now := database.Now()
+	comment.Content = content
+	comment.EditedAt = &now
+	comment.UpdatedAt = now
+
+	if err := validateStruct(comment); err != nil {
+		return nil, err
+	}
+	if err := s.filter(comment); err != nil {
+		return nil, err
+	}
+
+	updatedComment, err := s.repo.UpdateComment(comment)
+	if err != nil {
+		return nil, translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+	s.filters.Record(filterContent(updatedComment))
+
+	return updatedComment, nil
+}
+
+// DeleteComment removes the comment, or leaves a tombstone in its place if it has replies.
+func (s *CommentService) DeleteComment(actor *entity.User, id string) error {
+	comment, err := s.authorizedComment(actor, id)
+	if err != nil {
+		return err
+	}
+
+	if comment.Deleted {
+		return ErrCommentDeleted
+	}
+
+	if err := s.repo.DeleteComment(id); err != nil {
+		return translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+
+	return nil
+}
+
+// Vote replaces the vote of the actor on the comment; VoteNone takes it back.
+func (s *CommentService) Vote(actor *entity.User, id string, value entity.Vote) (*entity.Comment, error) {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return nil, err
+	}
+	if !value.Valid() {
+		return nil, fmt.Errorf("%w: unknown vote %d", ErrInvalidInput, value)
+	}
+
+	comment, err := s.GetComment(id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanSee(actor, comment) {
+		return nil, ErrCommentNotFound
+	}
+	if comment.Deleted {
+		return nil, ErrCommentDeleted
+	}
+
+	votedComment, err := s.repo.VoteComment(id, actor.ID, value)
+	if err != nil {
+		return nil, translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+	return votedComment, nil
+}
+
+// GetVotes returns the votes of the actor on the comments, leaving out the ones
+// without a vote. Anonymous actors have no votes.
+func (s *CommentService) GetVotes(actor *entity.User, commentIDs []string) (map[string]entity.Vote, error) {
+	if actor == nil {
+		return map[string]entity.Vote{}, nil
+	}
+
+	votes, err := s.repo.GetCommentVotes(actor.ID, commentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get votes: %w", err)
+	}
+	return votes, nil
+}
+
+func (s *CommentService) GetRevisions(commentID string) ([]*entity.CommentRevision, error) {
+	revisions, err := s.repo.GetCommentRevisions(commentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions for comment with ID %s: %w", commentID, err)
+	}
+	return revisions, nil
+}
+
+// filter runs the comment through the content filter, tagging it and marking it
+// pending if it is held. Nothing is recorded until the comment is saved.
+func (s *CommentService) filter(comment *entity.Comment) error {
+	result, err := s.filters.Check(filterContent(comment))
+	if err != nil {
+		return fmt.Errorf("failed to filter comment: %w", err)
+	}
+
+	switch result.Action {
+	case filter.Reject:
+		return fmt.Errorf("%w: %s", ErrContentRejected, result.Reason)
+	case filter.Hold:
+		comment.Status = entity.CommentPending
+	}
+	comment.Tags = result.Tags
+	return nil
+}
+
+func filterContent(comment *entity.Comment) filter.Content {
+	return filter.Content{UserID: comment.AuthorID, CommentID: comment.ID, Text: comment.Content}
+}
+
+// authorizedComment returns the comment if the actor may change it.
+func (s *CommentService) authorizedComment(actor *entity.User, id string) (*entity.Comment, error) {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return nil, err
+	}
+
+	comment, err := s.GetComment(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Authorize(actor, comment.AuthorID); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
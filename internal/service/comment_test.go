@@ -0,0 +1,284 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/apartapatia/wall_of_comments/internal/config"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/database/redis"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	author    = &entity.User{ID: "author", Name: "author", Role: entity.RoleCommenter}
+	other     = &entity.User{ID: "other", Name: "other", Role: entity.RoleCommenter}
+	moderator = &entity.User{ID: "moderator", Name: "moderator", Role: entity.RoleModerator}
+	reader    = &entity.User{ID: "reader", Name: "reader", Role: entity.RoleReader}
+)
+
+func setupTestRepo(t *testing.T) database.Repo {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+
+	repo, err := redis.GetRepo(config.RedisConfig{Address: s.Addr()})
+	require.NoError(t, err)
+
+	return repo
+}
+
+func TestCommentService_CreateComment(t *testing.T) {
+	repo := setupTestRepo(t)
+	comments := NewCommentService(repo, nil)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	_, err = repo.CreatePost(&entity.Post{ID: "2", Title: "Post 2", Content: "Content 2", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+
+	parent, err := comments.CreateComment(author, "1", nil, "Content comment 1")
+	require.NoError(t, err)
+
+	reply, err := comments.CreateComment(author, "1", &parent.ID, "Content comment 2")
+	assert.NoError(t, err)
+	assert.Equal(t, parent.ID, *reply.ParentID)
+
+	_, err = comments.CreateComment(author, "3", nil, "Content comment 3")
+	assert.ErrorIs(t, err, ErrPostNotFound)
+
+	missingID := "missing"
+	_, err = comments.CreateComment(author, "1", &missingID, "Content comment 4")
+	assert.ErrorIs(t, err, ErrParentNotFound)
+
+	_, err = comments.CreateComment(author, "2", &parent.ID, "Content comment 5")
+	assert.ErrorIs(t, err, ErrParentOnOtherPost)
+
+	_, err = repo.SetPostModerationMode("1", entity.ModerationClosed)
+	require.NoError(t, err)
+	_, err = comments.CreateComment(author, "1", nil, "Content comment 6")
+	assert.ErrorIs(t, err, ErrCommentsDisabled)
+
+	saved, err := repo.GetCommentsForPost("1")
+	assert.NoError(t, err)
+	assert.Len(t, saved, 2)
+	saved, err = repo.GetCommentsForPost("2")
+	assert.NoError(t, err)
+	assert.Empty(t, saved)
+}
+
+func TestCommentService_CreateCommentValidation(t *testing.T) {
+	repo := setupTestRepo(t)
+	comments := NewCommentService(repo, nil)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+
+	_, err = comments.CreateComment(author, "1", nil, "")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = comments.CreateComment(author, "1", nil, strings.Repeat("a", 2001))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestCommentService_UpdateAndDeleteComment(t *testing.T) {
+	repo := setupTestRepo(t)
+	comments := NewCommentService(repo, nil)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+
+	parent, err := comments.CreateComment(author, "1", nil, "Content comment 1")
+	require.NoError(t, err)
+	_, err = comments.CreateComment(author, "1", &parent.ID, "Content comment 2")
+	require.NoError(t, err)
+
+	updated, err := comments.UpdateComment(author, parent.ID, "Edited comment 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited comment 1", updated.Content)
+	assert.NotNil(t, updated.EditedAt)
+
+	revisions, err := comments.GetRevisions(parent.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+	assert.Equal(t, "Content comment 1", revisions[0].Content)
+
+	_, err = comments.UpdateComment(author, parent.ID, "")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = comments.UpdateComment(author, "missing", "Edited comment")
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+
+	assert.NoError(t, comments.DeleteComment(author, parent.ID))
+	assert.ErrorIs(t, comments.DeleteComment(author, parent.ID), ErrCommentDeleted)
+
+	_, err = comments.UpdateComment(author, parent.ID, "Edited comment 1")
+	assert.ErrorIs(t, err, ErrCommentDeleted)
+
+	assert.ErrorIs(t, comments.DeleteComment(author, "missing"), ErrCommentNotFound)
+}
+
+func TestCommentService_Authorization(t *testing.T) {
+	repo := setupTestRepo(t)
+	comments := NewCommentService(repo, nil)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+
+	_, err = comments.CreateComment(nil, "1", nil, "Content comment 1")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	comment, err := comments.CreateComment(author, "1", nil, "Content comment 1")
+	require.NoError(t, err)
+	assert.Equal(t, author.ID, comment.AuthorID)
+
+	_, err = comments.UpdateComment(nil, comment.ID, "Edited comment 1")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = comments.UpdateComment(other, comment.ID, "Edited comment 1")
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, comments.DeleteComment(other, comment.ID), ErrForbidden)
+
+	_, err = comments.UpdateComment(moderator, comment.ID, "Edited comment 1")
+	assert.NoError(t, err)
+	assert.NoError(t, comments.DeleteComment(moderator, comment.ID))
+}
+
+func TestCommentService_Vote(t *testing.T) {
+	repo := setupTestRepo(t)
+	comments := NewCommentService(repo, nil)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	comment, err := comments.CreateComment(author, "1", nil, "Content comment 1")
+	require.NoError(t, err)
+
+	voted, err := comments.Vote(other, comment.ID, entity.VoteUp)
+	require.NoError(t, err)
+	assert.Equal(t, 1, voted.Score())
+	voted, err = comments.Vote(moderator, comment.ID, entity.VoteDown)
+	require.NoError(t, err)
+	assert.Equal(t, 1, voted.Upvotes)
+	assert.Equal(t, 1, voted.Downvotes)
+
+	votes, err := comments.GetVotes(other, []string{comment.ID})
+	require.NoError(t, err)
+	assert.Equal(t, entity.VoteUp, votes[comment.ID])
+	votes, err = comments.GetVotes(nil, []string{comment.ID})
+	require.NoError(t, err)
+	assert.Empty(t, votes)
+
+	_, err = comments.Vote(nil, comment.ID, entity.VoteUp)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = comments.Vote(reader, comment.ID, entity.VoteUp)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = comments.Vote(other, comment.ID, entity.Vote(2))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = comments.Vote(other, "missing", entity.VoteUp)
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+
+	_, err = comments.CreateComment(author, "1", &comment.ID, "Content comment 2")
+	require.NoError(t, err)
+	require.NoError(t, comments.DeleteComment(author, comment.ID))
+	_, err = comments.Vote(other, comment.ID, entity.VoteNone)
+	assert.ErrorIs(t, err, ErrCommentDeleted)
+}
+
+func TestCommentService_Premoderation(t *testing.T) {
+	repo := setupTestRepo(t)
+	comments := NewCommentService(repo, nil)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationPremoderated})
+	require.NoError(t, err)
+
+	pending, err := comments.CreateComment(author, "1", nil, "Content comment 1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, pending.Status)
+
+	assert.True(t, CanSee(author, pending))
+	assert.True(t, CanSee(moderator, pending))
+	assert.False(t, CanSee(other, pending))
+	assert.False(t, CanSee(nil, pending))
+
+	_, err = comments.CreateComment(other, "1", &pending.ID, "Content comment 2")
+	assert.ErrorIs(t, err, ErrParentNotFound, "others cannot reply to a pending comment")
+	_, err = comments.Vote(other, pending.ID, entity.VoteUp)
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+
+	reply, err := comments.CreateComment(moderator, "1", &pending.ID, "Content comment 3")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, reply.Status, "moderators' comments wait too")
+}
+
+func TestCommentService_Filters(t *testing.T) {
+	repo := setupTestRepo(t)
+	pipeline := filter.NewPipeline(
+		filter.NewBannedWords([]string{"casino"}, filter.Reject),
+		filter.NewLinks(1, filter.Hold),
+		filter.NewRepeatedChars(5, filter.Tag),
+	)
+	comments := NewCommentService(repo, pipeline)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+
+	_, err = comments.CreateComment(author, "1", nil, "Visit my casino")
+	assert.ErrorIs(t, err, ErrContentRejected)
+	assert.ErrorContains(t, err, "contains a banned word")
+
+	tagged, err := comments.CreateComment(author, "1", nil, "Wow!!!!!!")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPublished, tagged.Status)
+	assert.Equal(t, []string{"repeated_chars"}, tagged.Tags)
+
+	held, err := comments.CreateComment(author, "1", nil, "See https://a.example and https://b.example")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, held.Status)
+	assert.Equal(t, []string{"too_many_links"}, held.Tags)
+
+	_, err = comments.UpdateComment(author, tagged.ID, "Now a casino ad")
+	assert.ErrorIs(t, err, ErrContentRejected)
+	updated, err := comments.UpdateComment(author, tagged.ID, "Links: https://a.example https://b.example")
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, updated.Status, "an edit can be held too")
+
+	stored, err := repo.GetCommentById(tagged.ID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.CommentPending, stored.Status)
+	assert.Equal(t, []string{"too_many_links"}, stored.Tags)
+}
+
+type filterFunc func(content filter.Content) (filter.Decision, error)
+
+func (f filterFunc) Check(content filter.Content) (filter.Decision, error) {
+	return f(content)
+}
+
+func TestCommentService_FiltersRecordSavedComments(t *testing.T) {
+	repo := setupTestRepo(t)
+	checks := 0
+	rejectFirst := filterFunc(func(filter.Content) (filter.Decision, error) {
+		if checks++; checks == 1 {
+			return filter.Decision{Action: filter.Reject, Tag: "flaky", Reason: "try again"}, nil
+		}
+		return filter.Decision{}, nil
+	})
+	comments := NewCommentService(repo, filter.NewPipeline(rejectFirst, filter.NewDuplicates(time.Minute, filter.Tag)))
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+
+	_, err = comments.CreateComment(author, "1", nil, "Great post")
+	assert.ErrorIs(t, err, ErrContentRejected)
+	resubmitted, err := comments.CreateComment(author, "1", nil, "Great post")
+	require.NoError(t, err)
+	assert.Empty(t, resubmitted.Tags, "a rejected comment is not remembered")
+
+	repeated, err := comments.CreateComment(author, "1", nil, "Great post")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"duplicate"}, repeated.Tags)
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+)
+
+var ErrInvalidInput = errors.New("invalid input")
+var ErrPostNotFound = errors.New("post not found")
+var ErrCommentNotFound = errors.New("comment not found")
+var ErrParentNotFound = errors.New("parent comment not found")
+var ErrCommentsDisabled = errors.New("comments are disabled for this post")
+var ErrParentOnOtherPost = errors.New("parent comment belongs to another post")
+var ErrCommentDeleted = errors.New("comment is deleted")
+var ErrUserNotFound = errors.New("user not found")
+var ErrUserExists = errors.New("user name is taken")
+var ErrInvalidCredentials = errors.New("invalid user name or password")
+var ErrUnauthenticated = errors.New("authentication required")
+var ErrForbidden = errors.New("permission denied")
+var ErrAlreadyReported = errors.New("comment is already reported by this user")
+var ErrReportNotFound = errors.New("report not found")
+var ErrContentRejected = errors.New("comment rejected by the content filter")
+
+// translate replaces a repo's not-found error with the matching service error.
+func translate(err error, notFound error, serviceErr error) error {
+	if errors.Is(err, notFound) {
+		return serviceErr
+	}
+	return err
+}
+
+// translateCreateError maps the errors a backend reports when it re-checks
+// the comment rules atomically on write to the service's own errors.
+func translateCreateError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrPostNotFound):
+		return ErrPostNotFound
+	case errors.Is(err, database.ErrCommentNotFound):
+		return ErrParentNotFound
+	case errors.Is(err, database.ErrCommentsNotActive):
+		return ErrCommentsDisabled
+	case errors.Is(err, database.ErrParentOnOtherPost):
+		return ErrParentOnOtherPost
+	default:
+		return err
+	}
+}
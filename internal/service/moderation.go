@@ -0,0 +1,195 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/filter"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type ModerationService struct {
+	repo       database.Repo
+	classifier *filter.Classifier
+}
+
+// NewModerationService teaches the classifier, if any, from the comments
+// moderators hide, and from the hidden or pending ones they approve.
+func NewModerationService(repo database.Repo, classifier *filter.Classifier) *ModerationService {
+	return &ModerationService{repo: repo, classifier: classifier}
+}
+
+// ReportComment flags the comment for the moderators. A user can have one open
+// report per comment; once a moderator closes it, the comment can be reported again.
+func (s *ModerationService) ReportComment(actor *entity.User, commentID string, reason string) (*entity.Report, error) {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return nil, err
+	}
+
+	report := &entity.Report{
+		ID:        uuid.New().String(),
+		CommentID: commentID,
+		UserID:    actor.ID,
+		Reason:    strings.TrimSpace(reason),
+		Status:    entity.ReportOpen,
+		CreatedAt: database.Now(),
+	}
+	if err := validateStruct(report); err != nil {
+		return nil, err
+	}
+
+	comment, err := s.repo.GetCommentById(commentID)
+	if err != nil {
+		return nil, translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+	if !CanSee(actor, comment) {
+		return nil, ErrCommentNotFound
+	}
+	if comment.Deleted {
+		return nil, ErrCommentDeleted
+	}
+	report.PostID = comment.PostID
+
+	created, err := s.repo.CreateReport(report)
+	if err != nil {
+		return nil, translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+	if !created {
+		return nil, ErrAlreadyReported
+	}
+	return report, nil
+}
+
+// GetQueue returns the reported comments that wait for a moderator, the most
+// reported first.
+func (s *ModerationService) GetQueue(actor *entity.User, limit int, offset int) ([]*database.ModerationItem, error) {
+	if err := RequireRole(actor, entity.RoleModerator); err != nil {
+		return nil, err
+	}
+
+	items, err := s.repo.GetModerationQueue(limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation queue: %w", err)
+	}
+	return items, nil
+}
+
+// HideComment hides the comment from everyone below the moderator role and
+// resolves its open reports. The classifier learns it as spam unless it was hidden already.
+func (s *ModerationService) HideComment(actor *entity.User, id string) (*entity.Comment, error) {
+	comment, _, err := s.moderate(actor, id, true, entity.ReportResolved)
+	return comment, err
+}
+
+// GetPending returns the comments on premoderated posts that wait for a
+// moderator, oldest first.
+func (s *ModerationService) GetPending(actor *entity.User, limit int, offset int) ([]*entity.Comment, error) {
+	if err := RequireRole(actor, entity.RoleModerator); err != nil {
+		return nil, err
+	}
+
+	comments, err := s.repo.GetPendingComments(limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending comments: %w", err)
+	}
+	return comments, nil
+}
+
+// ApproveComment shows a hidden comment again, publishes a pending one and
+// dismisses its open reports. It also reports whether the comment was pending,
+// that is whether everyone else sees it for the first time. The classifier learns
+// it as ham if it was hidden or pending.
+func (s *ModerationService) ApproveComment(actor *entity.User, id string) (*entity.Comment, bool, error) {
+	return s.moderate(actor, id, false, entity.ReportDismissed)
+}
+
+// DismissReport rejects a single open report, leaving the comment as it is.
+func (s *ModerationService) DismissReport(actor *entity.User, id string) (*entity.Report, error) {
+	if err := RequireRole(actor, entity.RoleModerator); err != nil {
+		return nil, err
+	}
+
+	report, err := s.repo.DismissReport(id)
+	if err != nil {
+		return nil, translate(err, database.ErrReportNotFound, ErrReportNotFound)
+	}
+	return report, nil
+}
+
+// moderate also reports whether the comment was pending before.
+func (s *ModerationService) moderate(actor *entity.User, id string, hidden bool, status entity.ReportStatus) (*entity.Comment, bool, error) {
+	if err := RequireRole(actor, entity.RoleModerator); err != nil {
+		return nil, false, err
+	}
+
+	comment, err := s.repo.GetCommentById(id)
+	if err != nil {
+		return nil, false, translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+	if comment.Deleted {
+		return nil, false, ErrCommentDeleted
+	}
+
+	moderated, err := s.repo.ModerateComment(id, hidden, status)
+	if err != nil {
+		return nil, false, translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+	// Only a decision that changes the comment teaches the classifier, so repeated
+	// clicks do not count twice.
+	switch {
+	case hidden && !comment.Hidden:
+		s.train(moderated, true)
+	case !hidden && (comment.Hidden || comment.Status == entity.CommentPending):
+		s.train(moderated, false)
+	}
+	return moderated, comment.Status == entity.CommentPending, nil
+}
+
+// train is best effort: the moderator's decision stands even if the classifier
+// cannot learn from it. The store learns each comment once per verdict, so hiding
+// a comment again after approving it does not count it twice.
+func (s *ModerationService) train(comment *entity.Comment, spam bool) {
+	if s.classifier == nil {
+		return
+	}
+	if err := s.classifier.Train(comment.ID, comment.Content, spam); err != nil {
+		logrus.Errorf("failed to train spam filter on comment %s: %v", comment.ID, err)
+	}
+}
+
+// CanSee reports whether the actor may see the comment at all: a pending comment
+// is only there for its author and the moderators.
+func CanSee(actor *entity.User, comment *entity.Comment) bool {
+	return ViewerOf(actor).CanSee(comment)
+}
+
+// ViewerOf returns who the repository lists comments for when the actor asks.
+func ViewerOf(actor *entity.User) database.Viewer {
+	if actor == nil {
+		return database.Viewer{}
+	}
+	return database.Viewer{UserID: actor.ID, Moderator: CanSeeHidden(actor)}
+}
+
+// CanSeeHidden reports whether the actor sees hidden comments as they are.
+func CanSeeHidden(actor *entity.User) bool {
+	return actor != nil && actor.Role.AtLeast(entity.RoleModerator)
+}
+
+// Conceal returns the comment as the actor may see it: a hidden comment keeps its
+// place in the thread, but only moderators get its content. The content filter's
+// tags are for moderators only as well.
+func Conceal(actor *entity.User, comment *entity.Comment) *entity.Comment {
+	if CanSeeHidden(actor) || (!comment.Hidden && len(comment.Tags) == 0) {
+		return comment
+	}
+	concealed := *comment
+	concealed.Tags = nil
+	if comment.Hidden {
+		concealed.Content = entity.HiddenCommentContent
+	}
+	return &concealed
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModerationService(t *testing.T) {
+	repo := setupTestRepo(t)
+	moderation := NewModerationService(repo, nil)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "c1", PostID: "1", Content: "Comment c1"})
+	require.NoError(t, err)
+
+	report, err := moderation.ReportComment(author, "c1", "  spam  ")
+	require.NoError(t, err)
+	assert.Equal(t, "1", report.PostID)
+	assert.Equal(t, "spam", report.Reason)
+	_, err = moderation.ReportComment(author, "c1", "spam")
+	assert.ErrorIs(t, err, ErrAlreadyReported)
+	_, err = moderation.ReportComment(other, "c1", " ")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = moderation.ReportComment(other, "c1", strings.Repeat("a", 501))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = moderation.ReportComment(other, "missing", "spam")
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+	_, err = moderation.ReportComment(reader, "c1", "spam")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = moderation.GetQueue(author, 10, 0)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = moderation.HideComment(author, "c1")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = moderation.DismissReport(nil, report.ID)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	items, err := moderation.GetQueue(moderator, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "c1", items[0].Comment.ID)
+
+	hidden, err := moderation.HideComment(moderator, "c1")
+	require.NoError(t, err)
+	assert.True(t, hidden.Hidden)
+	assert.Equal(t, entity.HiddenCommentContent, Conceal(author, hidden).Content)
+	assert.Equal(t, entity.HiddenCommentContent, Conceal(nil, hidden).Content)
+	assert.Equal(t, "Comment c1", Conceal(moderator, hidden).Content)
+	assert.Equal(t, "Comment c1", hidden.Content, "concealing works on a copy")
+
+	tagged := &entity.Comment{ID: "c2", Content: "Wow!!!!!!", Tags: []string{"repeated_chars"}}
+	assert.Empty(t, Conceal(author, tagged).Tags, "tags are for moderators")
+	assert.Equal(t, "Wow!!!!!!", Conceal(author, tagged).Content)
+	assert.Equal(t, []string{"repeated_chars"}, Conceal(moderator, tagged).Tags)
+
+	_, err = moderation.DismissReport(moderator, report.ID)
+	assert.ErrorIs(t, err, ErrReportNotFound, "hiding resolved the report")
+
+	approved, published, err := moderation.ApproveComment(moderator, "c1")
+	require.NoError(t, err)
+	assert.False(t, approved.Hidden)
+	assert.False(t, published, "the comment was never pending")
+	_, _, err = moderation.ApproveComment(moderator, "missing")
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+}
+
+func TestModerationService_Pending(t *testing.T) {
+	repo := setupTestRepo(t)
+	moderation := NewModerationService(repo, nil)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationPremoderated})
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "c1", PostID: "1", AuthorID: author.ID, Content: "Comment c1"})
+	require.NoError(t, err)
+
+	_, err = moderation.ReportComment(other, "c1", "spam")
+	assert.ErrorIs(t, err, ErrCommentNotFound, "others cannot see a pending comment")
+	_, err = moderation.GetPending(author, 10, 0)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	pending, err := moderation.GetPending(moderator, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "c1", pending[0].ID)
+
+	approved, published, err := moderation.ApproveComment(moderator, "c1")
+	require.NoError(t, err)
+	assert.True(t, published)
+	assert.Equal(t, entity.CommentPublished, approved.Status)
+	assert.True(t, CanSee(other, approved))
+
+	pending, err = moderation.GetPending(moderator, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestModerationService_TrainsClassifier(t *testing.T) {
+	repo := setupTestRepo(t)
+	moderation := NewModerationService(repo, filter.NewClassifier(repo, 0.9, 1, filter.Hold))
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "c1", PostID: "1", Content: "Cheap pills"})
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "c2", PostID: "1", Content: "Nice post"})
+	require.NoError(t, err)
+
+	_, err = repo.SetPostModerationMode("1", entity.ModerationPremoderated)
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "c3", PostID: "1", Content: "Lovely post"})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = moderation.HideComment(moderator, "c1")
+		require.NoError(t, err)
+		_, _, err = moderation.ApproveComment(moderator, "c2")
+		require.NoError(t, err)
+		_, _, err = moderation.ApproveComment(moderator, "c3")
+		require.NoError(t, err)
+	}
+
+	counts, err := repo.GetSpamTokens([]string{"cheap", "nice", "lovely"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*entity.SpamToken{
+		"cheap":  {Token: "cheap", Spam: 1},
+		"lovely": {Token: "lovely", Ham: 1},
+	}, counts, "only decisions that change a comment count, and only once")
+
+	_, _, err = moderation.ApproveComment(moderator, "c1")
+	require.NoError(t, err)
+	_, err = moderation.HideComment(moderator, "c1")
+	require.NoError(t, err)
+	counts, err = repo.GetSpamTokens([]string{"cheap"})
+	require.NoError(t, err)
+	assert.Equal(t, &entity.SpamToken{Token: "cheap", Spam: 1, Ham: 1}, counts["cheap"], "hiding it again does not count twice")
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+// RequireRole fails unless the actor is logged in with the given role or a higher one.
+func RequireRole(actor *entity.User, role entity.Role) error {
+	switch {
+	case actor == nil:
+		return ErrUnauthenticated
+	case !actor.Role.AtLeast(role):
+		return ErrForbidden
+	default:
+		return nil
+	}
+}
+
+// Authorize allows moderators to change any content and commenters to change their own.
+// Content written before accounts existed has no author, so only moderators may change it.
+func Authorize(actor *entity.User, authorID string) error {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return err
+	}
+	if actor.Role.AtLeast(entity.RoleModerator) || (authorID != "" && actor.ID == authorID) {
+		return nil
+	}
+	return ErrForbidden
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/google/uuid"
+)
+
+type PostService struct {
+	repo database.Repo
+}
+
+func NewPostService(repo database.Repo) *PostService {
+	return &PostService{repo: repo}
+}
+
+func (s *PostService) CreatePost(actor *entity.User, title string, content string, mode entity.ModerationMode) (*entity.Post, error) {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return nil, err
+	}
+	if !mode.Valid() {
+		return nil, fmt.Errorf("%w: unknown moderation mode %q", ErrInvalidInput, mode)
+	}
+
+	now := database.Now()
+	post := &entity.Post{
+		ID:             uuid.New().String(),
+		Title:          title,
+		Content:        content,
+		ModerationMode: mode,
+		AuthorID:       actor.ID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if err := validateStruct(post); err != nil {
+		return nil, err
+	}
+
+	savedPost, err := s.repo.CreatePost(post)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+
+	return savedPost, nil
+}
+
+func (s *PostService) GetPosts(order database.PostSort) ([]*entity.Post, error) {
+	posts, err := s.repo.GetPosts(order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get posts: %w", err)
+	}
+	return posts, nil
+}
+
+func (s *PostService) GetPostsAfter(first int, after *database.Cursor) ([]*entity.Post, bool, error) {
+	posts, hasNext, err := s.repo.GetPostsAfter(first, after)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get posts: %w", err)
+	}
+	return posts, hasNext, nil
+}
+
+func (s *PostService) GetPost(id string) (*entity.Post, error) {
+	post, err := s.repo.GetPostById(id)
+	if err != nil {
+		return nil, translate(err, database.ErrPostNotFound, ErrPostNotFound)
+	}
+	return post, nil
+}
+
+// UpdatePost changes the title and/or the content; nil arguments are left as they are.
+func (s *PostService) UpdatePost(actor *entity.User, id string, title *string, content *string) (*entity.Post, error) {
+	post, err := s.authorizedPost(actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if title != nil {
+		post.Title = *title
+	}
+	if content != nil {
+		post.Content = *content
+	}
+	post.UpdatedAt = database.Now()
+
+	if err := validateStruct(post); err != nil {
+		return nil, err
+	}
+
+	updatedPost, err := s.repo.UpdatePost(post)
+	if err != nil {
+		return nil, translate(err, database.ErrPostNotFound, ErrPostNotFound)
+	}
+
+	return updatedPost, nil
+}
+
+// DeletePost removes the post together with all of its comments.
+func (s *PostService) DeletePost(actor *entity.User, id string) error {
+	if _, err := s.authorizedPost(actor, id); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeletePost(id); err != nil {
+		return translate(err, database.ErrPostNotFound, ErrPostNotFound)
+	}
+	return nil
+}
+
+// SetModerationMode changes who may comment on the post. Comments already
+// waiting for a moderator stay pending whatever the new mode is.
+func (s *PostService) SetModerationMode(actor *entity.User, id string, mode entity.ModerationMode) (*entity.Post, error) {
+	if !mode.Valid() {
+		return nil, fmt.Errorf("%w: unknown moderation mode %q", ErrInvalidInput, mode)
+	}
+	if _, err := s.authorizedPost(actor, id); err != nil {
+		return nil, err
+	}
+
+	post, err := s.repo.SetPostModerationMode(id, mode)
+	if err != nil {
+		return nil, translate(err, database.ErrPostNotFound, ErrPostNotFound)
+	}
+	return post, nil
+}
+
+// authorizedPost returns the post if the actor may change it.
+func (s *PostService) authorizedPost(actor *entity.User, id string) (*entity.Post, error) {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return nil, err
+	}
+
+	post, err := s.GetPost(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Authorize(actor, post.AuthorID); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
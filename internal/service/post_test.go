@@ -0,0 +1,108 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostService_CreatePost(t *testing.T) {
+	posts := NewPostService(setupTestRepo(t))
+
+	post, err := posts.CreatePost(author, "Post 1", "Content 1", entity.ModerationClosed)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, post.ID)
+	assert.Equal(t, entity.ModerationClosed, post.ModerationMode)
+	assert.False(t, post.CreatedAt.IsZero())
+
+	saved, err := posts.GetPost(post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Post 1", saved.Title)
+
+	_, err = posts.CreatePost(author, "", "Content 2", entity.ModerationOpen)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = posts.CreatePost(author, strings.Repeat("a", 256), "Content 3", entity.ModerationOpen)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = posts.CreatePost(author, "Post 4", "Content 4", "unknown")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = posts.GetPost("missing")
+	assert.ErrorIs(t, err, ErrPostNotFound)
+}
+
+func TestPostService_UpdatePost(t *testing.T) {
+	posts := NewPostService(setupTestRepo(t))
+
+	post, err := posts.CreatePost(author, "Post 1", "Content 1", entity.ModerationOpen)
+	require.NoError(t, err)
+
+	title := "Edited post 1"
+	updated, err := posts.UpdatePost(author, post.ID, &title, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited post 1", updated.Title)
+	assert.Equal(t, "Content 1", updated.Content)
+
+	empty := ""
+	_, err = posts.UpdatePost(author, post.ID, nil, &empty)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = posts.UpdatePost(author, "missing", &title, nil)
+	assert.ErrorIs(t, err, ErrPostNotFound)
+}
+
+func TestPostService_SetModerationModeAndDeletePost(t *testing.T) {
+	posts := NewPostService(setupTestRepo(t))
+
+	post, err := posts.CreatePost(author, "Post 1", "Content 1", entity.ModerationOpen)
+	require.NoError(t, err)
+
+	updated, err := posts.SetModerationMode(author, post.ID, entity.ModerationPremoderated)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.ModerationPremoderated, updated.ModerationMode)
+
+	_, err = posts.SetModerationMode(author, post.ID, "")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = posts.SetModerationMode(author, "missing", entity.ModerationClosed)
+	assert.ErrorIs(t, err, ErrPostNotFound)
+
+	assert.NoError(t, posts.DeletePost(author, post.ID))
+	assert.ErrorIs(t, posts.DeletePost(author, post.ID), ErrPostNotFound)
+
+	_, err = posts.GetPost(post.ID)
+	assert.ErrorIs(t, err, ErrPostNotFound)
+}
+
+func TestPostService_Authorization(t *testing.T) {
+	repo := setupTestRepo(t)
+	posts := NewPostService(repo)
+
+	_, err := posts.CreatePost(nil, "Post 1", "Content 1", entity.ModerationOpen)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = posts.CreatePost(reader, "Post 1", "Content 1", entity.ModerationOpen)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	post, err := posts.CreatePost(author, "Post 1", "Content 1", entity.ModerationOpen)
+	require.NoError(t, err)
+	assert.Equal(t, author.ID, post.AuthorID)
+
+	title := "Edited post 1"
+	_, err = posts.UpdatePost(other, post.ID, &title, nil)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = posts.SetModerationMode(other, post.ID, entity.ModerationClosed)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, posts.DeletePost(nil, post.ID), ErrUnauthenticated)
+
+	// Posts written before accounts existed have no author; only moderators may change them.
+	_, err = repo.CreatePost(&entity.Post{ID: "legacy", Title: "Post 2", Content: "Content 2", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	_, err = posts.UpdatePost(author, "legacy", &title, nil)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = posts.UpdatePost(moderator, "legacy", &title, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, posts.DeletePost(moderator, post.ID))
+}
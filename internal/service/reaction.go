@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+)
+
+// DefaultReactionEmojis are offered when no list is configured.
+var DefaultReactionEmojis = []string{"👍", "❤️", "😂", "😮", "😢"}
+
+type ReactionService struct {
+	repo   database.Repo
+	emojis []string
+	order  map[string]int
+}
+
+// NewReactionService offers the given emojis, in that order, or DefaultReactionEmojis
+// when the list is empty.
+func NewReactionService(repo database.Repo, emojis []string) *ReactionService {
+	if len(emojis) == 0 {
+		emojis = DefaultReactionEmojis
+	}
+
+	order := make(map[string]int, len(emojis))
+	for i, emoji := range emojis {
+		if _, ok := order[emoji]; !ok {
+			order[emoji] = i
+		}
+	}
+	return &ReactionService{repo: repo, emojis: emojis, order: order}
+}
+
+// Emojis returns the emojis users may react with, in display order.
+func (s *ReactionService) Emojis() []string {
+	return append([]string(nil), s.emojis...)
+}
+
+// AddReaction puts the emoji on the post or comment for the actor and reports whether
+// anything changed: reacting twice with the same emoji counts once.
+func (s *ReactionService) AddReaction(actor *entity.User, target entity.ReactionTarget, emoji string) (bool, error) {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return false, err
+	}
+	if _, ok := s.order[emoji]; !ok {
+		return false, fmt.Errorf("%w: %q is not one of the reaction emojis", ErrInvalidInput, emoji)
+	}
+
+	comment, err := s.checkTarget(actor, target)
+	if err != nil {
+		return false, err
+	}
+	if comment != nil && comment.Deleted {
+		return false, ErrCommentDeleted
+	}
+
+	added, err := s.repo.AddReaction(&entity.Reaction{PostID: target.PostID, CommentID: target.CommentID, UserID: actor.ID, Emoji: emoji})
+	if err != nil {
+		return false, translateReactionError(err)
+	}
+	return added, nil
+}
+
+// RemoveReaction takes the actor's emoji back and reports whether there was one.
+// Emojis that are no longer offered can still be taken back.
+func (s *ReactionService) RemoveReaction(actor *entity.User, target entity.ReactionTarget, emoji string) (bool, error) {
+	if err := RequireRole(actor, entity.RoleCommenter); err != nil {
+		return false, err
+	}
+	if _, err := s.checkTarget(actor, target); err != nil {
+		return false, err
+	}
+
+	removed, err := s.repo.RemoveReaction(&entity.Reaction{PostID: target.PostID, CommentID: target.CommentID, UserID: actor.ID, Emoji: emoji})
+	if err != nil {
+		return false, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return removed, nil
+}
+
+// GetReactions returns the reactions on each target in display order; emojis that
+// are no longer offered come last. Anonymous actors have reacted with nothing.
+func (s *ReactionService) GetReactions(actor *entity.User, targets []entity.ReactionTarget) (map[entity.ReactionTarget][]*entity.ReactionCount, error) {
+	userID := ""
+	if actor != nil {
+		userID = actor.ID
+	}
+
+	reactions, err := s.repo.GetReactions(userID, targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions: %w", err)
+	}
+
+	for _, counts := range reactions {
+		sort.Slice(counts, func(i, j int) bool {
+			a, aOffered := s.order[counts[i].Emoji]
+			b, bOffered := s.order[counts[j].Emoji]
+			if aOffered != bOffered {
+				return aOffered
+			}
+			if aOffered {
+				return a < b
+			}
+			return counts[i].Emoji < counts[j].Emoji
+		})
+	}
+	return reactions, nil
+}
+
+// checkTarget returns the comment reacted to, or nil for a post, after making sure
+// the target exists and the actor can see it.
+func (s *ReactionService) checkTarget(actor *entity.User, target entity.ReactionTarget) (*entity.Comment, error) {
+	if target.CommentID == "" {
+		if _, err := s.repo.GetPostById(target.PostID); err != nil {
+			return nil, translate(err, database.ErrPostNotFound, ErrPostNotFound)
+		}
+		return nil, nil
+	}
+
+	comment, err := s.repo.GetCommentById(target.CommentID)
+	if err != nil {
+		return nil, translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+	}
+	if comment.PostID != target.PostID || !CanSee(actor, comment) {
+		return nil, ErrCommentNotFound
+	}
+	return comment, nil
+}
+
+// translateReactionError maps the errors a backend reports when the target
+// disappears between the check and the write.
+func translateReactionError(err error) error {
+	err = translate(err, database.ErrPostNotFound, ErrPostNotFound)
+	return translate(err, database.ErrCommentNotFound, ErrCommentNotFound)
+}
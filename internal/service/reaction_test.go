@@ -0,0 +1,95 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReactionService_AddAndRemoveReaction(t *testing.T) {
+	repo := setupTestRepo(t)
+	reactions := NewReactionService(repo, []string{"🔥", "👍"})
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "c1", PostID: "1", Content: "Comment c1"})
+	require.NoError(t, err)
+	post := entity.ReactionTarget{PostID: "1"}
+	comment := entity.ReactionTarget{PostID: "1", CommentID: "c1"}
+
+	added, err := reactions.AddReaction(author, post, "👍")
+	assert.NoError(t, err)
+	assert.True(t, added)
+	added, err = reactions.AddReaction(author, post, "👍")
+	assert.NoError(t, err)
+	assert.False(t, added)
+	_, err = reactions.AddReaction(other, post, "🔥")
+	assert.NoError(t, err)
+
+	_, err = reactions.AddReaction(author, post, "❤️")
+	assert.ErrorIs(t, err, ErrInvalidInput, "only the configured emojis are offered")
+	_, err = reactions.AddReaction(author, entity.ReactionTarget{PostID: "missing"}, "👍")
+	assert.ErrorIs(t, err, ErrPostNotFound)
+	_, err = reactions.AddReaction(author, entity.ReactionTarget{PostID: "2", CommentID: "c1"}, "👍")
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+	_, err = reactions.AddReaction(nil, post, "👍")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = reactions.AddReaction(reader, post, "👍")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	got, err := reactions.GetReactions(author, []entity.ReactionTarget{post, comment})
+	require.NoError(t, err)
+	assert.Equal(t, []*entity.ReactionCount{
+		{Emoji: "🔥", Count: 1},
+		{Emoji: "👍", Count: 1, ReactedByMe: true},
+	}, got[post], "reactions come in the configured order")
+	assert.Empty(t, got[comment])
+
+	removed, err := reactions.RemoveReaction(author, post, "👍")
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = reactions.RemoveReaction(author, post, "👍")
+	assert.NoError(t, err)
+	assert.False(t, removed)
+
+	got, err = reactions.GetReactions(nil, []entity.ReactionTarget{post})
+	require.NoError(t, err)
+	assert.Equal(t, []*entity.ReactionCount{{Emoji: "🔥", Count: 1}}, got[post])
+}
+
+func TestReactionService_RetiredEmojisAndDeletedComments(t *testing.T) {
+	repo := setupTestRepo(t)
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Content 1", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+	parentID := "c1"
+	_, err = repo.CreateComment(&entity.Comment{ID: "c1", PostID: "1", Content: "Comment c1"})
+	require.NoError(t, err)
+	_, err = repo.CreateComment(&entity.Comment{ID: "c2", PostID: "1", ParentID: &parentID, Content: "Comment c2"})
+	require.NoError(t, err)
+	post := entity.ReactionTarget{PostID: "1"}
+
+	before := NewReactionService(repo, nil)
+	assert.Equal(t, DefaultReactionEmojis, before.Emojis())
+	_, err = before.AddReaction(author, post, "😢")
+	require.NoError(t, err)
+	_, err = before.AddReaction(author, post, "😂")
+	require.NoError(t, err)
+	_, err = before.AddReaction(author, post, "👍")
+	require.NoError(t, err)
+
+	after := NewReactionService(repo, []string{"👍"})
+	got, err := after.GetReactions(author, []entity.ReactionTarget{post})
+	require.NoError(t, err)
+	require.Len(t, got[post], 3)
+	assert.Equal(t, []string{"👍", "😂", "😢"}, []string{got[post][0].Emoji, got[post][1].Emoji, got[post][2].Emoji},
+		"emojis that are no longer offered come last")
+	removed, err := after.RemoveReaction(author, post, "😢")
+	assert.NoError(t, err)
+	assert.True(t, removed, "emojis that are no longer offered can still be taken back")
+
+	require.NoError(t, repo.DeleteComment("c1"))
+	_, err = after.AddReaction(author, entity.ReactionTarget{PostID: "1", CommentID: "c1"}, "👍")
+	assert.ErrorIs(t, err, ErrCommentDeleted)
+}
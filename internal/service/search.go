@@ -0,0 +1,37 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/search"
+)
+
+// maxSearchTerms bounds the work of a single query; every word is another index lookup.
+const maxSearchTerms = 16
+
+type SearchService struct {
+	repo database.Repo
+}
+
+func NewSearchService(repo database.Repo) *SearchService {
+	return &SearchService{repo: repo}
+}
+
+// Search returns the first posts or comments after the cursor containing every
+// word of text, best match first, and whether more follow. Anyone may search.
+func (s *SearchService) Search(text string, kind database.SearchType, first int, after *database.SearchCursor) ([]*database.SearchHit, bool, error) {
+	terms := search.Terms(text)
+	if len(terms) == 0 {
+		return nil, false, fmt.Errorf("%w: the query has no words", ErrInvalidInput)
+	}
+	if len(terms) > maxSearchTerms {
+		return nil, false, fmt.Errorf("%w: the query has more than %d words", ErrInvalidInput, maxSearchTerms)
+	}
+
+	hits, hasNext, err := s.repo.Search(database.SearchQuery{Text: text, Type: kind, First: first, After: after})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to search: %w", err)
+	}
+	return hits, hasNext, nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchService_Search(t *testing.T) {
+	repo := setupTestRepo(t)
+	searches := NewSearchService(repo)
+
+	_, err := repo.CreatePost(&entity.Post{ID: "1", Title: "Post 1", Content: "Full-text search", ModerationMode: entity.ModerationOpen})
+	require.NoError(t, err)
+
+	hits, hasNext, err := searches.Search("SEARCH", database.SearchPosts, 10, nil)
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	if assert.Len(t, hits, 1) {
+		assert.Equal(t, "Full-text <b>search</b>", hits[0].Snippet)
+	}
+
+	_, _, err = searches.Search(" - ", database.SearchPosts, 10, nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	words := make([]string, maxSearchTerms+1)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%d", i)
+	}
+	_, _, err = searches.Search(strings.Join(words, " "), database.SearchPosts, 10, nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
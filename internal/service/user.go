@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apartapatia/wall_of_comments/internal/auth"
+	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Session is a user together with a freshly issued token.
+type Session struct {
+	User  *entity.User
+	Token string
+}
+
+type UserService struct {
+	repo   database.Repo
+	tokens *auth.Tokens
+}
+
+// dummyPasswordHash is compared against when the name is unknown, so that a login
+// takes as long whether or not the user exists.
+const dummyPasswordHash = "$2a$10$HgpA7.6n7dUvdlL5whyNkeeVM0QPaB9oDKY5zMCgrutXKFPONH4oS"
+
+func NewUserService(repo database.Repo, tokens *auth.Tokens) *UserService {
+	return &UserService{repo: repo, tokens: tokens}
+}
+
+// Register creates a commenter account and logs it in. bcrypt only reads the
+// first 72 bytes of a password, so longer ones are rejected instead of truncated.
+func (s *UserService) Register(name string, password string) (*Session, error) {
+	if err := validate.Var(password, "min=8,max=72"); err != nil {
+		return nil, fmt.Errorf("%w: password must be between 8 and 72 bytes", ErrInvalidInput)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &entity.User{
+		ID:           uuid.New().String(),
+		Name:         name,
+		PasswordHash: string(hash),
+		Role:         entity.RoleCommenter,
+		CreatedAt:    database.Now(),
+	}
+
+	if err := validateStruct(user); err != nil {
+		return nil, err
+	}
+
+	savedUser, err := s.repo.CreateUser(user)
+	if err != nil {
+		return nil, translate(err, database.ErrUserExists, ErrUserExists)
+	}
+
+	return s.session(savedUser)
+}
+
+// Login checks the password and issues a new token. An unknown name and a wrong
+// password fail the same way, so names cannot be probed.
+func (s *UserService) Login(name string, password string) (*Session, error) {
+	user, err := s.repo.GetUserByName(name)
+	if errors.Is(err, database.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to check password: %w", err)
+	}
+
+	return s.session(user)
+}
+
+func (s *UserService) GetUser(id string) (*entity.User, error) {
+	users, err := s.GetUsers([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+func (s *UserService) GetUsers(ids []string) ([]*entity.User, error) {
+	users, err := s.repo.GetUsers(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	return users, nil
+}
+
+// SetRole changes the role of another user. Only admins may do it, and not to
+// themselves, so the last admin cannot lock everyone out by accident.
+func (s *UserService) SetRole(actor *entity.User, id string, role entity.Role) (*entity.User, error) {
+	if err := RequireRole(actor, entity.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if actor.ID == id {
+		return nil, fmt.Errorf("%w: admins cannot change their own role", ErrForbidden)
+	}
+	if !role.Valid() {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidInput, role)
+	}
+
+	user, err := s.repo.SetUserRole(id, role)
+	if err != nil {
+		return nil, translate(err, database.ErrUserNotFound, ErrUserNotFound)
+	}
+	return user, nil
+}
+
+func (s *UserService) session(user *entity.User) (*Session, error) {
+	token, err := s.tokens.Issue(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{User: user, Token: token}, nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apartapatia/wall_of_comments/internal/auth"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserService_RegisterAndLogin(t *testing.T) {
+	tokens := auth.NewTokens([]byte("secret"), time.Hour)
+	users := NewUserService(setupTestRepo(t), tokens)
+
+	session, err := users.Register("alice", "password1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", session.User.Name)
+	assert.Equal(t, entity.RoleCommenter, session.User.Role)
+	assert.NotEqual(t, "password1", session.User.PasswordHash)
+
+	userID, err := tokens.Verify(session.Token)
+	require.NoError(t, err)
+	assert.Equal(t, session.User.ID, userID)
+
+	_, err = users.Register("alice", "password2")
+	assert.ErrorIs(t, err, ErrUserExists)
+	_, err = users.Register("bob", "short")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = users.Register("b", "password1")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	session, err = users.Login("alice", "password1")
+	require.NoError(t, err)
+	assert.Equal(t, userID, session.User.ID)
+
+	_, err = users.Login("alice", "password2")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = users.Login("bob", "password1")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost, "unknown names cost as much as wrong passwords")
+
+	user, err := users.GetUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Name)
+	_, err = users.GetUser("missing")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestUserService_SetRole(t *testing.T) {
+	repo := setupTestRepo(t)
+	users := NewUserService(repo, auth.NewTokens([]byte("secret"), time.Hour))
+
+	session, err := users.Register("alice", "password1")
+	require.NoError(t, err)
+	alice := session.User
+	admin := &entity.User{ID: "admin", Name: "admin", Role: entity.RoleAdmin}
+
+	updated, err := users.SetRole(admin, alice.ID, entity.RoleModerator)
+	require.NoError(t, err)
+	assert.Equal(t, entity.RoleModerator, updated.Role)
+	stored, err := users.GetUser(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.RoleModerator, stored.Role)
+
+	_, err = users.SetRole(stored, alice.ID, entity.RoleAdmin)
+	assert.ErrorIs(t, err, ErrForbidden, "moderators cannot promote anyone")
+	_, err = users.SetRole(nil, alice.ID, entity.RoleAdmin)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = users.SetRole(admin, admin.ID, entity.RoleReader)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = users.SetRole(admin, alice.ID, entity.Role("owner"))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = users.SetRole(admin, "missing", entity.RoleReader)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestAuthorize(t *testing.T) {
+	admin := &entity.User{ID: "admin", Role: entity.RoleAdmin}
+	demoted := &entity.User{ID: "author", Role: entity.RoleReader}
+
+	assert.NoError(t, Authorize(author, "author"))
+	assert.ErrorIs(t, Authorize(other, "author"), ErrForbidden)
+	assert.ErrorIs(t, Authorize(author, ""), ErrForbidden)
+	assert.NoError(t, Authorize(moderator, "author"))
+	assert.NoError(t, Authorize(admin, ""))
+	assert.ErrorIs(t, Authorize(demoted, "author"), ErrForbidden, "readers cannot change what they wrote earlier")
+	assert.ErrorIs(t, Authorize(nil, "author"), ErrUnauthenticated)
+
+	assert.NoError(t, RequireRole(admin, entity.RoleModerator))
+	assert.ErrorIs(t, RequireRole(moderator, entity.RoleAdmin), ErrForbidden)
+	assert.ErrorIs(t, RequireRole(&entity.User{Role: "unknown"}, entity.RoleReader), ErrForbidden)
+}
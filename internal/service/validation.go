@@ -0,0 +1,18 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate checks the length limits declared in the entity struct tags,
+// so every storage backend enforces the same rules.
+var validate = validator.New()
+
+func validateStruct(value interface{}) error {
+	if err := validate.Struct(value); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return nil
+}
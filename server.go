@@ -1,25 +1,43 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/apartapatia/wall_of_comments/graph"
+	"github.com/apartapatia/wall_of_comments/internal/auth"
 	"github.com/apartapatia/wall_of_comments/internal/config"
 	"github.com/apartapatia/wall_of_comments/internal/database"
+	"github.com/apartapatia/wall_of_comments/internal/database/memory"
 	"github.com/apartapatia/wall_of_comments/internal/database/pq"
 	"github.com/apartapatia/wall_of_comments/internal/database/redis"
+	"github.com/apartapatia/wall_of_comments/internal/database/sqlite"
+	"github.com/apartapatia/wall_of_comments/internal/entity"
+	"github.com/apartapatia/wall_of_comments/internal/events"
+	"github.com/apartapatia/wall_of_comments/internal/filter"
+	"github.com/apartapatia/wall_of_comments/internal/service"
 	"github.com/sirupsen/logrus"
 )
 
 const defaultPort = "8090"
+const shutdownTimeout = 10 * time.Second
+
+// setRoleCommand changes the role of a user, e.g. "set-role alice admin". It is
+// how the first admin is made, since only admins may change roles over GraphQL.
+const setRoleCommand = "set-role"
 
 func main() {
-	dbtype := flag.String("db", "redis", "Database type to use (redis or postgres)")
+	dbtype := flag.String("db", "redis", "Database type to use (redis, postgres, sqlite or memory)")
 	flag.Parse()
+	command := flag.Arg(0)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -32,26 +50,164 @@ func main() {
 	}
 
 	var repo database.Repo
+	var bus events.Bus
+	var onShutdown func()
 	switch *dbtype {
 	case "postgres":
+		if command != "" && command != setRoleCommand {
+			logrus.Fatalf("command %s is only supported with -db redis", command)
+		}
 		repo, err = pq.GetRepo(conf.PostgresConfig)
 		if err != nil {
 			logrus.Fatalf("failed to get postgres repo: %v", err)
 		}
+		bus = events.NewMemoryBus()
+	case "sqlite":
+		if command != "" && command != setRoleCommand {
+			logrus.Fatalf("command %s is only supported with -db redis", command)
+		}
+		repo, err = sqlite.GetRepo(conf.SQLiteConfig)
+		if err != nil {
+			logrus.Fatalf("failed to get sqlite repo: %v", err)
+		}
+		bus = events.NewMemoryBus()
+	case "memory":
+		if command != "" && command != setRoleCommand {
+			logrus.Fatalf("command %s is only supported with -db redis", command)
+		}
+		repo, onShutdown = getMemoryRepo(conf.MemoryConfig)
+		bus = events.NewMemoryBus()
 	case "redis":
+		if command != "" && command != setRoleCommand {
+			runRedisCommand(conf.RedisConfig, command)
+			return
+		}
 		repo, err = redis.GetRepo(conf.RedisConfig)
 		if err != nil {
 			logrus.Fatalf("failed to get redis repo: %v", err)
 		}
+		bus, err = events.NewRedisBus(conf.RedisConfig)
+		if err != nil {
+			logrus.Fatalf("failed to get redis event bus: %v", err)
+		}
 	default:
 		logrus.Fatalf("unsupported database type: %s", *dbtype)
 	}
 
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{Repo: repo}}))
+	if command == setRoleCommand {
+		setRole(repo, flag.Arg(1), entity.Role(flag.Arg(2)))
+		if onShutdown != nil {
+			onShutdown()
+		}
+		return
+	}
+
+	if conf.AuthConfig.Secret == "" {
+		logrus.Fatal("AUTH_SECRET must be set to sign tokens")
+	}
+	tokens := auth.NewTokens([]byte(conf.AuthConfig.Secret), conf.AuthConfig.TokenTTL)
+
+	filters, classifier, err := filter.FromConfig(conf.FilterConfig, repo)
+	if err != nil {
+		logrus.Fatalf("failed to set up content filters: %v", err)
+	}
+
+	resolver := &graph.Resolver{
+		PostService:       service.NewPostService(repo),
+		CommentService:    service.NewCommentService(repo, filters),
+		UserService:       service.NewUserService(repo, tokens),
+		ReactionService:   service.NewReactionService(repo, conf.ReactionsConfig.Emojis),
+		SearchService:     service.NewSearchService(repo),
+		ModerationService: service.NewModerationService(repo, classifier),
+		Events:            bus,
+	}
+
+	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.NewConfig(resolver)))
+	srv.SetErrorPresenter(graph.ErrorPresenter)
+	srv.AroundResponses(graph.LoaderMiddleware(resolver.CommentService, resolver.UserService, resolver.ReactionService))
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", auth.Middleware(tokens, resolver.UserService)(srv))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	httpServer := &http.Server{Addr: ":" + port}
+	go func() {
+		logrus.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	logrus.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logrus.Errorf("failed to shut down the server: %v", err)
+	}
+
+	if onShutdown != nil {
+		onShutdown()
+	}
+}
+
+// getMemoryRepo returns an in-memory repo. When a snapshot path is configured,
+// the repo is loaded from it on start and written back to it on shutdown.
+func getMemoryRepo(cfg config.MemoryConfig) (database.Repo, func()) {
+	if cfg.SnapshotPath == "" {
+		return memory.NewRepo(), nil
+	}
+
+	repo, err := memory.Load(cfg.SnapshotPath)
+	if err != nil {
+		logrus.Fatalf("failed to load memory snapshot: %v", err)
+	}
+
+	return repo, func() {
+		if err := repo.Save(cfg.SnapshotPath); err != nil {
+			logrus.Errorf("failed to save memory snapshot: %v", err)
+		}
+	}
+}
+
+func setRole(repo database.Repo, name string, role entity.Role) {
+	if !role.Valid() {
+		logrus.Fatalf("usage: %s <name> <reader|commenter|moderator|admin>", setRoleCommand)
+	}
 
-	logrus.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	logrus.Fatal(http.ListenAndServe(":"+port, nil))
+	user, err := repo.GetUserByName(name)
+	if err != nil {
+		logrus.Fatalf("failed to find user: %v", err)
+	}
+	if _, err := repo.SetUserRole(user.ID, role); err != nil {
+		logrus.Fatalf("failed to set role: %v", err)
+	}
+	logrus.Infof("%s is now %s", name, role)
+}
+
+func runRedisCommand(cfg config.RedisConfig, command string) {
+	repo, err := redis.Connect(cfg)
+	if err != nil {
+		logrus.Fatalf("failed to connect to redis: %v", err)
+	}
+
+	switch command {
+	case "reindex":
+		if err := repo.Reindex(); err != nil {
+			logrus.Fatalf("failed to reindex redis: %v", err)
+		}
+	case "migrate":
+		if err := repo.Migrate(); err != nil {
+			logrus.Fatalf("failed to migrate redis: %v", err)
+		}
+	case "reset":
+		if err := repo.Reset(); err != nil {
+			logrus.Fatalf("failed to reset redis: %v", err)
+		}
+	default:
+		logrus.Fatalf("unsupported command: %s", command)
+	}
 }